@@ -0,0 +1,40 @@
+package main
+
+import (
+	"os"
+	"time"
+
+	// Packages
+	"github.com/djthorpe/go-tablewriter"
+
+	// Namespace imports
+	. "github.com/djthorpe/go-errors"
+)
+
+type DetectCmd struct {
+	Model    string        `arg:"" help:"Model to use"`
+	Path     string        `arg:"" help:"Path to audio file"`
+	Duration time.Duration `flag:"duration" help:"Duration of audio to detect the language from, up to thirty seconds" default:"30s"`
+}
+
+func (cmd *DetectCmd) Run(ctx *Globals) error {
+	// Get the model
+	model := ctx.service.GetModelById(cmd.Model)
+	if model == nil {
+		return ErrNotFound.With(cmd.Model)
+	}
+
+	// Open the audio file
+	f, err := os.Open(cmd.Path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	// Detect the language, and output the languages ranked by probability
+	languages, err := ctx.service.DetectLanguage(ctx.ctx, model, f, cmd.Duration)
+	if err != nil {
+		return err
+	}
+	return ctx.writer.Write(languages, tablewriter.OptHeader())
+}
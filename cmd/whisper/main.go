@@ -6,6 +6,7 @@ import (
 	"os"
 	"path/filepath"
 	"syscall"
+	"time"
 
 	// Packages
 	kong "github.com/alecthomas/kong"
@@ -15,9 +16,11 @@ import (
 )
 
 type Globals struct {
-	NoGPU bool   `name:"nogpu" help:"Disable GPU acceleration"`
-	Debug bool   `name:"debug" help:"Enable debug output"`
-	Dir   string `name:"dir" help:"Path to model store, uses ${WHISPER_DIR} " default:"${WHISPER_DIR}"`
+	NoGPU  bool          `name:"nogpu" help:"Disable GPU acceleration"`
+	Debug  bool          `name:"debug" help:"Enable debug output"`
+	Dir    string        `name:"dir" help:"Path to model store, uses ${WHISPER_DIR} " default:"${WHISPER_DIR}"`
+	Memory uint64        `name:"memory" help:"Memory limit for loaded models, in megabytes"`
+	Idle   time.Duration `name:"idle" help:"Unload models which are idle for longer than this duration"`
 
 	// Writer, service and context
 	writer  *tablewriter.Writer
@@ -28,6 +31,7 @@ type Globals struct {
 type CLI struct {
 	Globals
 	Transcribe TranscribeCmd `cmd:"transcribe" help:"Transcribe from file"`
+	Detect     DetectCmd     `cmd:"detect" help:"Detect the language of a file"`
 	Models     ModelsCmd     `cmd:"models" help:"List models"`
 	Download   DownloadCmd   `cmd:"download" help:"Download a model"`
 	Delete     DeleteCmd     `cmd:"delete" help:"Delete a model"`
@@ -52,7 +56,8 @@ func main() {
 		kong.UsageOnError(),
 		kong.ConfigureHelp(kong.HelpOptions{Compact: true}),
 		kong.Vars{
-			"WHISPER_DIR": dirEnvOrDefault(name),
+			"WHISPER_DIR":  dirEnvOrDefault(name),
+			"WHISPER_JOBS": os.Getenv("WHISPER_JOBS"),
 		},
 	)
 
@@ -68,6 +73,18 @@ func main() {
 	if cli.Globals.NoGPU {
 		opts = append(opts, whisper.OptNoGPU())
 	}
+	if cli.Globals.Memory > 0 {
+		opts = append(opts, whisper.OptMemoryLimit(cli.Globals.Memory<<20))
+	}
+	if cli.Globals.Idle > 0 {
+		opts = append(opts, whisper.OptIdleTimeout(cli.Globals.Idle))
+	}
+	if len(cli.Server.Preload) > 0 {
+		opts = append(opts, whisper.OptPreload(cli.Server.Preload...))
+		if cli.Server.Warmup {
+			opts = append(opts, whisper.OptWarmup())
+		}
+	}
 
 	// Create directory if it doesn't exist
 	if err := os.MkdirAll(cli.Globals.Dir, 0755); err != nil {
@@ -75,6 +92,20 @@ func main() {
 		return
 	}
 
+	// Create job store directory if it doesn't exist, so that the server
+	// restores and runs queued jobs. Other commands do not run jobs
+	if cmd.Command() == "server" {
+		if cli.Server.Jobs == "" {
+			cli.Server.Jobs = filepath.Join(cli.Globals.Dir, "jobs")
+		}
+		if err := os.MkdirAll(cli.Server.Jobs, 0755); err != nil {
+			cmd.FatalIfErrorf(err)
+			return
+		} else {
+			opts = append(opts, whisper.OptJobStore(cli.Server.Jobs))
+		}
+	}
+
 	// Create a whisper server - create
 	service, err := whisper.New(cli.Globals.Dir, opts...)
 	if err != nil {
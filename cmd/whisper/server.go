@@ -9,8 +9,11 @@ import (
 )
 
 type ServerCmd struct {
-	Endpoint string `name:"endpoint" help:"Endpoint for the server" default:"/api/v1"`
-	Listen   string `name:"listen" help:"Listen address for the server" default:"localhost:8080"`
+	Endpoint string   `name:"endpoint" help:"Endpoint for the server" default:"/api/v1"`
+	Listen   string   `name:"listen" help:"Listen address for the server" default:"localhost:8080"`
+	Preload  []string `name:"preload" help:"Models to load when the server starts"`
+	Warmup   bool     `name:"warmup" help:"Transcribe a short silence with each preloaded model"`
+	Jobs     string   `name:"jobs" help:"Path to job store, uses ${WHISPER_JOBS} or a jobs folder in the model store" default:"${WHISPER_JOBS}"`
 }
 
 func (cmd *ServerCmd) Run(ctx *Globals) error {
@@ -15,36 +15,63 @@ import (
 )
 
 type TranscribeCmd struct {
-	Model    string `arg:"" help:"Model to use"`
-	Path     string `arg:"" help:"Path to audio file"`
-	Language string `flag:"language" help:"Language to transcribe" default:"auto"`
-	Format   string `flag:"format" help:"Output format" default:"text" enum:"json,verbose_json,text,vtt,srt"`
+	Model      string        `arg:"" help:"Model to use"`
+	Path       string        `arg:"" help:"Path to audio file"`
+	Language   string        `flag:"language" help:"Language to transcribe" default:"auto"`
+	Format     string        `flag:"format" help:"Output format" default:"text" enum:"json,verbose_json,text,vtt,srt"`
+	Start      time.Duration `flag:"start" help:"Start time of the audio to transcribe"`
+	Duration   time.Duration `flag:"duration" help:"Duration of the audio to transcribe, or zero to transcribe to the end"`
+	Stream     int           `flag:"stream" help:"Index of the audio stream to transcribe, or -1 for the best stream" default:"-1"`
+	StreamLang string        `flag:"stream-language" help:"Language tag of the audio stream to transcribe, such as eng"`
+	Channel    int           `flag:"channel" help:"Channel to transcribe, or -1 to downmix to mono" default:"-1"`
+	Vad        bool          `flag:"vad" help:"Cut audio at silence and skip non-speech"`
+	Overlap    time.Duration `flag:"overlap" help:"Duration of audio repeated between segments, to avoid losing words at segment boundaries"`
+	Speakers   []string      `flag:"speakers" help:"Transcribe each channel separately, labelling the segments with a speaker for each channel"`
+	Words      bool          `flag:"words" help:"Output each word with timestamps and probability, rather than each segment"`
+
+	// Decoding parameters
+	Temperature      *float32 `name:"temperature" help:"Initial decoding temperature, between 0 and 1"`
+	TemperatureInc   *float32 `name:"temperature-inc" help:"Temperature increase when decoding fails, or zero to disable"`
+	BeamSize         *int     `name:"beam-size" help:"Number of beams for beam search, or zero for greedy sampling"`
+	BestOf           *int     `name:"best-of" help:"Number of candidates when sampling with a non-zero temperature"`
+	Patience         *float32 `name:"patience" help:"Beam search patience"`
+	EntropyThreshold *float32 `name:"entropy-thold" help:"Entropy threshold, below which decoding fails"`
+	RatioThreshold   *float32 `name:"compression-ratio-thold" help:"Compression ratio threshold, above which decoding fails, or zero to disable"`
+	LogProbThreshold *float32 `name:"logprob-thold" help:"Average log probability threshold, below which decoding fails"`
+	MaxLen           *int     `name:"max-len" help:"Maximum segment length in characters"`
+	SplitOnWord      *bool    `name:"split-on-word" help:"Split segments on words rather than tokens, with --max-len"`
+	SuppressBlank    *bool    `name:"suppress-blank" help:"Suppress blank output at the start of a segment"`
+	SuppressRegex    *string  `name:"suppress-regex" help:"Suppress tokens which match a regular expression"`
+	Prompt           *string  `name:"prompt" help:"Prompt which provides context, such as names and spellings"`
+	ContextTokens    *int     `name:"context-tokens" help:"Number of tokens carried over between segments, or zero to disable"`
+	MinAvgLogProb    *float32 `name:"min-avg-logprob" help:"Drop segments with an average log probability below this"`
+	Grammar          string   `name:"grammar" help:"Path to a grammar file in GBNF format, which constrains decoding" type:"existingfile"`
+	GrammarPenalty   *float32 `name:"grammar-penalty" help:"Penalty for tokens which do not match the grammar"`
+	Vocabulary       []string `name:"vocabulary" help:"Comma-separated terms, such as names and product codes, which are boosted during decoding"`
 }
 
+const (
+	// Segment size when cutting audio at silence or overlapping segments
+	segmentSize = 30 * time.Second
+
+	// Tolerance when cutting audio at silence, and the length of silence
+	// which is skipped
+	vadTolerance = 5 * time.Second
+	vadSkip      = 2 * time.Second
+)
+
 func (cmd *TranscribeCmd) Run(ctx *Globals) error {
 	// Get the model
 	model := ctx.service.GetModelById(cmd.Model)
 	if model == nil {
 		return ErrNotFound.With(cmd.Model)
 	}
-
-	// Open the audio file
-	f, err := os.Open(cmd.Path)
-	if err != nil {
-		return err
-	}
-	defer f.Close()
-
-	// Create a segmenter - read segments based on requested segment size
-	// TODO
-	segmenter, err := segmenter.NewReader(f, 0, whisper.SampleRate)
-	if err != nil {
-		return err
+	if len(cmd.Speakers) > 0 && cmd.Channel >= 0 {
+		return ErrBadParameter.With("channel cannot be set with speakers")
 	}
-	defer segmenter.Close()
 
 	// Perform the transcription
-	return ctx.service.WithModel(model, func(taskctx *task.Context) error {
+	return ctx.service.WithModel(ctx.ctx, model, func(taskctx *task.Context) error {
 		// Transcribe
 		taskctx.SetTranslate(false)
 		taskctx.SetDiarize(false)
@@ -56,16 +83,125 @@ func (cmd *TranscribeCmd) Run(ctx *Globals) error {
 			}
 		}
 
-		// Read samples and transcribe them
-		if err := segmenter.Decode(ctx.ctx, func(ts time.Duration, buf []float32) error {
-			// Perform the transcription, return any errors
-			return taskctx.Transcribe(ctx.ctx, ts, buf, func(segment *schema.Segment) {
-				ctx.writer.Write(segment)
-			})
+		// Set overlap
+		if err := taskctx.SetOverlap(cmd.Overlap); err != nil {
+			return err
+		}
+
+		// Read the grammar
+		var grammar *string
+		if cmd.Grammar != "" {
+			if data, err := os.ReadFile(cmd.Grammar); err != nil {
+				return err
+			} else {
+				v := string(data)
+				grammar = &v
+			}
+		}
+
+		// Set decoding parameters
+		if err := taskctx.SetParams(task.Params{
+			Temperature:      cmd.Temperature,
+			TemperatureInc:   cmd.TemperatureInc,
+			BeamSize:         cmd.BeamSize,
+			BestOf:           cmd.BestOf,
+			Patience:         cmd.Patience,
+			EntropyThreshold: cmd.EntropyThreshold,
+			RatioThreshold:   cmd.RatioThreshold,
+			LogProbThreshold: cmd.LogProbThreshold,
+			MaxLen:           cmd.MaxLen,
+			SplitOnWord:      cmd.SplitOnWord,
+			SuppressBlank:    cmd.SuppressBlank,
+			SuppressRegex:    cmd.SuppressRegex,
+			Prompt:           cmd.Prompt,
+			ContextTokens:    cmd.ContextTokens,
+			MinAvgLogProb:    cmd.MinAvgLogProb,
+			Grammar:          grammar,
+			GrammarPenalty:   cmd.GrammarPenalty,
+			Vocabulary:       cmd.Vocabulary,
 		}); err != nil {
 			return err
 		}
+		taskctx.SetWordTimestamps(cmd.Words)
+
+		// Read samples and transcribe them
+		write := func(segment *schema.Segment) {
+			if cmd.Words {
+				ctx.writer.Write(segment.Words)
+			} else {
+				ctx.writer.Write(segment)
+			}
+		}
+		if len(cmd.Speakers) == 0 {
+			return cmd.transcribe(ctx, taskctx, cmd.Channel, write)
+		}
+
+		// Transcribe each channel separately, then interleave the segments
+		for channel, speaker := range cmd.Speakers {
+			taskctx.SetSpeaker(speaker)
+			if err := cmd.transcribe(ctx, taskctx, channel, func(*schema.Segment) {}); err != nil {
+				return err
+			}
+		}
+		taskctx.Interleave()
+		for _, segment := range taskctx.Result().Segments {
+			write(segment)
+		}
 
 		return nil
 	})
 }
+
+// Read samples from a channel of the audio file, or all channels if the
+// channel is -1, and transcribe them
+func (cmd *TranscribeCmd) transcribe(ctx *Globals, taskctx *task.Context, channel int, fn task.NewSegmentFunc) error {
+	// Open the audio file
+	f, err := os.Open(cmd.Path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	// Create a segmenter - read segments based on requested segment size
+	var opts []segmenter.Opt
+	var dur time.Duration
+	if cmd.Start > 0 || cmd.Duration > 0 {
+		opts = append(opts, segmenter.OptRange(cmd.Start, cmd.Duration))
+	}
+	if cmd.Stream >= 0 {
+		opts = append(opts, segmenter.OptStream(cmd.Stream))
+	}
+	if cmd.StreamLang != "" {
+		opts = append(opts, segmenter.OptStreamLanguage(cmd.StreamLang))
+	}
+	if channel >= 0 {
+		opts = append(opts, segmenter.OptChannel(channel))
+	}
+	if cmd.Vad {
+		dur = segmentSize
+		opts = append(opts, segmenter.OptVAD(vadTolerance, vadSkip))
+	}
+	if cmd.Overlap > 0 {
+		dur = segmentSize
+		opts = append(opts, segmenter.OptOverlap(cmd.Overlap))
+	}
+	segmenter, err := segmenter.NewReader(f, dur, whisper.SampleRate, opts...)
+	if err != nil {
+		return err
+	}
+	defer segmenter.Close()
+
+	// Read samples and transcribe them
+	if err := segmenter.Decode(ctx.ctx, func(ts time.Duration, buf []float32) error {
+		// Perform the transcription, return any errors
+		return taskctx.Transcribe(ctx.ctx, ts, buf, fn)
+	}); err != nil {
+		return err
+	}
+
+	// Output any held back segments
+	taskctx.Flush(fn)
+
+	// Return success
+	return nil
+}
@@ -0,0 +1,196 @@
+package whisper
+
+import (
+	"context"
+	"errors"
+	"io"
+	"os"
+	"time"
+
+	// Packages
+	job "github.com/mutablelogic/go-whisper/pkg/job"
+	pool "github.com/mutablelogic/go-whisper/pkg/pool"
+	schema "github.com/mutablelogic/go-whisper/pkg/schema"
+	segmenter "github.com/mutablelogic/go-whisper/pkg/segmenter"
+	task "github.com/mutablelogic/go-whisper/pkg/task"
+	whisper "github.com/mutablelogic/go-whisper/sys/whisper"
+
+	// Namespace imports
+	. "github.com/djthorpe/go-errors"
+)
+
+//////////////////////////////////////////////////////////////////////////////
+// GLOBALS
+
+const (
+	TaskTranscribe = "transcribe"
+	TaskTranslate  = "translate"
+	TaskDiarize    = "diarize"
+)
+
+const (
+	// Segment size for reading media in a job
+	jobSegmentSize = 5 * time.Minute
+
+	// Priority for getting a context from the pool
+	jobPriority = -1
+)
+
+//////////////////////////////////////////////////////////////////////////////
+// PUBLIC METHODS
+
+// Submit a job to transcribe, translate or diarize media with a model.
+// The media is copied from the reader before the job is queued, and the
+// job is returned immediately. Set language to empty to detect the
+// language of the media
+func (w *Whisper) SubmitJob(model *schema.Model, t, language string, r io.Reader) (*schema.Job, error) {
+	if model == nil || r == nil {
+		return nil, ErrBadParameter
+	}
+
+	// Check the task and language
+	switch t {
+	case TaskTranscribe, TaskTranslate, TaskDiarize:
+		break
+	default:
+		return nil, ErrBadParameter.Withf("invalid task: %q", t)
+	}
+	if language != "" && language != "auto" && whisper.Whisper_lang_id(language) == -1 {
+		return nil, ErrBadParameter.Withf("invalid language: %q", language)
+	}
+
+	// Copy the media, which is removed by the queue when the job is done
+	f, err := os.CreateTemp(w.jobpath, "whisper-job-*")
+	if err != nil {
+		return nil, err
+	}
+	if _, err := io.Copy(f, r); err != nil {
+		return nil, errors.Join(err, f.Close(), os.Remove(f.Name()))
+	}
+	if err := f.Close(); err != nil {
+		return nil, errors.Join(err, os.Remove(f.Name()))
+	}
+
+	// Queue the job
+	job, err := w.jobs.Add(f.Name(), model.Id, t, language)
+	if err != nil {
+		return nil, errors.Join(err, os.Remove(f.Name()))
+	}
+
+	// Return the job
+	return job.Schema(), nil
+}
+
+// Return all jobs
+func (w *Whisper) ListJobs() []*schema.Job {
+	jobs := w.jobs.List()
+	result := make([]*schema.Job, 0, len(jobs))
+	for _, job := range jobs {
+		result = append(result, job.Schema())
+	}
+	return result
+}
+
+// Get a job by its id, including the result when the job has completed
+func (w *Whisper) GetJobById(id string) *schema.Job {
+	job := w.jobs.Get(id)
+	if job == nil {
+		return nil
+	}
+	return job.Schema()
+}
+
+// Cancel a queued or running job by its id. If the job is already done,
+// then it is removed
+func (w *Whisper) CancelJobById(id string) (*schema.Job, error) {
+	job, err := w.jobs.Cancel(id)
+	if err != nil {
+		return nil, err
+	}
+	return job.Schema(), nil
+}
+
+//////////////////////////////////////////////////////////////////////////////
+// PRIVATE METHODS
+
+// Run a job. Jobs wait for a context with a lower priority than other
+// requests, so that they don't hold up interactive requests
+func (w *Whisper) runJob(ctx context.Context, job *job.Job) (*schema.Transcription, error) {
+	// Get the model
+	model := w.store.ById(job.Model())
+	if model == nil {
+		return nil, ErrNotFound.Withf("model %q", job.Model())
+	}
+
+	// Open the media
+	f, err := os.Open(job.Path())
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	// Create a segmenter
+	segmenter, err := segmenter.NewReader(f, jobSegmentSize, SampleRate)
+	if err != nil {
+		return nil, err
+	}
+	defer segmenter.Close()
+
+	// Perform the transcription
+	var result *schema.Transcription
+	if err := w.WithModel(pool.WithPriority(ctx, jobPriority), model, func(taskctx *task.Context) error {
+		result = taskctx.Result()
+		result.Task = job.Task()
+
+		switch job.Task() {
+		case TaskTranslate:
+			if !taskctx.CanTranslate() {
+				return ErrBadParameter.With("model is not multilingual, cannot translate")
+			}
+			taskctx.SetTranslate(true)
+			taskctx.SetDiarize(false)
+			if err := taskctx.SetLanguage("en"); err != nil {
+				return err
+			}
+		case TaskDiarize:
+			taskctx.SetTranslate(false)
+			taskctx.SetDiarize(true)
+			if err := taskctx.SetLanguage(job.Language()); err != nil {
+				return err
+			}
+		default:
+			taskctx.SetTranslate(false)
+			taskctx.SetDiarize(false)
+			if err := taskctx.SetLanguage(job.Language()); err != nil {
+				return err
+			}
+		}
+
+		// Read samples and transcribe them, updating progress after each segment
+		duration := segmenter.Duration()
+		if err := segmenter.Decode(ctx, func(ts time.Duration, buf []float32) error {
+			if err := taskctx.Transcribe(ctx, ts, buf, func(*schema.Segment) {}); err != nil {
+				return err
+			}
+			if duration > 0 {
+				ts += time.Duration(len(buf)) * time.Second / SampleRate
+				job.SetProgress(ts.Seconds() / duration.Seconds())
+			}
+			return nil
+		}); err != nil {
+			return err
+		}
+
+		// Set the language and duration
+		result.Language = taskctx.Language()
+		result.Duration = schema.Timestamp(duration)
+
+		// Return success
+		return nil
+	}); err != nil {
+		return nil, err
+	}
+
+	// Return the transcription
+	return result, nil
+}
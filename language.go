@@ -0,0 +1,64 @@
+package whisper
+
+import (
+	"context"
+	"io"
+	"time"
+
+	// Packages
+	schema "github.com/mutablelogic/go-whisper/pkg/schema"
+	segmenter "github.com/mutablelogic/go-whisper/pkg/segmenter"
+	task "github.com/mutablelogic/go-whisper/pkg/task"
+
+	// Namespace imports
+	. "github.com/djthorpe/go-errors"
+)
+
+//////////////////////////////////////////////////////////////////////////////
+// GLOBALS
+
+const (
+	// Language detection uses no more than thirty seconds of audio
+	maxDetectDuration = 30 * time.Second
+)
+
+//////////////////////////////////////////////////////////////////////////////
+// PUBLIC METHODS
+
+// Detect the language of the media from the first duration of audio, or the
+// first thirty seconds if the duration is zero. Returns the languages ordered
+// by probability, most probable first
+func (w *Whisper) DetectLanguage(ctx context.Context, model *schema.Model, r io.Reader, duration time.Duration) ([]*schema.Language, error) {
+	if duration < 0 {
+		return nil, ErrBadParameter.With("invalid duration")
+	} else if duration == 0 || duration > maxDetectDuration {
+		duration = maxDetectDuration
+	}
+
+	// Decode the samples
+	segmenter, err := segmenter.NewReader(r, duration, SampleRate, segmenter.OptRange(0, duration))
+	if err != nil {
+		return nil, err
+	}
+	defer segmenter.Close()
+
+	var samples []float32
+	if err := segmenter.Decode(ctx, func(_ time.Duration, buf []float32) error {
+		samples = append(samples, buf...)
+		return nil
+	}); err != nil {
+		return nil, err
+	}
+
+	// Detect the language
+	var result []*schema.Language
+	if err := w.WithModel(ctx, model, func(task *task.Context) error {
+		result, err = task.DetectLanguage(ctx, samples)
+		return err
+	}); err != nil {
+		return nil, err
+	}
+
+	// Return success
+	return result, nil
+}
@@ -1,6 +1,8 @@
 package whisper
 
 import (
+	"time"
+
 	// Namespace imports
 	. "github.com/djthorpe/go-errors"
 )
@@ -10,6 +12,12 @@ import (
 
 type opts struct {
 	MaxConcurrent int
+	MemoryLimit   uint64
+	IdleTimeout   time.Duration
+	JobWorkers    int
+	jobpath       string
+	preload       []string
+	warmup        bool
 	logfn         LogFn
 	debug         bool
 	gpu           int
@@ -32,6 +40,76 @@ func OptMaxConcurrent(v int) Opt {
 	}
 }
 
+// Set the memory limit for loaded models in bytes. The memory used by each
+// model is estimated, and idle models are unloaded to stay within the limit.
+// Requests for a model which cannot be loaded within the limit fail
+func OptMemoryLimit(v uint64) Opt {
+	return func(o *opts) error {
+		if v == 0 {
+			return ErrBadParameter.With("memory limit must be greater than zero")
+		}
+		o.MemoryLimit = v
+		return nil
+	}
+}
+
+// Unload models which have been idle for longer than the timeout
+func OptIdleTimeout(v time.Duration) Opt {
+	return func(o *opts) error {
+		if v <= 0 {
+			return ErrBadParameter.With("idle timeout must be greater than zero")
+		}
+		o.IdleTimeout = v
+		return nil
+	}
+}
+
+// Set the number of jobs which are run concurrently in the background
+func OptJobWorkers(v int) Opt {
+	return func(o *opts) error {
+		if v < 1 {
+			return ErrBadParameter.With("job workers must be greater than zero")
+		}
+		o.JobWorkers = v
+		return nil
+	}
+}
+
+// Persist jobs and their media in a directory, so that jobs are restored
+// when the service is restarted. The directory must exist
+func OptJobStore(path string) Opt {
+	return func(o *opts) error {
+		if path == "" {
+			return ErrBadParameter.With("job store path is empty")
+		}
+		o.jobpath = path
+		return nil
+	}
+}
+
+// Preload models into the pool when the service is created, so that the
+// first request for each model does not wait for the model to be loaded
+func OptPreload(ids ...string) Opt {
+	return func(o *opts) error {
+		for _, id := range ids {
+			if id == "" {
+				return ErrBadParameter.With("preload model id is empty")
+			}
+		}
+		o.preload = append(o.preload, ids...)
+		return nil
+	}
+}
+
+// Transcribe a short silence with each preloaded model, to warm up
+// the model
+func OptWarmup() Opt {
+	return func(o *opts) error {
+		o.warmup = true
+		return nil
+	}
+}
+
 // Set logging function
 func OptLog(fn LogFn) Opt {
 	return func(o *opts) error {
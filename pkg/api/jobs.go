@@ -0,0 +1,139 @@
+package api
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"mime/multipart"
+	"net/http"
+
+	// Packages
+	"github.com/mutablelogic/go-server/pkg/httprequest"
+	"github.com/mutablelogic/go-server/pkg/httpresponse"
+	"github.com/mutablelogic/go-whisper"
+	"github.com/mutablelogic/go-whisper/pkg/schema"
+
+	// Namespace imports
+	. "github.com/djthorpe/go-errors"
+)
+
+///////////////////////////////////////////////////////////////////////////////
+// TYPES
+
+type reqCreateJob struct {
+	File     *multipart.FileHeader `json:"file"`
+	Model    string                `json:"model"`
+	Task     *string               `json:"task"`
+	Language *string               `json:"language"`
+}
+
+type respJobs struct {
+	Object string        `json:"object,omitempty"`
+	Jobs   []*schema.Job `json:"jobs"`
+}
+
+///////////////////////////////////////////////////////////////////////////////
+// PUBLIC METHODS
+
+func ListJobs(ctx context.Context, w http.ResponseWriter, service *whisper.Whisper) {
+	httpresponse.JSON(w, respJobs{
+		Object: "list",
+		Jobs:   service.ListJobs(),
+	}, http.StatusOK, 2)
+}
+
+func CreateJob(ctx context.Context, w http.ResponseWriter, r *http.Request, service *whisper.Whisper) {
+	var req reqCreateJob
+	if err := httprequest.Body(&req, r); err != nil {
+		httpresponse.Error(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	// Validate the request
+	if err := req.Validate(); err != nil {
+		httpresponse.Error(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	// Get the model
+	model := service.GetModelById(req.Model)
+	if model == nil {
+		httpresponse.Error(w, http.StatusNotFound, "model not found")
+		return
+	}
+
+	// Open file
+	f, err := req.File.Open()
+	if err != nil {
+		httpresponse.Error(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	defer f.Close()
+
+	// Submit the job
+	job, err := service.SubmitJob(model, req.TaskName(), req.LanguageName(), f)
+	if errors.Is(err, ErrBadParameter) {
+		httpresponse.Error(w, http.StatusBadRequest, err.Error())
+		return
+	} else if err != nil {
+		httpresponse.Error(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	// Return the job
+	httpresponse.JSON(w, job, http.StatusAccepted, 2)
+}
+
+func GetJobById(ctx context.Context, w http.ResponseWriter, service *whisper.Whisper, id string) {
+	job := service.GetJobById(id)
+	if job == nil {
+		httpresponse.Error(w, http.StatusNotFound)
+		return
+	}
+	httpresponse.JSON(w, job, http.StatusOK, 2)
+}
+
+func CancelJobById(ctx context.Context, w http.ResponseWriter, service *whisper.Whisper, id string) {
+	job, err := service.CancelJobById(id)
+	if errors.Is(err, ErrNotFound) {
+		httpresponse.Error(w, http.StatusNotFound)
+		return
+	} else if err != nil {
+		httpresponse.Error(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	httpresponse.JSON(w, job, http.StatusOK, 2)
+}
+
+///////////////////////////////////////////////////////////////////////////////
+// PRIVATE METHODS
+
+func (r reqCreateJob) Validate() error {
+	if r.Model == "" {
+		return fmt.Errorf("model is required")
+	}
+	if r.File == nil {
+		return fmt.Errorf("file is required")
+	}
+	switch r.TaskName() {
+	case whisper.TaskTranscribe, whisper.TaskTranslate, whisper.TaskDiarize:
+		break
+	default:
+		return fmt.Errorf("task must be one of: %s, %s, %s", whisper.TaskTranscribe, whisper.TaskTranslate, whisper.TaskDiarize)
+	}
+	return nil
+}
+
+func (r reqCreateJob) TaskName() string {
+	if r.Task == nil || *r.Task == "" {
+		return whisper.TaskTranscribe
+	}
+	return *r.Task
+}
+
+func (r reqCreateJob) LanguageName() string {
+	if r.Language == nil {
+		return ""
+	}
+	return *r.Language
+}
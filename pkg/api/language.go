@@ -0,0 +1,102 @@
+package api
+
+import (
+	"context"
+	"fmt"
+	"mime/multipart"
+	"net/http"
+	"time"
+
+	// Packages
+	"github.com/mutablelogic/go-server/pkg/httprequest"
+	"github.com/mutablelogic/go-server/pkg/httpresponse"
+	"github.com/mutablelogic/go-whisper"
+	"github.com/mutablelogic/go-whisper/pkg/schema"
+)
+
+///////////////////////////////////////////////////////////////////////////////
+// TYPES
+
+type reqDetectLanguage struct {
+	File     *multipart.FileHeader `json:"file"`
+	Model    string                `json:"model"`
+	Duration *time.Duration        `json:"duration"`
+}
+
+type respDetectLanguage struct {
+	Language  string             `json:"language"`
+	Languages []*schema.Language `json:"languages"`
+}
+
+///////////////////////////////////////////////////////////////////////////////
+// PUBLIC METHODS
+
+// DetectLanguage returns the languages of the uploaded media, ranked by
+// probability, from the first duration of audio
+func DetectLanguage(ctx context.Context, service *whisper.Whisper, w http.ResponseWriter, r *http.Request) {
+	var req reqDetectLanguage
+	if err := httprequest.Body(&req, r); err != nil {
+		httpresponse.Error(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	// Validate the request
+	if err := req.Validate(); err != nil {
+		httpresponse.Error(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	// Get the model
+	model := service.GetModelById(req.Model)
+	if model == nil {
+		httpresponse.Error(w, http.StatusNotFound, "model not found")
+		return
+	}
+
+	// Open file
+	f, err := req.File.Open()
+	if err != nil {
+		httpresponse.Error(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	defer f.Close()
+
+	// Detect the language
+	languages, err := service.DetectLanguage(ctx, model, f, req.DurationValue())
+	if err != nil {
+		errorResponse(w, err)
+		return
+	}
+
+	// Return the most probable language, and all the languages
+	response := respDetectLanguage{Languages: languages}
+	if len(languages) > 0 {
+		response.Language = languages[0].Language
+	}
+	httpresponse.JSON(w, response, http.StatusOK, 2)
+}
+
+///////////////////////////////////////////////////////////////////////////////
+// PRIVATE METHODS
+
+func (r reqDetectLanguage) Validate() error {
+	if r.Model == "" {
+		return fmt.Errorf("model is required")
+	}
+	if r.File == nil {
+		return fmt.Errorf("file is required")
+	}
+	if r.Duration != nil && *r.Duration < 0 {
+		return fmt.Errorf("duration cannot be negative")
+	}
+	return nil
+}
+
+// Return the duration of audio to detect the language from, or zero
+// for the default
+func (r reqDetectLanguage) DurationValue() time.Duration {
+	if r.Duration == nil {
+		return 0
+	}
+	return *r.Duration
+}
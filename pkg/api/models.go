@@ -121,7 +121,7 @@ func DeleteModelById(ctx context.Context, w http.ResponseWriter, service *whispe
 		return
 	}
 	if err := service.DeleteModelById(model.Id); err != nil {
-		httpresponse.Error(w, http.StatusInternalServerError, err.Error())
+		errorResponse(w, err)
 		return
 	}
 	httpresponse.Empty(w, http.StatusOK)
@@ -1,12 +1,28 @@
 package api
 
 import (
+	"errors"
 	"net/http"
 	"path/filepath"
+	"strconv"
+	"time"
 
 	// Packages
 	"github.com/mutablelogic/go-server/pkg/httpresponse"
 	"github.com/mutablelogic/go-whisper"
+	"github.com/mutablelogic/go-whisper/pkg/pool"
+
+	// Namespace imports
+	. "github.com/djthorpe/go-errors"
+)
+
+/////////////////////////////////////////////////////////////////////////////
+// GLOBALS
+
+const (
+	// The time after which a request can be retried when the service is
+	// temporarily unavailable
+	retryAfter = 10 * time.Second
 )
 
 /////////////////////////////////////////////////////////////////////////////
@@ -19,13 +35,17 @@ func RegisterEndpoints(base string, whisper *whisper.Whisper, mux *http.ServeMux
 	}
 
 	// Health: GET /v1/health
-	//   returns an empty OK response
+	//   returns an empty OK response, or service unavailable while models are preloaded
 	mux.HandleFunc(joinPath(base, "health"), func(w http.ResponseWriter, r *http.Request) {
 		defer r.Body.Close()
 
 		switch r.Method {
 		case http.MethodGet:
-			httpresponse.Empty(w, http.StatusOK)
+			if whisper.Ready() {
+				httpresponse.Empty(w, http.StatusOK)
+			} else {
+				httpresponse.Error(w, http.StatusServiceUnavailable, "preloading models")
+			}
 		default:
 			httpresponse.Error(w, http.StatusMethodNotAllowed)
 		}
@@ -52,7 +72,7 @@ func RegisterEndpoints(base string, whisper *whisper.Whisper, mux *http.ServeMux
 	// Get: GET /v1/models/{id}
 	//   returns an existing model
 	// Delete: DELETE /v1/models/{id}
-	//   deletes an existing model
+	//   deletes an existing model, once any requests using the model are done
 	mux.HandleFunc(joinPath(base, "models/{id}"), func(w http.ResponseWriter, r *http.Request) {
 		defer r.Body.Close()
 
@@ -109,20 +129,110 @@ func RegisterEndpoints(base string, whisper *whisper.Whisper, mux *http.ServeMux
 		}
 	})
 
+	// Detect Language: POST /v1/audio/language
+	//   Returns the languages of the audio ranked by probability, from the
+	//   first thirty seconds or the duration parameter
+	mux.HandleFunc(joinPath(base, "audio/language"), func(w http.ResponseWriter, r *http.Request) {
+		defer r.Body.Close()
+
+		switch r.Method {
+		case http.MethodPost:
+			DetectLanguage(r.Context(), whisper, w, r)
+		default:
+			httpresponse.Error(w, http.StatusMethodNotAllowed)
+		}
+	})
+
 	// Transcribe: POST /v1/audio/transcriptions/{model-id}
-	//   Transcribes streamed media into the input language
-	/*
-		mux.HandleFunc(joinPath(base, "audio/transcriptions/{model}"), func(w http.ResponseWriter, r *http.Request) {
-			defer r.Body.Close()
-
-			model := r.PathValue("model")
-			switch r.Method {
-			case http.MethodPost:
-				TranscribeStream(r.Context(), whisper, w, r, model)
-			default:
-				httpresponse.Error(w, http.StatusMethodNotAllowed)
-			}
-		})*/
+	//   Transcribes streamed media into the input language. The request body
+	//   is the raw media, which is decoded as it arrives
+	mux.HandleFunc(joinPath(base, "audio/transcriptions/{model}"), func(w http.ResponseWriter, r *http.Request) {
+		defer r.Body.Close()
+
+		model := r.PathValue("model")
+		switch r.Method {
+		case http.MethodPost:
+			TranscribeStream(r.Context(), whisper, w, r, model)
+		default:
+			httpresponse.Error(w, http.StatusMethodNotAllowed)
+		}
+	})
+
+	// Realtime: GET /v1/audio/realtime/{model-id}
+	//   Upgrades to a websocket, and transcribes audio frames as they are sent
+	//   by the client, returning partial and final segments
+	mux.HandleFunc(joinPath(base, "audio/realtime/{model}"), func(w http.ResponseWriter, r *http.Request) {
+		defer r.Body.Close()
+
+		model := r.PathValue("model")
+		switch r.Method {
+		case http.MethodGet:
+			TranscribeSession(r.Context(), whisper, w, r, model)
+		default:
+			httpresponse.Error(w, http.StatusMethodNotAllowed)
+		}
+	})
+
+	// Tokenize: POST /v1/tokenize
+	//   Converts text into the tokens of a model
+	mux.HandleFunc(joinPath(base, "tokenize"), func(w http.ResponseWriter, r *http.Request) {
+		defer r.Body.Close()
+
+		switch r.Method {
+		case http.MethodPost:
+			Tokenize(r.Context(), whisper, w, r)
+		default:
+			httpresponse.Error(w, http.StatusMethodNotAllowed)
+		}
+	})
+
+	// Detokenize: POST /v1/detokenize
+	//   Converts the tokens of a model into text
+	mux.HandleFunc(joinPath(base, "detokenize"), func(w http.ResponseWriter, r *http.Request) {
+		defer r.Body.Close()
+
+		switch r.Method {
+		case http.MethodPost:
+			Detokenize(r.Context(), whisper, w, r)
+		default:
+			httpresponse.Error(w, http.StatusMethodNotAllowed)
+		}
+	})
+
+	// List Jobs: GET /v1/jobs
+	//   returns all jobs
+	// Create Job: POST /v1/jobs
+	//   queues a job to transcribe, translate or diarize audio, and returns immediately
+	mux.HandleFunc(joinPath(base, "jobs"), func(w http.ResponseWriter, r *http.Request) {
+		defer r.Body.Close()
+
+		switch r.Method {
+		case http.MethodGet:
+			ListJobs(r.Context(), w, whisper)
+		case http.MethodPost:
+			CreateJob(r.Context(), w, r, whisper)
+		default:
+			httpresponse.Error(w, http.StatusMethodNotAllowed)
+		}
+	})
+
+	// Get: GET /v1/jobs/{id}
+	//   returns the status of a job, and the transcription when completed
+	// Cancel: DELETE /v1/jobs/{id}
+	//   cancels a queued or running job, or removes a job which is done
+	mux.HandleFunc(joinPath(base, "jobs/{id}"), func(w http.ResponseWriter, r *http.Request) {
+		defer r.Body.Close()
+
+		id := r.PathValue("id")
+		switch r.Method {
+		case http.MethodGet:
+			GetJobById(r.Context(), w, whisper, id)
+		case http.MethodDelete:
+			CancelJobById(r.Context(), w, whisper, id)
+		default:
+			httpresponse.Error(w, http.StatusMethodNotAllowed)
+		}
+	})
 
 	// Return mux
 	return mux
@@ -134,3 +244,31 @@ func RegisterEndpoints(base string, whisper *whisper.Whisper, mux *http.ServeMux
 func joinPath(base, rel string) string {
 	return filepath.Join(base, rel)
 }
+
+// Write an error response, with a Retry-After header when the service
+// is temporarily unavailable
+func errorResponse(w http.ResponseWriter, err error) {
+	status := errorStatus(err)
+	if status == http.StatusServiceUnavailable {
+		w.Header().Set("Retry-After", strconv.Itoa(int(retryAfter/time.Second)))
+	}
+	httpresponse.Error(w, status, err.Error())
+}
+
+// Return the HTTP status code for an error
+func errorStatus(err error) int {
+	switch {
+	case errors.Is(err, ErrNotFound):
+		return http.StatusNotFound
+	case errors.Is(err, ErrBadParameter):
+		return http.StatusBadRequest
+	case errors.Is(err, pool.ErrMemoryLimit):
+		return http.StatusInsufficientStorage
+	case errors.Is(err, pool.ErrClosed), errors.Is(err, pool.ErrDraining):
+		return http.StatusServiceUnavailable
+	case errors.Is(err, ErrChannelBlocked):
+		return http.StatusConflict
+	default:
+		return http.StatusInternalServerError
+	}
+}
@@ -0,0 +1,418 @@
+package api
+
+import (
+	"context"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	// Packages
+	"github.com/mutablelogic/go-server/pkg/httprequest"
+	"github.com/mutablelogic/go-server/pkg/httpresponse"
+	"github.com/mutablelogic/go-whisper"
+	"github.com/mutablelogic/go-whisper/pkg/schema"
+	"github.com/mutablelogic/go-whisper/pkg/segmenter"
+	"github.com/mutablelogic/go-whisper/pkg/task"
+	"github.com/mutablelogic/go-whisper/pkg/websocket"
+)
+
+///////////////////////////////////////////////////////////////////////////////
+// TYPES
+
+type querySession struct {
+	Language *string        `json:"language"`
+	Format   *string        `json:"format"`
+	Step     *time.Duration `json:"step"`
+	Length   *time.Duration `json:"length"`
+}
+
+// Message from the client
+type reqSession struct {
+	Type string `json:"type"`
+}
+
+// Message to the client
+type respSession struct {
+	Type    string                `json:"type"`
+	Segment *schema.Segment       `json:"segment,omitempty"`
+	Result  *schema.Transcription `json:"result,omitempty"`
+	Error   string                `json:"error,omitempty"`
+}
+
+type SampleFormat string
+
+///////////////////////////////////////////////////////////////////////////////
+// GLOBALS
+
+const (
+	FormatEncoded SampleFormat = ""          // Encoded audio, format is auto-detected
+	FormatS16     SampleFormat = "pcm_s16le" // Signed 16-bit little-endian mono PCM at 16KHz
+	FormatF32     SampleFormat = "pcm_f32le" // Float 32-bit little-endian mono PCM at 16KHz
+)
+
+const (
+	minSessionStep     = 500 * time.Millisecond
+	maxSessionStep     = 10 * time.Second
+	defaultSessionStep = 2 * time.Second
+
+	maxSessionLength     = 30 * time.Second
+	defaultSessionLength = 10 * time.Second
+
+	// Whisper ignores audio shorter than a second, so shorter audio is
+	// padded with silence up to this duration
+	minSessionAudio = 1100 * time.Millisecond
+
+	// Size of the segments when decoding encoded audio
+	sessionChunkSize = 250 * time.Millisecond
+)
+
+///////////////////////////////////////////////////////////////////////////////
+// PUBLIC METHODS
+
+// TranscribeSession upgrades the request to a websocket, and transcribes audio
+// frames sent by the client in realtime. Partial segments are returned as the
+// audio arrives, and a final segment is returned for each window of audio.
+// The session holds a single context for its lifetime.
+func TranscribeSession(ctx context.Context, service *whisper.Whisper, w http.ResponseWriter, r *http.Request, modelId string) {
+	var query querySession
+	if err := httprequest.Query(&query, r.URL.Query()); err != nil {
+		httpresponse.Error(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	// Validate the request
+	if err := query.Validate(); err != nil {
+		httpresponse.Error(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	// Get the model
+	model := service.GetModelById(modelId)
+	if model == nil {
+		httpresponse.Error(w, http.StatusNotFound, "model not found")
+		return
+	}
+
+	// Upgrade the connection, which responds to the client on error
+	conn, err := websocket.Upgrade(w, r)
+	if err != nil {
+		return
+	}
+	defer conn.Close()
+
+	// Cancel reading when the session ends
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	// Read samples from the connection in the background
+	var readErr error
+	samples := make(chan []float32)
+	go func() {
+		defer close(samples)
+		readErr = readSession(ctx, conn, query.SampleFormat(), samples)
+	}()
+
+	// Get context for the model, and transcribe until the client ends the session
+	var result *schema.Transcription
+	if err := service.WithModel(ctx, model, func(taskctx *task.Context) error {
+		taskctx.SetTranslate(false)
+		taskctx.SetDiarize(false)
+		taskctx.SetSingleSegment(true)
+		if query.Language != nil {
+			if err := taskctx.SetLanguage(*query.Language); err != nil {
+				return err
+			}
+		}
+
+		// Output the header
+		result = taskctx.Result()
+		result.Task = "transcribe"
+		result.Language = taskctx.Language()
+		if err := conn.WriteJSON(respSession{Type: "session", Result: result}); err != nil {
+			return err
+		}
+
+		// Run the session
+		if err := runSession(ctx, conn, taskctx, samples, query.StepDur(), query.LengthDur()); err != nil {
+			return err
+		}
+
+		// Return any read error
+		if readErr != nil {
+			return readErr
+		}
+
+		// Return the complete transcription
+		return conn.WriteJSON(respSession{Type: "done", Result: result})
+	}); err != nil {
+		// Report the error, and close the session with an error status
+		conn.WriteJSON(respSession{Type: "error", Error: err.Error()})
+		conn.CloseWithStatus(websocket.CloseInternalError)
+	}
+}
+
+///////////////////////////////////////////////////////////////////////////////
+// PRIVATE METHODS
+
+func (r querySession) Validate() error {
+	if r.Format != nil {
+		switch SampleFormat(strings.ToLower(*r.Format)) {
+		case FormatEncoded, FormatS16, FormatF32:
+			break
+		default:
+			return fmt.Errorf("format must be one of: %s, %s", FormatS16, FormatF32)
+		}
+	}
+	if r.Step != nil && r.Length != nil && *r.Length < *r.Step {
+		return fmt.Errorf("length must be greater than step")
+	}
+	return nil
+}
+
+func (r querySession) SampleFormat() SampleFormat {
+	if r.Format == nil {
+		return FormatEncoded
+	}
+	return SampleFormat(strings.ToLower(*r.Format))
+}
+
+func (r querySession) StepDur() time.Duration {
+	if r.Step == nil {
+		return defaultSessionStep
+	}
+	return min(max(*r.Step, minSessionStep), maxSessionStep)
+}
+
+func (r querySession) LengthDur() time.Duration {
+	if r.Length == nil {
+		return max(defaultSessionLength, r.StepDur())
+	}
+	return min(max(*r.Length, r.StepDur()), maxSessionLength)
+}
+
+// Transcribe samples as they arrive. A partial segment is output every step,
+// and the window of audio is finalized when it reaches the maximum length, or
+// the samples channel is closed. The tokens of the final segments are carried
+// forward as the prompt for the next window.
+func runSession(ctx context.Context, conn *websocket.Conn, taskctx *task.Context, samples <-chan []float32, step, length time.Duration) error {
+	var window []float32
+	var ts time.Duration
+	var pending int
+
+	// Number of samples for each step and window
+	nstep := int(step.Seconds() * whisper.SampleRate)
+	nlength := int(length.Seconds() * whisper.SampleRate)
+
+	for {
+		// Wait for samples, then take any others which have arrived so that
+		// we don't fall behind the client
+		eof := false
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case buf, ok := <-samples:
+			if !ok {
+				eof = true
+			}
+			window, pending = append(window, buf...), pending+len(buf)
+		}
+	drain:
+		for !eof {
+			select {
+			case buf, ok := <-samples:
+				if !ok {
+					eof = true
+				}
+				window, pending = append(window, buf...), pending+len(buf)
+			default:
+				break drain
+			}
+		}
+
+		switch {
+		case eof || len(window) >= nlength:
+			// Output the final segments. Transcription is cancelled when a
+			// segment cannot be written, and the write error is returned
+			if err := transcribeWindow(ctx, conn, taskctx, ts, padSamples(window)); err != nil {
+				return err
+			}
+
+			// Advance the window
+			ts += time.Duration(len(window)) * time.Second / whisper.SampleRate
+			window, pending = window[:0], 0
+		case pending >= nstep:
+			// Output partial segments
+			segments, err := taskctx.Preview(ctx, ts, padSamples(window))
+			if err != nil {
+				return err
+			}
+			for _, segment := range segments {
+				if err := conn.WriteJSON(respSession{Type: "partial", Segment: segment}); err != nil {
+					return err
+				}
+			}
+			pending = 0
+		}
+
+		// End of the session
+		if eof {
+			return nil
+		}
+	}
+}
+
+// Transcribe a window of samples, and write the final segments. The
+// transcription is cancelled on the first error writing a segment, which
+// is returned
+func transcribeWindow(ctx context.Context, conn *websocket.Conn, taskctx *task.Context, ts time.Duration, samples []float32) error {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	var result error
+	err := taskctx.Transcribe(ctx, ts, samples, func(segment *schema.Segment) {
+		if result != nil {
+			return
+		}
+		if result = conn.WriteJSON(respSession{Type: "final", Segment: segment}); result != nil {
+			cancel()
+		}
+	})
+	if result != nil {
+		return result
+	}
+	return err
+}
+
+// Read messages from the client, and send samples to the channel until the
+// client ends the session or closes the connection
+func readSession(ctx context.Context, conn *websocket.Conn, format SampleFormat, samples chan<- []float32) error {
+	send := func(buf []float32) error {
+		select {
+		case samples <- buf:
+			return nil
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+
+	// Encoded audio is decoded in the background as it arrives
+	var wg sync.WaitGroup
+	var pw *io.PipeWriter
+	var decodeErr error
+	if format == FormatEncoded {
+		var pr *io.PipeReader
+		pr, pw = io.Pipe()
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			decodeErr = decodeSession(ctx, pr, send)
+			pr.CloseWithError(decodeErr)
+		}()
+	}
+
+	// Read messages
+	var result error
+	for {
+		t, data, err := conn.ReadMessage()
+		if errors.Is(err, io.EOF) {
+			break
+		} else if err != nil {
+			result = err
+			break
+		}
+
+		// Handle control messages
+		if t == websocket.TextMessage {
+			var req reqSession
+			if err := json.Unmarshal(data, &req); err != nil {
+				result = err
+				break
+			} else if req.Type == "end" {
+				break
+			} else {
+				continue
+			}
+		}
+
+		// Handle audio data
+		if pw != nil {
+			if _, err := pw.Write(data); err != nil {
+				result = err
+				break
+			}
+		} else if buf, err := pcmToSamples(format, data); err != nil {
+			result = err
+			break
+		} else if err := send(buf); err != nil {
+			result = err
+			break
+		}
+	}
+
+	// Wait for decoding to complete
+	if pw != nil {
+		pw.CloseWithError(result)
+		wg.Wait()
+		result = errors.Join(result, decodeErr)
+	}
+
+	// Return any errors
+	return result
+}
+
+// Decode encoded audio from a reader, and send the samples
+func decodeSession(ctx context.Context, r io.Reader, send func([]float32) error) error {
+	segmenter, err := segmenter.NewReader(r, sessionChunkSize, whisper.SampleRate)
+	if err != nil {
+		return err
+	}
+	defer segmenter.Close()
+
+	// The segmenter re-uses the buffer, so make a copy of the samples
+	return segmenter.Decode(ctx, func(ts time.Duration, buf []float32) error {
+		return send(append([]float32(nil), buf...))
+	})
+}
+
+// Convert raw PCM data to samples
+func pcmToSamples(format SampleFormat, data []byte) ([]float32, error) {
+	switch format {
+	case FormatS16:
+		if len(data)%2 != 0 {
+			return nil, fmt.Errorf("unexpected length of %s data: %d bytes", format, len(data))
+		}
+		buf := make([]float32, len(data)/2)
+		for i := range buf {
+			buf[i] = float32(int16(binary.LittleEndian.Uint16(data[i*2:]))) / 32768
+		}
+		return buf, nil
+	case FormatF32:
+		if len(data)%4 != 0 {
+			return nil, fmt.Errorf("unexpected length of %s data: %d bytes", format, len(data))
+		}
+		buf := make([]float32, len(data)/4)
+		for i := range buf {
+			buf[i] = math.Float32frombits(binary.LittleEndian.Uint32(data[i*4:]))
+		}
+		return buf, nil
+	default:
+		return nil, fmt.Errorf("unsupported format: %q", format)
+	}
+}
+
+// Pad samples with silence up to the minimum duration which whisper
+// will transcribe
+func padSamples(buf []float32) []float32 {
+	n := int(minSessionAudio.Seconds() * whisper.SampleRate)
+	if len(buf) == 0 || len(buf) >= n {
+		return buf
+	}
+	return append(buf[:len(buf):len(buf)], make([]float32, n-len(buf))...)
+}
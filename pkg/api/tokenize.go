@@ -0,0 +1,85 @@
+package api
+
+import (
+	"context"
+	"net/http"
+
+	// Packages
+	"github.com/mutablelogic/go-server/pkg/httprequest"
+	"github.com/mutablelogic/go-server/pkg/httpresponse"
+	"github.com/mutablelogic/go-whisper"
+)
+
+///////////////////////////////////////////////////////////////////////////////
+// TYPES
+
+type reqTokenize struct {
+	Model string `json:"model"`
+	Text  string `json:"text"`
+}
+
+type reqDetokenize struct {
+	Model  string  `json:"model"`
+	Tokens []int32 `json:"tokens"`
+}
+
+///////////////////////////////////////////////////////////////////////////////
+// PUBLIC METHODS
+
+// Tokenize converts text into the tokens of a model
+func Tokenize(ctx context.Context, service *whisper.Whisper, w http.ResponseWriter, r *http.Request) {
+	var req reqTokenize
+	if err := httprequest.Body(&req, r); err != nil {
+		httpresponse.Error(w, http.StatusBadRequest, err.Error())
+		return
+	} else if req.Model == "" {
+		httpresponse.Error(w, http.StatusBadRequest, "model is required")
+		return
+	}
+
+	// Get the model
+	model := service.GetModelById(req.Model)
+	if model == nil {
+		httpresponse.Error(w, http.StatusNotFound, "model not found")
+		return
+	}
+
+	// Tokenize the text
+	tokens, err := service.Tokenize(ctx, model, req.Text)
+	if err != nil {
+		errorResponse(w, err)
+		return
+	}
+
+	// Return the tokens
+	httpresponse.JSON(w, tokens, http.StatusOK, 2)
+}
+
+// Detokenize converts the tokens of a model into text
+func Detokenize(ctx context.Context, service *whisper.Whisper, w http.ResponseWriter, r *http.Request) {
+	var req reqDetokenize
+	if err := httprequest.Body(&req, r); err != nil {
+		httpresponse.Error(w, http.StatusBadRequest, err.Error())
+		return
+	} else if req.Model == "" {
+		httpresponse.Error(w, http.StatusBadRequest, "model is required")
+		return
+	}
+
+	// Get the model
+	model := service.GetModelById(req.Model)
+	if model == nil {
+		httpresponse.Error(w, http.StatusNotFound, "model not found")
+		return
+	}
+
+	// Detokenize the tokens
+	tokens, err := service.Detokenize(ctx, model, req.Tokens)
+	if err != nil {
+		errorResponse(w, err)
+		return
+	}
+
+	// Return the text
+	httpresponse.JSON(w, tokens, http.StatusOK, 2)
+}
@@ -4,6 +4,7 @@ import (
 	"bytes"
 	"context"
 	"fmt"
+	"io"
 	"mime/multipart"
 	"net/http"
 	"strings"
@@ -25,18 +26,44 @@ import (
 // TYPES
 
 type reqTranscribe struct {
-	File        *multipart.FileHeader `json:"file"`
-	Model       string                `json:"model"`
-	Language    *string               `json:"language"`
-	Temperature *float32              `json:"temperature"`
-	SegmentSize *time.Duration        `json:"segment_size"`
-	ResponseFmt *string               `json:"response_format"`
+	File          *multipart.FileHeader `json:"file"`
+	Model         string                `json:"model"`
+	Language      *string               `json:"language"`
+	SegmentSize   *time.Duration        `json:"segment_size"`
+	Start         *time.Duration        `json:"start"`
+	Duration      *time.Duration        `json:"duration"`
+	StreamIndex   *int                  `json:"stream_index"`
+	StreamLang    *string               `json:"stream_language"`
+	Channel       *int                  `json:"channel"`
+	Vad           *bool                 `json:"vad"`
+	Overlap       *time.Duration        `json:"overlap"`
+	Speakers      *string               `json:"speakers"`
+	ResponseFmt   *string               `json:"response_format"`
+	Timestamps    []string              `json:"timestamp_granularities"`
+	Granularities []string              `json:"timestamp_granularities[]"` // array as sent by OpenAI clients
+	task.Params
 }
 
 type queryTranscribe struct {
 	Stream bool `json:"stream"`
 }
 
+type queryTranscribeStream struct {
+	Stream      bool           `json:"stream"`
+	Language    *string        `json:"language"`
+	SegmentSize *time.Duration `json:"segment_size"`
+	Start       *time.Duration `json:"start"`
+	Duration    *time.Duration `json:"duration"`
+	StreamIndex *int           `json:"stream_index"`
+	StreamLang  *string        `json:"stream_language"`
+	Channel     *int           `json:"channel"`
+	Vad         *bool          `json:"vad"`
+	Overlap     *time.Duration `json:"overlap"`
+	ResponseFmt *string        `json:"response_format"`
+	Timestamps  []string       `json:"timestamp_granularities"`
+	task.Params
+}
+
 type TaskType int
 type ResponseFormat string
 
@@ -47,6 +74,14 @@ const (
 	minSegmentSize     = 5 * time.Second
 	maxSegmentSize     = 10 * time.Minute
 	defaultSegmentSize = 5 * time.Minute
+
+	// Default segment size for streamed media, which is smaller so that
+	// segments are returned while the upload is still in progress
+	defaultStreamSegmentSize = 10 * time.Second
+
+	// With voice activity detection, segments are cut at silence within
+	// a tenth of the segment size, and silence longer than vadSkip is skipped
+	vadSkip = 2 * time.Second
 )
 
 const (
@@ -79,10 +114,14 @@ func TranscribeFile(ctx context.Context, service *whisper.Whisper, w http.Respon
 		return
 	}
 
-	// Validate the request
+	// Validate the request. Segments for each speaker are interleaved once
+	// all the channels are transcribed, so they cannot be streamed
 	if err := req.Validate(); err != nil {
 		httpresponse.Error(w, http.StatusBadRequest, err.Error())
 		return
+	} else if query.Stream && req.Speakers != nil {
+		httpresponse.Error(w, http.StatusBadRequest, "speakers cannot be set when streaming")
+		return
 	}
 
 	// Get the model
@@ -100,12 +139,25 @@ func TranscribeFile(ctx context.Context, service *whisper.Whisper, w http.Respon
 	}
 	defer f.Close()
 
-	// Create a segmenter - read segments based on requested segment size
-	segmenter, err := segmenter.NewReader(f, req.SegmentDur(), whisper.SampleRate)
+	// Create a segmenter - read segments based on requested segment size,
+	// from the first channel when each speaker is on a separate channel
+	segmenter, err := req.Segmenter(f, 0)
 	if err != nil {
 		httpresponse.Error(w, http.StatusBadRequest, err.Error())
 		return
 	}
+	defer segmenter.Close()
+
+	// Check there is a speaker label for each channel, before transcribing
+	if speakers := req.SpeakerLabels(); len(speakers) > 0 {
+		if channels, err := segmenter.Channels(); err != nil {
+			errorResponse(w, err)
+			return
+		} else if len(speakers) != channels {
+			httpresponse.Error(w, http.StatusBadRequest, fmt.Sprintf("%d speakers for an audio stream with %d channels", len(speakers), channels))
+			return
+		}
+	}
 
 	// Create a text stream
 	var stream *httpresponse.TextStream
@@ -119,7 +171,7 @@ func TranscribeFile(ctx context.Context, service *whisper.Whisper, w http.Respon
 
 	// Get context for the model, perform transcription
 	var result *schema.Transcription
-	if err := service.WithModel(model, func(taskctx *task.Context) error {
+	if err := service.WithModel(ctx, model, func(taskctx *task.Context) error {
 		result = taskctx.Result()
 
 		switch t {
@@ -161,7 +213,18 @@ func TranscribeFile(ctx context.Context, service *whisper.Whisper, w http.Respon
 			}
 		}
 
-		// TODO: Set temperature, etc
+		// Set overlap
+		if req.Overlap != nil {
+			if err := taskctx.SetOverlap(*req.Overlap); err != nil {
+				return err
+			}
+		}
+
+		// Set decoding parameters
+		if err := taskctx.SetParams(req.Params); err != nil {
+			return err
+		}
+		taskctx.SetWordTimestamps(req.WordTimestamps())
 
 		// Output the header
 		result.Language = taskctx.Language()
@@ -169,33 +232,29 @@ func TranscribeFile(ctx context.Context, service *whisper.Whisper, w http.Respon
 			stream.Write("task", taskctx.Result())
 		}
 
-		// Read samples and transcribe them
-		if err := segmenter.Decode(ctx, func(ts time.Duration, buf []float32) error {
-			// Perform the transcription, return any errors
-			return taskctx.Transcribe(ctx, ts, buf, func(segment *schema.Segment) {
-				// Segment callback
-				if stream == nil {
-					return
+		// Read samples and transcribe them. When each speaker is on a separate
+		// channel, transcribe each channel, then interleave the segments
+		if speakers := req.SpeakerLabels(); len(speakers) == 0 {
+			if err := transcribeSegments(ctx, taskctx, segmenter, segmentWriter(stream, req.ResponseFormat())); err != nil {
+				return err
+			}
+		} else {
+			for channel, speaker := range speakers {
+				var err error
+				taskctx.SetSpeaker(speaker)
+				if channel == 0 {
+					err = transcribeSegments(ctx, taskctx, segmenter, func(*schema.Segment) {})
+				} else {
+					err = req.transcribeChannel(ctx, taskctx, channel)
 				}
-				var buf bytes.Buffer
-				switch req.ResponseFormat() {
-				case FormatVerboseJson, FormatJson:
-					stream.Write("segment", segment)
-					return
-				case FormatSrt:
-					task.WriteSegmentSrt(&buf, segment)
-				case FormatVtt:
-					task.WriteSegmentVtt(&buf, segment)
-				case FormatText:
-					task.WriteSegmentText(&buf, segment)
+				if err != nil {
+					return err
 				}
-				stream.Write("segment", buf.String())
-			})
-		}); err != nil {
-			return err
+			}
+			taskctx.Interleave()
 		}
 
-		// Set the language and duration
+		// Set the language
 		result.Language = taskctx.Language()
 
 		// Return success
@@ -204,7 +263,7 @@ func TranscribeFile(ctx context.Context, service *whisper.Whisper, w http.Respon
 		if stream != nil {
 			stream.Write("error", err.Error())
 		} else {
-			httpresponse.Error(w, http.StatusInternalServerError, err.Error())
+			errorResponse(w, err)
 		}
 		return
 	}
@@ -217,14 +276,19 @@ func TranscribeFile(ctx context.Context, service *whisper.Whisper, w http.Respon
 	}
 }
 
-/*
 func TranscribeStream(ctx context.Context, service *whisper.Whisper, w http.ResponseWriter, r *http.Request, modelId string) {
-	var query queryTranscribe
+	var query queryTranscribeStream
 	if err := httprequest.Query(&query, r.URL.Query()); err != nil {
 		httpresponse.Error(w, http.StatusBadRequest, err.Error())
 		return
 	}
 
+	// Validate the request
+	if err := query.Validate(); err != nil {
+		httpresponse.Error(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
 	// Get the model
 	model := service.GetModelById(modelId)
 	if model == nil {
@@ -232,16 +296,20 @@ func TranscribeStream(ctx context.Context, service *whisper.Whisper, w http.Resp
 		return
 	}
 
-	// Create a segmenter - read segments based on 10 second segment size
-	segmenter, err := segmenter.New(r.Body, 10*time.Second, whisper.SampleRate)
+	// Create a segmenter - read segments from the request body as it arrives
+	segmenter, err := query.Segmenter(r.Body)
 	if err != nil {
 		httpresponse.Error(w, http.StatusBadRequest, err.Error())
 		return
 	}
+	defer segmenter.Close()
 
-	// Create a text stream
+	// Create a text stream. For HTTP/1.x, full duplex is needed in order to
+	// write segments while the request body is still being read. HTTP/2 is
+	// always full duplex, so any error is ignored
 	var stream *httpresponse.TextStream
 	if query.Stream {
+		http.NewResponseController(w).EnableFullDuplex()
 		if stream = httpresponse.NewTextStream(w); stream == nil {
 			httpresponse.Error(w, http.StatusInternalServerError, "Cannot create text stream")
 			return
@@ -251,34 +319,41 @@ func TranscribeStream(ctx context.Context, service *whisper.Whisper, w http.Resp
 
 	// Get context for the model, perform transcription
 	var result *schema.Transcription
-	if err := service.WithModel(model, func(task *task.Context) error {
-		// Set parameters for ttranslation, default to auto
-		task.SetTranslate(false)
-		if err := task.SetLanguage("auto"); err != nil {
-			return err
+	if err := service.WithModel(ctx, model, func(taskctx *task.Context) error {
+		// Set parameters for transcription, default to auto
+		taskctx.SetTranslate(false)
+		taskctx.SetDiarize(false)
+		if query.Language != nil {
+			if err := taskctx.SetLanguage(*query.Language); err != nil {
+				return err
+			}
+		}
+
+		// Set overlap
+		if query.Overlap != nil {
+			if err := taskctx.SetOverlap(*query.Overlap); err != nil {
+				return err
+			}
 		}
 
-		// TODO: Set temperature, etc
+		// Set decoding parameters
+		if err := taskctx.SetParams(query.Params); err != nil {
+			return err
+		}
+		taskctx.SetWordTimestamps(query.WordTimestamps())
 
 		// Create response
-		result = task.Result()
+		result = taskctx.Result()
 		result.Task = "transcribe"
-		result.Language = task.Language()
+		result.Language = taskctx.Language()
 
 		// Output the header
 		if stream != nil {
 			stream.Write("task", result)
 		}
 
-		// Read samples and transcribe them
-		if err := segmenter.Decode(ctx, func(ts time.Duration, buf []float32) error {
-			// Perform the transcription, output segments in realtime, return any errors
-			return task.Transcribe(ctx, ts, buf, func(segment *schema.Segment) {
-				if stream != nil {
-					stream.Write("segment", segment)
-				}
-			})
-		}); err != nil {
+		// Read samples and transcribe them, output segments in realtime
+		if err := transcribeSegments(ctx, taskctx, segmenter, segmentWriter(stream, query.ResponseFormat())); err != nil {
 			return err
 		}
 
@@ -291,7 +366,7 @@ func TranscribeStream(ctx context.Context, service *whisper.Whisper, w http.Resp
 		if stream != nil {
 			stream.Write("error", err.Error())
 		} else {
-			httpresponse.Error(w, http.StatusInternalServerError, err.Error())
+			errorResponse(w, err)
 		}
 		return
 	}
@@ -302,29 +377,9 @@ func TranscribeStream(ctx context.Context, service *whisper.Whisper, w http.Resp
 		return
 	}
 
-	// Rrturn result based on response format
-	switch req.ResponseFormat() {
-	case FormatJson, FormatVerboseJson:
-		httpresponse.JSON(w, result, http.StatusOK, 0)
-	case FormatText:
-		httpresponse.Text(w, "", http.StatusOK)
-		for _, seg := range result.Segments {
-			task.WriteSegmentText(w, seg)
-		}
-		w.Write([]byte("\n"))
-	case FormatSrt:
-		httpresponse.Text(w, "", http.StatusOK, "Content-Type", "application/x-subrip")
-		for _, seg := range result.Segments {
-			task.WriteSegmentSrt(w, seg)
-		}
-	case FormatVtt:
-		httpresponse.Text(w, "WEBVTT\n\n", http.StatusOK, "Content-Type", "text/vtt")
-		for _, seg := range result.Segments {
-			task.WriteSegmentVtt(w, seg)
-		}
-	}
+	// Return result based on response format
+	writeTranscription(w, result, query.ResponseFormat())
 }
-*/
 
 ///////////////////////////////////////////////////////////////////////////////
 // PRIVATE METHODS
@@ -336,8 +391,105 @@ func (r reqTranscribe) Validate() error {
 	if r.File == nil {
 		return fmt.Errorf("file is required")
 	}
-	if r.ResponseFmt != nil {
-		switch *r.ResponseFmt {
+	if r.Speakers != nil {
+		if r.Channel != nil {
+			return fmt.Errorf("channel cannot be set with speakers")
+		}
+		for _, speaker := range r.SpeakerLabels() {
+			if speaker == "" {
+				return fmt.Errorf("speakers must be a comma-separated list of labels")
+			}
+		}
+	}
+	if err := r.Params.Validate(); err != nil {
+		return err
+	}
+	if _, err := wordTimestamps(append(r.Timestamps, r.Granularities...)); err != nil {
+		return err
+	}
+	return validateResponseFormat(r.ResponseFmt)
+}
+
+// Return true if word timestamps are requested
+func (r reqTranscribe) WordTimestamps() bool {
+	words, _ := wordTimestamps(append(r.Timestamps, r.Granularities...))
+	return words
+}
+
+// Return the speaker labels, one for each channel, or nil if the
+// channels are not transcribed separately
+func (r reqTranscribe) SpeakerLabels() []string {
+	if r.Speakers == nil {
+		return nil
+	}
+	labels := strings.Split(*r.Speakers, ",")
+	for i := range labels {
+		labels[i] = strings.TrimSpace(labels[i])
+	}
+	return labels
+}
+
+// Return a segmenter for the uploaded file, which reads a single channel
+// when each speaker is on a separate channel
+func (r reqTranscribe) Segmenter(f io.Reader, channel int) (*segmenter.Segmenter, error) {
+	opts := append(streamOpts(r.StreamIndex, r.StreamLang, r.Channel, r.Start, r.Duration), segmentOpts(r.Vad, r.Overlap, r.SegmentDur())...)
+	if r.Speakers != nil {
+		opts = append(opts, segmenter.OptChannel(channel))
+	}
+	return segmenter.NewReader(f, r.SegmentDur(), whisper.SampleRate, opts...)
+}
+
+func (r reqTranscribe) ResponseFormat() ResponseFormat {
+	return responseFormat(r.ResponseFmt)
+}
+
+func (r reqTranscribe) OutputSegments() bool {
+	// We want to output segments if the response format is  "srt", "verbose_json", "vtt"
+	switch r.ResponseFormat() {
+	case FormatSrt, FormatVerboseJson, FormatVtt:
+		return true
+	default:
+		return false
+	}
+}
+
+func (r reqTranscribe) SegmentDur() time.Duration {
+	return segmentDur(r.SegmentSize, defaultSegmentSize)
+}
+
+func (r queryTranscribeStream) Validate() error {
+	if err := r.Params.Validate(); err != nil {
+		return err
+	}
+	if _, err := wordTimestamps(r.Timestamps); err != nil {
+		return err
+	}
+	return validateResponseFormat(r.ResponseFmt)
+}
+
+// Return true if word timestamps are requested
+func (r queryTranscribeStream) WordTimestamps() bool {
+	words, _ := wordTimestamps(r.Timestamps)
+	return words
+}
+
+func (r queryTranscribeStream) ResponseFormat() ResponseFormat {
+	return responseFormat(r.ResponseFmt)
+}
+
+func (r queryTranscribeStream) SegmentDur() time.Duration {
+	return segmentDur(r.SegmentSize, defaultStreamSegmentSize)
+}
+
+// Return a segmenter for the request body
+func (r queryTranscribeStream) Segmenter(body io.Reader) (*segmenter.Segmenter, error) {
+	opts := append(streamOpts(r.StreamIndex, r.StreamLang, r.Channel, r.Start, r.Duration), segmentOpts(r.Vad, r.Overlap, r.SegmentDur())...)
+	return segmenter.NewReader(body, r.SegmentDur(), whisper.SampleRate, opts...)
+}
+
+func validateResponseFormat(v *string) error {
+	if v != nil {
+		switch strings.ToLower(*v) {
 		case "json", "text", "srt", "verbose_json", "vtt":
 			break
 		default:
@@ -346,11 +498,31 @@ func (r reqTranscribe) Validate() error {
 	}
 	return nil
 }
-func (r reqTranscribe) ResponseFormat() ResponseFormat {
-	if r.ResponseFmt == nil {
+
+// Return true if the timestamp granularities include words, or an error if
+// a granularity is not supported. Each value can be a comma-separated list
+func wordTimestamps(v []string) (bool, error) {
+	var words bool
+	for _, v := range v {
+		for _, granularity := range strings.Split(v, ",") {
+			switch strings.ToLower(strings.TrimSpace(granularity)) {
+			case "word":
+				words = true
+			case "segment":
+				break
+			default:
+				return false, fmt.Errorf("timestamp_granularities must be one of: word, segment")
+			}
+		}
+	}
+	return words, nil
+}
+
+func responseFormat(v *string) ResponseFormat {
+	if v == nil {
 		return FormatJson
 	}
-	switch strings.ToLower(*r.ResponseFmt) {
+	switch strings.ToLower(*v) {
 	case "json":
 		return FormatJson
 	case "text":
@@ -365,25 +537,131 @@ func (r reqTranscribe) ResponseFormat() ResponseFormat {
 	return FormatJson
 }
 
-func (r reqTranscribe) OutputSegments() bool {
-	// We want to output segments if the response format is  "srt", "verbose_json", "vtt"
-	switch r.ResponseFormat() {
-	case FormatSrt, FormatVerboseJson, FormatVtt:
-		return true
-	default:
-		return false
+func segmentDur(v *time.Duration, def time.Duration) time.Duration {
+	if v == nil {
+		return def
+	}
+	if *v < minSegmentSize {
+		return minSegmentSize
+	}
+	if *v > maxSegmentSize {
+		return maxSegmentSize
 	}
+	return *v
 }
 
-func (r reqTranscribe) SegmentDur() time.Duration {
-	if r.SegmentSize == nil {
-		return defaultSegmentSize
+// Return the segmenter options for selecting the audio stream by index or
+// language, the channel and the range of the audio to decode
+func streamOpts(stream *int, language *string, channel *int, start, duration *time.Duration) []segmenter.Opt {
+	var opts []segmenter.Opt
+	if start != nil || duration != nil {
+		var from, dur time.Duration
+		if start != nil {
+			from = *start
+		}
+		if duration != nil {
+			dur = *duration
+		}
+		opts = append(opts, segmenter.OptRange(from, dur))
 	}
-	if *r.SegmentSize < minSegmentSize {
-		return minSegmentSize
+	if stream != nil {
+		opts = append(opts, segmenter.OptStream(*stream))
 	}
-	if *r.SegmentSize > maxSegmentSize {
-		return maxSegmentSize
+	if language != nil {
+		opts = append(opts, segmenter.OptStreamLanguage(*language))
+	}
+	if channel != nil {
+		opts = append(opts, segmenter.OptChannel(*channel))
+	}
+	return opts
+}
+
+// Return the segmenter options for voice activity detection and overlap
+func segmentOpts(vad *bool, overlap *time.Duration, dur time.Duration) []segmenter.Opt {
+	var opts []segmenter.Opt
+	if vad != nil && *vad {
+		opts = append(opts, segmenter.OptVAD(dur/10, vadSkip))
+	}
+	if overlap != nil && *overlap > 0 {
+		opts = append(opts, segmenter.OptOverlap(*overlap))
+	}
+	return opts
+}
+
+// Transcribe a channel of the uploaded file, which is opened again. Segments
+// are collected into the transcription result
+func (r reqTranscribe) transcribeChannel(ctx context.Context, taskctx *task.Context, channel int) error {
+	f, err := r.File.Open()
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	segmenter, err := r.Segmenter(f, channel)
+	if err != nil {
+		return err
+	}
+	defer segmenter.Close()
+	return transcribeSegments(ctx, taskctx, segmenter, func(*schema.Segment) {})
+}
+
+// Read samples from the segmenter and transcribe them, then output any
+// segments which were held back
+func transcribeSegments(ctx context.Context, taskctx *task.Context, segmenter *segmenter.Segmenter, fn task.NewSegmentFunc) error {
+	if err := segmenter.Decode(ctx, func(ts time.Duration, buf []float32) error {
+		// Perform the transcription, return any errors
+		return taskctx.Transcribe(ctx, ts, buf, fn)
+	}); err != nil {
+		return err
+	}
+	taskctx.Flush(fn)
+	return nil
+}
+
+// Return a segment callback which writes segments to a text stream in the
+// requested format, or does nothing if the stream is nil. Segments are
+// always collected into the transcription result by the task
+func segmentWriter(stream *httpresponse.TextStream, format ResponseFormat) task.NewSegmentFunc {
+	return func(segment *schema.Segment) {
+		if stream == nil {
+			return
+		}
+		var buf bytes.Buffer
+		switch format {
+		case FormatVerboseJson, FormatJson:
+			stream.Write("segment", segment)
+			return
+		case FormatSrt:
+			task.WriteSegmentSrt(&buf, segment)
+		case FormatVtt:
+			task.WriteSegmentVtt(&buf, segment)
+		case FormatText:
+			task.WriteSegmentText(&buf, segment)
+		}
+		stream.Write("segment", buf.String())
+	}
+}
+
+// Write a completed transcription in the requested format
+func writeTranscription(w http.ResponseWriter, result *schema.Transcription, format ResponseFormat) {
+	var buf bytes.Buffer
+	switch format {
+	case FormatText:
+		for _, seg := range result.Segments {
+			task.WriteSegmentText(&buf, seg)
+		}
+		httpresponse.Text(w, buf.String(), http.StatusOK)
+	case FormatSrt:
+		for _, seg := range result.Segments {
+			task.WriteSegmentSrt(&buf, seg)
+		}
+		httpresponse.Text(w, buf.String(), http.StatusOK, "Content-Type", "application/x-subrip")
+	case FormatVtt:
+		buf.WriteString("WEBVTT\n\n")
+		for _, seg := range result.Segments {
+			task.WriteSegmentVtt(&buf, seg)
+		}
+		httpresponse.Text(w, buf.String(), http.StatusOK, "Content-Type", "text/vtt")
+	default:
+		httpresponse.JSON(w, result, http.StatusOK, 2)
 	}
-	return *r.SegmentSize
 }
@@ -193,3 +193,157 @@ func (c *Client) Translate(ctx context.Context, model string, r io.Reader, opt .
 	// Return success
 	return &response, nil
 }
+
+// DetectLanguage returns the languages of the media ranked by probability,
+// most probable first. Use OptDuration to set the duration of audio used,
+// which defaults to the first thirty seconds
+func (c *Client) DetectLanguage(ctx context.Context, model string, r io.Reader, opt ...Opt) ([]schema.Language, error) {
+	var request struct {
+		File  multipart.File `json:"file"`
+		Model string         `json:"model"`
+		opts
+	}
+	var response struct {
+		Languages []schema.Language `json:"languages"`
+	}
+
+	// Get the name from the io.Reader
+	name := ""
+	if f, ok := r.(*os.File); ok {
+		name = filepath.Base(f.Name())
+	}
+
+	// Create the request
+	request.Model = model
+	request.File = multipart.File{
+		Path: name,
+		Body: r,
+	}
+	for _, o := range opt {
+		if err := o(&request.opts); err != nil {
+			return nil, err
+		}
+	}
+
+	// Request->Response
+	if payload, err := client.NewMultipartRequest(request, httprequest.ContentTypeFormData); err != nil {
+		return nil, err
+	} else if err := c.DoWithContext(ctx, payload, &response, client.OptPath("audio/language"), client.OptNoTimeout()); err != nil {
+		return nil, err
+	}
+
+	// Return success
+	return response.Languages, nil
+}
+
+// Tokenize converts text into the tokens of a model
+func (c *Client) Tokenize(ctx context.Context, model, text string) (*schema.Tokens, error) {
+	var request struct {
+		Model string `json:"model"`
+		Text  string `json:"text"`
+	}
+	var response schema.Tokens
+
+	// Request->Response
+	request.Model, request.Text = model, text
+	if payload, err := client.NewJSONRequest(request); err != nil {
+		return nil, err
+	} else if err := c.DoWithContext(ctx, payload, &response, client.OptPath("tokenize")); err != nil {
+		return nil, err
+	}
+
+	// Return success
+	return &response, nil
+}
+
+// Detokenize converts the tokens of a model into text
+func (c *Client) Detokenize(ctx context.Context, model string, tokens []int32) (*schema.Tokens, error) {
+	var request struct {
+		Model  string  `json:"model"`
+		Tokens []int32 `json:"tokens"`
+	}
+	var response schema.Tokens
+
+	// Request->Response
+	request.Model, request.Tokens = model, tokens
+	if payload, err := client.NewJSONRequest(request); err != nil {
+		return nil, err
+	} else if err := c.DoWithContext(ctx, payload, &response, client.OptPath("detokenize")); err != nil {
+		return nil, err
+	}
+
+	// Return success
+	return &response, nil
+}
+
+///////////////////////////////////////////////////////////////////////////////
+// JOBS
+
+func (c *Client) ListJobs(ctx context.Context) ([]schema.Job, error) {
+	var jobs struct {
+		Jobs []schema.Job `json:"jobs"`
+	}
+	if err := c.DoWithContext(ctx, client.MethodGet, &jobs, client.OptPath("jobs")); err != nil {
+		return nil, err
+	}
+	// Return success
+	return jobs.Jobs, nil
+}
+
+// CreateJob queues a job to transcribe, translate or diarize the media, and
+// returns the job immediately. Use GetJob to poll for the result
+func (c *Client) CreateJob(ctx context.Context, model, task string, r io.Reader, opt ...Opt) (*schema.Job, error) {
+	var request struct {
+		File  multipart.File `json:"file"`
+		Model string         `json:"model"`
+		Task  string         `json:"task,omitempty"`
+		opts
+	}
+	var response schema.Job
+
+	// Get the name from the io.Reader
+	name := ""
+	if f, ok := r.(*os.File); ok {
+		name = filepath.Base(f.Name())
+	}
+
+	// Create the request
+	request.Model = model
+	request.Task = task
+	request.File = multipart.File{
+		Path: name,
+		Body: r,
+	}
+	for _, o := range opt {
+		if err := o(&request.opts); err != nil {
+			return nil, err
+		}
+	}
+
+	// Request->Response
+	if payload, err := client.NewMultipartRequest(request, httprequest.ContentTypeFormData); err != nil {
+		return nil, err
+	} else if err := c.DoWithContext(ctx, payload, &response, client.OptPath("jobs"), client.OptNoTimeout()); err != nil {
+		return nil, err
+	}
+
+	// Return success
+	return &response, nil
+}
+
+func (c *Client) GetJob(ctx context.Context, id string) (*schema.Job, error) {
+	var response schema.Job
+	if err := c.DoWithContext(ctx, client.MethodGet, &response, client.OptPath("jobs", id)); err != nil {
+		return nil, err
+	}
+	return &response, nil
+}
+
+// CancelJob cancels a queued or running job, or removes a job which is done
+func (c *Client) CancelJob(ctx context.Context, id string) (*schema.Job, error) {
+	var response schema.Job
+	if err := c.DoWithContext(ctx, client.MethodDelete, &response, client.OptPath("jobs", id)); err != nil {
+		return nil, err
+	}
+	return &response, nil
+}
@@ -1,12 +1,40 @@
 package client
 
-import "time"
+import (
+	"strconv"
+	"strings"
+	"time"
+)
 
 // Request options
 type opts struct {
 	Language    string        `json:"language,omitempty"`
 	SegmentSize time.Duration `json:"segment_size,omitempty"`
+	Start       time.Duration `json:"start,omitempty"`
+	Duration    time.Duration `json:"duration,omitempty"`
 	ResponseFmt string        `json:"response_format,omitempty"`
+	Timestamps  string        `json:"timestamp_granularities,omitempty"`
+
+	// Decoding parameters are formatted as strings, so that zero
+	// and false values are sent
+	Temperature      string `json:"temperature,omitempty"`
+	TemperatureInc   string `json:"temperature_inc,omitempty"`
+	BeamSize         string `json:"beam_size,omitempty"`
+	BestOf           string `json:"best_of,omitempty"`
+	Patience         string `json:"patience,omitempty"`
+	EntropyThreshold string `json:"entropy_thold,omitempty"`
+	RatioThreshold   string `json:"compression_ratio_thold,omitempty"`
+	LogProbThreshold string `json:"logprob_thold,omitempty"`
+	MaxLen           string `json:"max_len,omitempty"`
+	SplitOnWord      string `json:"split_on_word,omitempty"`
+	SuppressBlank    string `json:"suppress_blank,omitempty"`
+	SuppressRegex    string `json:"suppress_regex,omitempty"`
+	Prompt           string `json:"prompt,omitempty"`
+	ContextTokens    string `json:"context_tokens,omitempty"`
+	MinAvgLogProb    string `json:"min_avg_logprob,omitempty"`
+	Grammar          string `json:"grammar,omitempty"`
+	GrammarPenalty   string `json:"grammar_penalty,omitempty"`
+	Vocabulary       string `json:"vocabulary,omitempty"`
 }
 
 type Opt func(*opts) error
@@ -28,9 +56,184 @@ func OptSegmentSize(v time.Duration) Opt {
 	}
 }
 
+// Transcribe from a start time, with timestamps from the start of the media
+func OptStart(v time.Duration) Opt {
+	return func(o *opts) error {
+		o.Start = v
+		return nil
+	}
+}
+
+// Transcribe a duration of the media
+func OptDuration(v time.Duration) Opt {
+	return func(o *opts) error {
+		o.Duration = v
+		return nil
+	}
+}
+
 func OptResponseFormat(v string) Opt {
 	return func(o *opts) error {
 		o.ResponseFmt = v
 		return nil
 	}
 }
+
+// Set the timestamp granularities, which are "segment" or "word". Word
+// timestamps are returned with the verbose_json response format
+func OptTimestampGranularities(v ...string) Opt {
+	return func(o *opts) error {
+		o.Timestamps = strings.Join(v, ",")
+		return nil
+	}
+}
+
+// Set the initial decoding temperature, between 0 and 1
+func OptTemperature(v float32) Opt {
+	return func(o *opts) error {
+		o.Temperature = formatFloat(v)
+		return nil
+	}
+}
+
+// Set the temperature increase when decoding fails, or zero to disable
+func OptTemperatureInc(v float32) Opt {
+	return func(o *opts) error {
+		o.TemperatureInc = formatFloat(v)
+		return nil
+	}
+}
+
+// Decode with beam search with a number of beams, or greedy sampling
+// when the beam size is zero
+func OptBeamSize(v int) Opt {
+	return func(o *opts) error {
+		o.BeamSize = strconv.Itoa(v)
+		return nil
+	}
+}
+
+// Set the number of candidates when sampling with a non-zero temperature
+func OptBestOf(v int) Opt {
+	return func(o *opts) error {
+		o.BestOf = strconv.Itoa(v)
+		return nil
+	}
+}
+
+// Set the beam search patience
+func OptPatience(v float32) Opt {
+	return func(o *opts) error {
+		o.Patience = formatFloat(v)
+		return nil
+	}
+}
+
+// Set the entropy threshold, below which decoding fails
+func OptEntropyThreshold(v float32) Opt {
+	return func(o *opts) error {
+		o.EntropyThreshold = formatFloat(v)
+		return nil
+	}
+}
+
+// Set the compression ratio threshold, above which decoding fails, or
+// zero to disable
+func OptCompressionRatioThreshold(v float32) Opt {
+	return func(o *opts) error {
+		o.RatioThreshold = formatFloat(v)
+		return nil
+	}
+}
+
+// Set the average log probability threshold, below which decoding fails
+func OptLogProbThreshold(v float32) Opt {
+	return func(o *opts) error {
+		o.LogProbThreshold = formatFloat(v)
+		return nil
+	}
+}
+
+// Set the maximum segment length in characters, and whether segments
+// are split on words rather than tokens
+func OptMaxLen(v int, splitOnWord bool) Opt {
+	return func(o *opts) error {
+		o.MaxLen = strconv.Itoa(v)
+		o.SplitOnWord = strconv.FormatBool(splitOnWord)
+		return nil
+	}
+}
+
+// Set whether blank output is suppressed at the start of a segment
+func OptSuppressBlank(v bool) Opt {
+	return func(o *opts) error {
+		o.SuppressBlank = strconv.FormatBool(v)
+		return nil
+	}
+}
+
+// Suppress tokens which match a regular expression
+func OptSuppressRegex(v string) Opt {
+	return func(o *opts) error {
+		o.SuppressRegex = v
+		return nil
+	}
+}
+
+// Set the prompt, which provides context such as names and spellings
+func OptPrompt(v string) Opt {
+	return func(o *opts) error {
+		o.Prompt = v
+		return nil
+	}
+}
+
+// Set the number of tokens carried over from one segment to the next,
+// or zero to disable
+func OptContextTokens(v int) Opt {
+	return func(o *opts) error {
+		o.ContextTokens = strconv.Itoa(v)
+		return nil
+	}
+}
+
+// Drop segments with an average log probability below a floor, which
+// cannot be positive
+func OptMinAvgLogProb(v float32) Opt {
+	return func(o *opts) error {
+		o.MinAvgLogProb = formatFloat(v)
+		return nil
+	}
+}
+
+// Constrain decoding with a grammar in GBNF format, which has a root rule
+func OptGrammar(v string) Opt {
+	return func(o *opts) error {
+		o.Grammar = v
+		return nil
+	}
+}
+
+// Set the penalty for tokens which do not match the grammar
+func OptGrammarPenalty(v float32) Opt {
+	return func(o *opts) error {
+		o.GrammarPenalty = formatFloat(v)
+		return nil
+	}
+}
+
+// Set terms such as names and product codes, which are boosted during
+// decoding. Terms cannot contain commas
+func OptVocabulary(v ...string) Opt {
+	return func(o *opts) error {
+		o.Vocabulary = strings.Join(v, ",")
+		return nil
+	}
+}
+
+///////////////////////////////////////////////////////////////////////////////
+// PRIVATE METHODS
+
+func formatFloat(v float32) string {
+	return strconv.FormatFloat(float64(v), 'f', -1, 32)
+}
@@ -0,0 +1,2 @@
+/* grammar parses GBNF grammars into rules, which constrain decoding to text matching the grammar */
+package grammar
@@ -0,0 +1,440 @@
+package grammar
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"unicode/utf8"
+
+	// Namespace imports
+	. "github.com/djthorpe/go-errors"
+)
+
+//////////////////////////////////////////////////////////////////////////////
+// TYPES
+
+// Grammar is a set of rules, each of which is a sequence of elements.
+// Rules are indexed by their symbol id
+type Grammar struct {
+	symbols map[string]uint32
+	rules   [][]Element
+}
+
+// Element is a single element of a rule
+type Element struct {
+	Type  Type   `json:"type"`
+	Value uint32 `json:"value"`
+}
+
+// Type is the type of an element. The values match the element types
+// of whisper.cpp
+type Type uint32
+
+// parser holds the state while parsing a grammar
+type parser struct {
+	*Grammar
+	src string
+	pos int
+}
+
+//////////////////////////////////////////////////////////////////////////////
+// GLOBALS
+
+const (
+	END            Type = iota // end of rule definition
+	ALT                        // start of alternate definition for rule
+	RULE_REF                   // non-terminal element: reference to rule
+	CHAR                       // terminal element: character (code point)
+	CHAR_NOT                   // inverse char(s) ([^a], [^a-b] [^abc])
+	CHAR_RNG_UPPER             // modifies a preceding CHAR or CHAR_ALT to be an inclusive range ([a-z])
+	CHAR_ALT                   // modifies a preceding CHAR or CHAR_RNG_UPPER to add an alternate char to match ([ab], [a-zA])
+)
+
+const (
+	// The rule which is used to start decoding
+	RootRule = "root"
+)
+
+//////////////////////////////////////////////////////////////////////////////
+// LIFECYCLE
+
+// Parse a grammar in GBNF format. Returns ErrBadParameter if the grammar
+// cannot be parsed, references an undefined rule or has no root rule
+func Parse(src string) (*Grammar, error) {
+	p := &parser{Grammar: &Grammar{symbols: make(map[string]uint32)}, src: src}
+	p.space(true)
+	for !p.eof() {
+		if err := p.rule(); err != nil {
+			return nil, err
+		}
+	}
+
+	// Check all rules are defined
+	for _, rule := range p.rules {
+		for _, elem := range rule {
+			if elem.Type == RULE_REF && (int(elem.Value) >= len(p.rules) || p.rules[elem.Value] == nil) {
+				return nil, ErrBadParameter.Withf("undefined rule: %q", p.name(elem.Value))
+			}
+		}
+	}
+	if _, exists := p.symbols[RootRule]; !exists {
+		return nil, ErrBadParameter.Withf("missing %q rule", RootRule)
+	}
+
+	// Return success
+	return p.Grammar, nil
+}
+
+// Read and parse a grammar in GBNF format
+func Read(r io.Reader) (*Grammar, error) {
+	data, err := io.ReadAll(r)
+	if err != nil {
+		return nil, err
+	}
+	return Parse(string(data))
+}
+
+// Read and parse a grammar from a file in GBNF format
+func ReadFile(path string) (*Grammar, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	return Read(f)
+}
+
+//////////////////////////////////////////////////////////////////////////////
+// STRINGIFY
+
+func (g *Grammar) MarshalJSON() ([]byte, error) {
+	return json.Marshal(struct {
+		Symbols map[string]uint32 `json:"symbols"`
+		Rules   [][]Element       `json:"rules"`
+	}{
+		Symbols: g.symbols,
+		Rules:   g.rules,
+	})
+}
+
+func (g *Grammar) String() string {
+	data, err := json.MarshalIndent(g, "", "  ")
+	if err != nil {
+		return err.Error()
+	}
+	return string(data)
+}
+
+//////////////////////////////////////////////////////////////////////////////
+// PUBLIC METHODS
+
+// Return the rules, indexed by symbol id
+func (g *Grammar) Rules() [][]Element {
+	return g.rules
+}
+
+// Return the symbol id of a rule, or false if the rule does not exist
+func (g *Grammar) Symbol(name string) (uint32, bool) {
+	id, exists := g.symbols[name]
+	return id, exists
+}
+
+//////////////////////////////////////////////////////////////////////////////
+// PRIVATE METHODS
+
+// Return the id of a symbol, creating it if it doesn't exist
+func (g *Grammar) symbol(name string) uint32 {
+	if id, exists := g.symbols[name]; exists {
+		return id
+	}
+	id := uint32(len(g.symbols))
+	g.symbols[name] = id
+	return id
+}
+
+// Generate a new symbol id for a rule which is synthesized from a rule
+func (g *Grammar) generate(base string) uint32 {
+	id := uint32(len(g.symbols))
+	g.symbols[base+"_"+strconv.FormatUint(uint64(id), 10)] = id
+	return id
+}
+
+// Set the rule for a symbol id
+func (g *Grammar) add(id uint32, rule []Element) {
+	for int(id) >= len(g.rules) {
+		g.rules = append(g.rules, nil)
+	}
+	g.rules[id] = rule
+}
+
+// Return the name of a symbol id
+func (g *Grammar) name(id uint32) string {
+	for name, v := range g.symbols {
+		if v == id {
+			return name
+		}
+	}
+	return fmt.Sprint(id)
+}
+
+// Return true at the end of the source
+func (p *parser) eof() bool {
+	return p.pos >= len(p.src)
+}
+
+// Return the byte at an offset from the current position, or zero at the
+// end of the source
+func (p *parser) peek(offset int) byte {
+	if p.pos+offset >= len(p.src) {
+		return 0
+	}
+	return p.src[p.pos+offset]
+}
+
+// Return an error with the remaining source
+func (p *parser) errorf(format string) error {
+	rest := p.src[p.pos:]
+	if len(rest) > 20 {
+		rest = rest[:20]
+	}
+	return ErrBadParameter.Withf(format+" at %q", rest)
+}
+
+// Skip whitespace and comments, and newlines if newline is true
+func (p *parser) space(newline bool) {
+	for !p.eof() {
+		switch c := p.peek(0); {
+		case c == ' ' || c == '\t' || (newline && (c == '\r' || c == '\n')):
+			p.pos++
+		case c == '#':
+			for !p.eof() && p.peek(0) != '\r' && p.peek(0) != '\n' {
+				p.pos++
+			}
+		default:
+			return
+		}
+	}
+}
+
+// Parse a rule name
+func (p *parser) parseName() (string, error) {
+	start := p.pos
+	for isWordChar(p.peek(0)) {
+		p.pos++
+	}
+	if p.pos == start {
+		return "", p.errorf("expecting name")
+	}
+	return p.src[start:p.pos], nil
+}
+
+// Parse a rule, which is a name, followed by ::= and alternates
+func (p *parser) rule() error {
+	name, err := p.parseName()
+	if err != nil {
+		return err
+	}
+	p.space(false)
+	id := p.symbol(name)
+	if p.peek(0) != ':' || p.peek(1) != ':' || p.peek(2) != '=' {
+		return p.errorf("expecting ::=")
+	}
+	p.pos += 3
+	p.space(true)
+	if err := p.alternates(name, id, false); err != nil {
+		return err
+	}
+
+	// Expect a newline or the end of the source
+	switch p.peek(0) {
+	case '\r':
+		p.pos++
+		if p.peek(0) == '\n' {
+			p.pos++
+		}
+	case '\n':
+		p.pos++
+	default:
+		if !p.eof() {
+			return p.errorf("expecting newline or end")
+		}
+	}
+	p.space(true)
+	return nil
+}
+
+// Parse sequences separated by |, and add the rule
+func (p *parser) alternates(name string, id uint32, nested bool) error {
+	var rule []Element
+	if err := p.sequence(name, &rule, nested); err != nil {
+		return err
+	}
+	for p.peek(0) == '|' {
+		rule = append(rule, Element{ALT, 0})
+		p.pos++
+		p.space(true)
+		if err := p.sequence(name, &rule, nested); err != nil {
+			return err
+		}
+	}
+	p.add(id, append(rule, Element{END, 0}))
+	return nil
+}
+
+// Parse a sequence of literals, character ranges, rule references, groups
+// and repetition operators, appending the elements to the rule
+func (p *parser) sequence(name string, rule *[]Element, nested bool) error {
+	last := len(*rule)
+	for !p.eof() {
+		switch c := p.peek(0); {
+		case c == '"':
+			// Literal string
+			p.pos++
+			last = len(*rule)
+			for p.peek(0) != '"' {
+				r, err := p.char()
+				if err != nil {
+					return err
+				}
+				*rule = append(*rule, Element{CHAR, r})
+			}
+			p.pos++
+			p.space(nested)
+		case c == '[':
+			// Character ranges
+			p.pos++
+			start := CHAR
+			if p.peek(0) == '^' {
+				p.pos++
+				start = CHAR_NOT
+			}
+			last = len(*rule)
+			for p.peek(0) != ']' {
+				r, err := p.char()
+				if err != nil {
+					return err
+				}
+				if last < len(*rule) {
+					*rule = append(*rule, Element{CHAR_ALT, r})
+				} else {
+					*rule = append(*rule, Element{start, r})
+				}
+				if p.peek(0) == '-' && p.peek(1) != ']' {
+					p.pos++
+					r, err := p.char()
+					if err != nil {
+						return err
+					}
+					*rule = append(*rule, Element{CHAR_RNG_UPPER, r})
+				}
+			}
+			p.pos++
+			p.space(nested)
+		case isWordChar(c):
+			// Rule reference
+			ref, err := p.parseName()
+			if err != nil {
+				return err
+			}
+			p.space(nested)
+			last = len(*rule)
+			*rule = append(*rule, Element{RULE_REF, p.symbol(ref)})
+		case c == '(':
+			// Grouping, which is parsed into a synthesized rule
+			p.pos++
+			p.space(true)
+			id := p.generate(name)
+			if err := p.alternates(name, id, true); err != nil {
+				return err
+			}
+			last = len(*rule)
+			*rule = append(*rule, Element{RULE_REF, id})
+			if p.peek(0) != ')' {
+				return p.errorf("expecting ')'")
+			}
+			p.pos++
+			p.space(nested)
+		case c == '*' || c == '+' || c == '?':
+			// Repetition operator, which rewrites the previous symbol S as:
+			//   S* --> S' ::= S S' |
+			//   S+ --> S' ::= S S' | S
+			//   S? --> S' ::= S |
+			if last == len(*rule) {
+				return p.errorf("expecting preceding item to */+/?")
+			}
+			id := p.generate(name)
+			symbol := append([]Element(nil), (*rule)[last:]...)
+			sub := append([]Element(nil), symbol...)
+			if c == '*' || c == '+' {
+				sub = append(sub, Element{RULE_REF, id})
+			}
+			sub = append(sub, Element{ALT, 0})
+			if c == '+' {
+				sub = append(sub, symbol...)
+			}
+			p.add(id, append(sub, Element{END, 0}))
+			*rule = append((*rule)[:last], Element{RULE_REF, id})
+			p.pos++
+			p.space(nested)
+		default:
+			return nil
+		}
+	}
+	return nil
+}
+
+// Parse a character, which may be an escape sequence, and return the
+// code point
+func (p *parser) char() (uint32, error) {
+	if p.eof() {
+		return 0, p.errorf("unexpected end of input")
+	}
+	if p.peek(0) != '\\' {
+		r, size := utf8.DecodeRuneInString(p.src[p.pos:])
+		p.pos += size
+		return uint32(r), nil
+	}
+	switch c := p.peek(1); c {
+	case 'x':
+		return p.hex(2)
+	case 'u':
+		return p.hex(4)
+	case 'U':
+		return p.hex(8)
+	case 't':
+		p.pos += 2
+		return '\t', nil
+	case 'r':
+		p.pos += 2
+		return '\r', nil
+	case 'n':
+		p.pos += 2
+		return '\n', nil
+	case '\\', '"', '[', ']':
+		p.pos += 2
+		return uint32(c), nil
+	default:
+		return 0, p.errorf("unknown escape")
+	}
+}
+
+// Parse an escape sequence of hex digits
+func (p *parser) hex(size int) (uint32, error) {
+	start := p.pos + 2
+	if start+size > len(p.src) {
+		return 0, p.errorf("expecting hex digits")
+	}
+	v, err := strconv.ParseUint(p.src[start:start+size], 16, 32)
+	if err != nil {
+		return 0, p.errorf("expecting hex digits")
+	}
+	p.pos = start + size
+	return uint32(v), nil
+}
+
+// Return true if the character can be part of a rule name
+func isWordChar(c byte) bool {
+	return (c >= 'a' && c <= 'z') || (c >= 'A' && c <= 'Z') || c == '-' || (c >= '0' && c <= '9')
+}
@@ -0,0 +1,81 @@
+package grammar_test
+
+import (
+	"testing"
+
+	// Packages
+	grammar "github.com/mutablelogic/go-whisper/pkg/grammar"
+	assert "github.com/stretchr/testify/assert"
+
+	// Namespace imports
+	. "github.com/djthorpe/go-errors"
+)
+
+func Test_grammar_001(t *testing.T) {
+	assert := assert.New(t)
+
+	// Alternate literals
+	g, err := grammar.Parse(`root ::= "yes" | "no"`)
+	if !assert.NoError(err) {
+		t.FailNow()
+	}
+	root, exists := g.Symbol(grammar.RootRule)
+	assert.True(exists)
+	assert.Equal([]grammar.Element{
+		{grammar.CHAR, 'y'}, {grammar.CHAR, 'e'}, {grammar.CHAR, 's'},
+		{grammar.ALT, 0},
+		{grammar.CHAR, 'n'}, {grammar.CHAR, 'o'},
+		{grammar.END, 0},
+	}, g.Rules()[root])
+}
+
+func Test_grammar_002(t *testing.T) {
+	assert := assert.New(t)
+
+	// Character ranges with repetition are rewritten into a new rule
+	g, err := grammar.Parse("# digits\nroot ::= digit+\ndigit ::= [0-9]\n")
+	if !assert.NoError(err) {
+		t.FailNow()
+	}
+	assert.Len(g.Rules(), 3)
+	digit, _ := g.Symbol("digit")
+	assert.Equal([]grammar.Element{{grammar.CHAR, '0'}, {grammar.CHAR_RNG_UPPER, '9'}, {grammar.END, 0}}, g.Rules()[digit])
+	assert.Equal([]grammar.Element{
+		{grammar.RULE_REF, digit}, {grammar.RULE_REF, 2},
+		{grammar.ALT, 0},
+		{grammar.RULE_REF, digit},
+		{grammar.END, 0},
+	}, g.Rules()[2])
+	assert.Equal([]grammar.Element{{grammar.RULE_REF, 2}, {grammar.END, 0}}, g.Rules()[0])
+}
+
+func Test_grammar_003(t *testing.T) {
+	assert := assert.New(t)
+
+	// Groups, negated ranges and escapes
+	g, err := grammar.Parse(`root ::= ("on" | "off") [^\n\x41]?`)
+	if !assert.NoError(err) {
+		t.FailNow()
+	}
+	assert.Len(g.Rules(), 3)
+	assert.Equal([]grammar.Element{{grammar.CHAR_NOT, '\n'}, {grammar.CHAR_ALT, 'A'}, {grammar.ALT, 0}, {grammar.END, 0}}, g.Rules()[2])
+}
+
+func Test_grammar_004(t *testing.T) {
+	assert := assert.New(t)
+
+	// Invalid grammars
+	for _, src := range []string{
+		``,
+		`root = "yes"`,
+		`root ::= "yes`,
+		`root ::= yes`,
+		`command ::= "yes"`,
+		`root ::= *`,
+		`root ::= ("yes"`,
+		`root ::= "\q"`,
+	} {
+		_, err := grammar.Parse(src)
+		assert.ErrorIs(err, ErrBadParameter, src)
+	}
+}
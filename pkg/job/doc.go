@@ -0,0 +1,2 @@
+/* job implements a queue of transcription jobs, which are run by a set of workers */
+package job
@@ -0,0 +1,185 @@
+package job
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"sync"
+	"time"
+
+	// Packages
+	schema "github.com/mutablelogic/go-whisper/pkg/schema"
+)
+
+//////////////////////////////////////////////////////////////////////////////
+// TYPES
+
+// Job is a transcription job, which is queued and then run by a worker
+type Job struct {
+	sync.RWMutex
+
+	// Job metadata and result
+	job schema.Job
+
+	// Path to the media
+	path string
+
+	// Cancel a running job
+	cancel context.CancelFunc
+}
+
+//////////////////////////////////////////////////////////////////////////////
+// LIFECYCLE
+
+// Create a new job with a unique identifier, for the media at path
+func newJob(path, model, task, language string) *Job {
+	job := new(Job)
+	job.job = schema.Job{
+		Id:       newId(),
+		Status:   schema.JobQueued,
+		Model:    model,
+		Task:     task,
+		Language: language,
+		Created:  time.Now(),
+	}
+	job.path = path
+	return job
+}
+
+// Restore a job from a store, with the path to the media
+func Restore(meta *schema.Job, path string) *Job {
+	job := new(Job)
+	job.job = *meta
+	job.path = path
+	return job
+}
+
+//////////////////////////////////////////////////////////////////////////////
+// STRINGIFY
+
+func (j *Job) MarshalJSON() ([]byte, error) {
+	return json.Marshal(j.Schema())
+}
+
+func (j *Job) String() string {
+	data, err := json.MarshalIndent(j, "", "  ")
+	if err != nil {
+		return err.Error()
+	}
+	return string(data)
+}
+
+//////////////////////////////////////////////////////////////////////////////
+// PUBLIC METHODS
+
+// Return the job identifier
+func (j *Job) Id() string {
+	return j.job.Id
+}
+
+// Return the path to the media
+func (j *Job) Path() string {
+	return j.path
+}
+
+// Return the model identifier
+func (j *Job) Model() string {
+	return j.job.Model
+}
+
+// Return the task, which is transcribe, translate or diarize
+func (j *Job) Task() string {
+	return j.job.Task
+}
+
+// Return the language, or empty if the language should be detected
+func (j *Job) Language() string {
+	return j.job.Language
+}
+
+// Return the status of the job
+func (j *Job) Status() schema.JobStatus {
+	j.RLock()
+	defer j.RUnlock()
+	return j.job.Status
+}
+
+// Return a copy of the job metadata and result
+func (j *Job) Schema() *schema.Job {
+	j.RLock()
+	defer j.RUnlock()
+	job := j.job
+	return &job
+}
+
+// Set the progress of a running job, between zero and one
+func (j *Job) SetProgress(v float64) {
+	j.Lock()
+	defer j.Unlock()
+	j.job.Progress = min(max(v, 0), 1)
+}
+
+//////////////////////////////////////////////////////////////////////////////
+// PRIVATE METHODS
+
+// Set the job as running, with a function to cancel it
+func (j *Job) start(cancel context.CancelFunc) {
+	j.Lock()
+	defer j.Unlock()
+	now := time.Now()
+	j.job.Status = schema.JobRunning
+	j.job.Started = &now
+	j.cancel = cancel
+}
+
+// Set the job as done, with the result or error
+func (j *Job) finish(result *schema.Transcription, err error) {
+	j.Lock()
+	defer j.Unlock()
+	now := time.Now()
+	switch {
+	case err == nil:
+		j.job.Status = schema.JobCompleted
+		j.job.Progress = 1
+		j.job.Result = result
+	case errors.Is(err, context.Canceled):
+		j.job.Status = schema.JobCancelled
+	default:
+		j.job.Status = schema.JobFailed
+		j.job.Error = err.Error()
+	}
+	j.job.Completed = &now
+	j.cancel = nil
+}
+
+// Return a running job to the queue, so that it can be run again
+func (j *Job) requeue() {
+	j.Lock()
+	defer j.Unlock()
+	j.job.Status = schema.JobQueued
+	j.job.Progress = 0
+	j.job.Started = nil
+	j.cancel = nil
+}
+
+// Cancel a running job, returns false if the job is not running
+func (j *Job) stop() bool {
+	j.RLock()
+	defer j.RUnlock()
+	if j.cancel == nil {
+		return false
+	}
+	j.cancel()
+	return true
+}
+
+// Return a new random job identifier
+func newId() string {
+	var buf [12]byte
+	if _, err := rand.Read(buf[:]); err != nil {
+		panic(err)
+	}
+	return hex.EncodeToString(buf[:])
+}
@@ -0,0 +1,360 @@
+package job
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"slices"
+	"sync"
+
+	// Packages
+	schema "github.com/mutablelogic/go-whisper/pkg/schema"
+
+	// Namespace imports
+	. "github.com/djthorpe/go-errors"
+)
+
+//////////////////////////////////////////////////////////////////////////////
+// TYPES
+
+// Queue of jobs, which are run in order by a set of workers. The queue
+// takes ownership of the media for each job, and removes it when the job
+// is done. Jobs are persisted if the queue has a store
+type Queue struct {
+	sync.Mutex
+
+	// Persist jobs, or nil
+	store Store
+
+	// Log errors which cannot be returned, or nil
+	log LogFn
+
+	// All jobs by identifier, and the jobs waiting for a worker
+	jobs  map[string]*Job
+	queue []*Job
+
+	// Signal workers that a job is waiting
+	ready chan struct{}
+
+	// Workers
+	workers int
+	wg      sync.WaitGroup
+	cancel  context.CancelFunc
+}
+
+// RunFunc is called by a worker to run a job, and returns the transcription.
+// The context is cancelled when the job is cancelled or the queue is closed
+type RunFunc func(ctx context.Context, job *Job) (*schema.Transcription, error)
+
+// LogFn is called with errors which occur outside of a request, such as
+// when a job cannot be persisted
+type LogFn func(string)
+
+//////////////////////////////////////////////////////////////////////////////
+// LIFECYCLE
+
+// Create a new queue, and start a number of workers which call fn
+// to run each job. If store is not nil, then jobs are restored from the
+// store: queued jobs are requeued, and jobs which were running when the
+// queue was last closed are marked as failed. Errors from the store
+// which cannot be returned are passed to log, which can be nil
+func NewQueue(workers int, store Store, fn RunFunc, log LogFn) (*Queue, error) {
+	if workers < 1 {
+		return nil, ErrBadParameter.With("workers must be greater than zero")
+	}
+	if fn == nil {
+		return nil, ErrBadParameter.With("RunFunc is nil")
+	}
+
+	// Create the queue
+	queue := new(Queue)
+	queue.jobs = make(map[string]*Job)
+	queue.ready = make(chan struct{}, workers)
+	queue.workers = workers
+	queue.store = store
+	queue.log = log
+
+	// Restore jobs
+	if store != nil {
+		queue.restore()
+	}
+
+	// Start the workers
+	ctx, cancel := context.WithCancel(context.Background())
+	for i := 0; i < workers; i++ {
+		queue.wg.Add(1)
+		go func() {
+			defer queue.wg.Done()
+			queue.worker(ctx, fn)
+		}()
+	}
+	queue.cancel = cancel
+
+	// Return success
+	return queue, nil
+}
+
+// Close the queue, waiting for the workers to end. If the queue has a
+// store, then running jobs are interrupted and will be run again when the
+// queue is restored. Otherwise, queued and running jobs are cancelled
+func (q *Queue) Close() error {
+	var result error
+
+	// Stop the workers
+	q.cancel()
+	q.wg.Wait()
+
+	// Cancel any queued jobs
+	q.Lock()
+	defer q.Unlock()
+	if q.store == nil {
+		for _, job := range q.queue {
+			result = errors.Join(result, q.finish(job, nil, context.Canceled))
+		}
+	}
+	q.queue = nil
+
+	// Return any errors
+	return result
+}
+
+//////////////////////////////////////////////////////////////////////////////
+// STRINGIFY
+
+func (q *Queue) MarshalJSON() ([]byte, error) {
+	q.Lock()
+	defer q.Unlock()
+	return json.Marshal(struct {
+		Workers int `json:"workers"`
+		Queued  int `json:"queued"`
+		Jobs    int `json:"jobs"`
+	}{
+		Workers: q.workers,
+		Queued:  len(q.queue),
+		Jobs:    len(q.jobs),
+	})
+}
+
+func (q *Queue) String() string {
+	data, err := json.MarshalIndent(q, "", "  ")
+	if err != nil {
+		return err.Error()
+	}
+	return string(data)
+}
+
+//////////////////////////////////////////////////////////////////////////////
+// PUBLIC METHODS
+
+// Add a job to the end of the queue, for the media at path. The task is
+// one of transcribe, translate or diarize and the language can be empty
+func (q *Queue) Add(path, model, task, language string) (*Job, error) {
+	if path == "" || model == "" || task == "" {
+		return nil, ErrBadParameter
+	}
+
+	q.Lock()
+	defer q.Unlock()
+
+	// Add the job
+	job := newJob(path, model, task, language)
+	if err := q.write(job); err != nil {
+		return nil, err
+	}
+	q.jobs[job.Id()] = job
+	q.queue = append(q.queue, job)
+
+	// Signal a worker
+	q.signal()
+
+	// Return the job
+	return job, nil
+}
+
+// Return a job by identifier, or nil if the job does not exist
+func (q *Queue) Get(id string) *Job {
+	q.Lock()
+	defer q.Unlock()
+	return q.jobs[id]
+}
+
+// Return all jobs, in the order they were created
+func (q *Queue) List() []*Job {
+	q.Lock()
+	defer q.Unlock()
+
+	result := make([]*Job, 0, len(q.jobs))
+	for _, job := range q.jobs {
+		result = append(result, job)
+	}
+	slices.SortFunc(result, func(a, b *Job) int {
+		return a.job.Created.Compare(b.job.Created)
+	})
+	return result
+}
+
+// Cancel a queued or running job. A running job is cancelled through its
+// context, and will be marked as cancelled when the worker returns. If the
+// job is already done, then it is removed from the queue
+func (q *Queue) Cancel(id string) (*Job, error) {
+	q.Lock()
+	defer q.Unlock()
+
+	job, exists := q.jobs[id]
+	if !exists {
+		return nil, ErrNotFound.Withf("job %q", id)
+	}
+
+	switch job.Status() {
+	case schema.JobQueued:
+		q.queue = slices.DeleteFunc(q.queue, func(j *Job) bool {
+			return j == job
+		})
+		if err := q.finish(job, nil, context.Canceled); err != nil {
+			return nil, err
+		}
+	case schema.JobRunning:
+		job.stop()
+	default:
+		if err := q.remove(job); err != nil {
+			return nil, err
+		}
+		delete(q.jobs, id)
+	}
+
+	// Return the job
+	return job, nil
+}
+
+//////////////////////////////////////////////////////////////////////////////
+// PRIVATE METHODS
+
+// Run jobs until the context is cancelled
+func (q *Queue) worker(ctx context.Context, fn RunFunc) {
+	for {
+		job, jobctx, cancel := q.next(ctx)
+		if job == nil {
+			return
+		}
+
+		// Run the job
+		result, err := fn(jobctx, job)
+		cancel()
+
+		// If the queue was closed while the job was running, then it will be
+		// run again when the queue is restored. Otherwise, mark the job as
+		// done and remove the media
+		q.Lock()
+		if err != nil && ctx.Err() != nil && q.store != nil {
+			job.requeue()
+			q.logf(job, q.write(job))
+		} else {
+			q.logf(job, q.finish(job, result, err))
+		}
+		q.Unlock()
+	}
+}
+
+// Return the next job, blocking until a job is waiting, or return nil
+// if the context is cancelled. The job is started with a context which
+// can be cancelled separately
+func (q *Queue) next(ctx context.Context) (*Job, context.Context, context.CancelFunc) {
+	for {
+		q.Lock()
+		if len(q.queue) > 0 {
+			job := q.queue[0]
+			q.queue = q.queue[1:]
+			jobctx, cancel := context.WithCancel(ctx)
+			job.start(cancel)
+			q.logf(job, q.write(job))
+
+			// Wake another worker if more jobs are waiting
+			if len(q.queue) > 0 {
+				q.signal()
+			}
+			q.Unlock()
+			return job, jobctx, cancel
+		}
+		q.Unlock()
+
+		// Wait for a job
+		select {
+		case <-ctx.Done():
+			return nil, nil, nil
+		case <-q.ready:
+		}
+	}
+}
+
+// Signal a waiting worker, without blocking
+func (q *Queue) signal() {
+	select {
+	case q.ready <- struct{}{}:
+	default:
+	}
+}
+
+// Mark a job as done and remove the media
+func (q *Queue) finish(job *Job, result *schema.Transcription, err error) error {
+	job.finish(result, err)
+	if err := os.Remove(job.Path()); err != nil && !errors.Is(err, os.ErrNotExist) {
+		return err
+	}
+	return q.write(job)
+}
+
+// Persist a job, if the queue has a store
+func (q *Queue) write(job *Job) error {
+	if q.store == nil {
+		return nil
+	}
+	return q.store.Write(job)
+}
+
+// Remove a job from the store, if the queue has a store
+func (q *Queue) remove(job *Job) error {
+	if q.store == nil {
+		return nil
+	}
+	return q.store.Remove(job.Id())
+}
+
+// Log an error for a job, if there is an error and a log function
+func (q *Queue) logf(job *Job, err error) {
+	if err == nil || q.log == nil {
+		return
+	}
+	if job != nil {
+		q.log(fmt.Sprintf("job %q: %v", job.Id(), err))
+	} else {
+		q.log(fmt.Sprint("jobs: ", err))
+	}
+}
+
+// Restore jobs from the store. Queued jobs are requeued in the order they
+// were created, and jobs which were running are marked as failed, since
+// the queue was not closed cleanly. Jobs which cannot be read or updated
+// are logged, so that the queue is still created
+func (q *Queue) restore() {
+	jobs, err := q.store.Read()
+	q.logf(nil, err)
+	slices.SortFunc(jobs, func(a, b *Job) int {
+		return a.job.Created.Compare(b.job.Created)
+	})
+
+	for _, job := range jobs {
+		switch job.Status() {
+		case schema.JobQueued:
+			if _, err := os.Stat(job.Path()); err != nil {
+				q.logf(job, q.finish(job, nil, ErrNotFound.With("media for job is missing")))
+			} else {
+				q.queue = append(q.queue, job)
+			}
+		case schema.JobRunning:
+			q.logf(job, q.finish(job, nil, ErrInternalAppError.With("job was interrupted")))
+		}
+		q.jobs[job.Id()] = job
+	}
+}
@@ -0,0 +1,264 @@
+package job_test
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	// Packages
+	job "github.com/mutablelogic/go-whisper/pkg/job"
+	schema "github.com/mutablelogic/go-whisper/pkg/schema"
+	assert "github.com/stretchr/testify/assert"
+
+	// Namespace imports
+	. "github.com/djthorpe/go-errors"
+)
+
+func Test_queue_001(t *testing.T) {
+	assert := assert.New(t)
+	queue, err := job.NewQueue(2, nil, func(ctx context.Context, job *job.Job) (*schema.Transcription, error) {
+		job.SetProgress(0.5)
+		return &schema.Transcription{Task: job.Task(), Text: "hello"}, nil
+	}, nil)
+	if !assert.NoError(err) {
+		t.SkipNow()
+	}
+	defer queue.Close()
+
+	// Run a job, and check the media is removed
+	path := tempFile(t)
+	j, err := queue.Add(path, "model", "transcribe", "")
+	assert.NoError(err)
+	assert.NotEmpty(j.Id())
+	assert.Equal(j, queue.Get(j.Id()))
+
+	result := waitDone(t, j)
+	assert.Equal(schema.JobCompleted, result.Status)
+	assert.Equal(float64(1), result.Progress)
+	assert.NotNil(result.Started)
+	assert.NotNil(result.Completed)
+	if assert.NotNil(result.Result) {
+		assert.Equal("hello", result.Result.Text)
+	}
+	_, err = os.Stat(path)
+	assert.ErrorIs(err, os.ErrNotExist)
+
+	// Remove the job
+	_, err = queue.Cancel(j.Id())
+	assert.NoError(err)
+	assert.Nil(queue.Get(j.Id()))
+
+	// Not found
+	_, err = queue.Cancel(j.Id())
+	assert.ErrorIs(err, ErrNotFound)
+}
+
+func Test_queue_002(t *testing.T) {
+	assert := assert.New(t)
+	running := make(chan struct{})
+	queue, err := job.NewQueue(1, nil, func(ctx context.Context, job *job.Job) (*schema.Transcription, error) {
+		close(running)
+		<-ctx.Done()
+		return nil, ctx.Err()
+	}, nil)
+	if !assert.NoError(err) {
+		t.SkipNow()
+	}
+	defer queue.Close()
+
+	// The first job runs and the second job waits
+	j1, err := queue.Add(tempFile(t), "model", "transcribe", "")
+	assert.NoError(err)
+	j2, err := queue.Add(tempFile(t), "model", "transcribe", "")
+	assert.NoError(err)
+	<-running
+	assert.Equal(schema.JobRunning, j1.Status())
+	assert.Equal(schema.JobQueued, j2.Status())
+	assert.Len(queue.List(), 2)
+
+	// Cancel the queued job
+	_, err = queue.Cancel(j2.Id())
+	assert.NoError(err)
+	assert.Equal(schema.JobCancelled, j2.Status())
+
+	// Cancel the running job
+	_, err = queue.Cancel(j1.Id())
+	assert.NoError(err)
+	assert.Equal(schema.JobCancelled, waitDone(t, j1).Status)
+}
+
+func Test_queue_003(t *testing.T) {
+	assert := assert.New(t)
+	queue, err := job.NewQueue(1, nil, func(ctx context.Context, job *job.Job) (*schema.Transcription, error) {
+		return nil, ErrNotFound.With(job.Model())
+	}, nil)
+	if !assert.NoError(err) {
+		t.SkipNow()
+	}
+	defer queue.Close()
+
+	// Run a job which fails
+	j, err := queue.Add(tempFile(t), "model", "transcribe", "")
+	assert.NoError(err)
+	result := waitDone(t, j)
+	assert.Equal(schema.JobFailed, result.Status)
+	assert.Contains(result.Error, "model")
+	assert.Nil(result.Result)
+}
+
+func Test_queue_004(t *testing.T) {
+	assert := assert.New(t)
+	store, err := job.NewFileStore(t.TempDir())
+	if !assert.NoError(err) {
+		t.SkipNow()
+	}
+
+	// Interrupt a running job by closing the queue
+	running := make(chan struct{})
+	queue, err := job.NewQueue(1, store, func(ctx context.Context, job *job.Job) (*schema.Transcription, error) {
+		close(running)
+		<-ctx.Done()
+		return nil, ctx.Err()
+	}, nil)
+	if !assert.NoError(err) {
+		t.SkipNow()
+	}
+	path := tempFile(t)
+	j, err := queue.Add(path, "model", "translate", "de")
+	assert.NoError(err)
+	<-running
+	assert.NoError(queue.Close())
+
+	// The job is persisted as queued, and the media is kept
+	jobs, err := store.Read()
+	assert.NoError(err)
+	if assert.Len(jobs, 1) {
+		assert.Equal(j.Id(), jobs[0].Id())
+		assert.Equal(schema.JobQueued, jobs[0].Status())
+		assert.Equal("translate", jobs[0].Task())
+		assert.Equal("de", jobs[0].Language())
+		assert.Equal(path, jobs[0].Path())
+	}
+	_, err = os.Stat(path)
+	assert.NoError(err)
+
+	// The job is run again when the queue is restored
+	queue, err = job.NewQueue(1, store, func(ctx context.Context, job *job.Job) (*schema.Transcription, error) {
+		return &schema.Transcription{Task: job.Task(), Language: job.Language(), Duration: schema.Timestamp(1500 * time.Millisecond)}, nil
+	}, nil)
+	if !assert.NoError(err) {
+		t.SkipNow()
+	}
+	defer queue.Close()
+	if j := queue.Get(j.Id()); assert.NotNil(j) {
+		result := waitDone(t, j)
+		assert.Equal(schema.JobCompleted, result.Status)
+		if assert.NotNil(result.Result) {
+			assert.Equal("de", result.Result.Language)
+		}
+	}
+
+	// The result is persisted
+	jobs, err = store.Read()
+	assert.NoError(err)
+	if assert.Len(jobs, 1) {
+		assert.Equal(schema.JobCompleted, jobs[0].Status())
+		if result := jobs[0].Schema().Result; assert.NotNil(result) {
+			assert.Equal(schema.Timestamp(1500*time.Millisecond), result.Duration)
+		}
+	}
+}
+
+func Test_queue_005(t *testing.T) {
+	assert := assert.New(t)
+	store, err := job.NewFileStore(t.TempDir())
+	if !assert.NoError(err) {
+		t.SkipNow()
+	}
+
+	// Persist a job which was running, and a job where the media is missing
+	now := time.Now()
+	assert.NoError(store.Write(job.Restore(&schema.Job{Id: "running", Status: schema.JobRunning, Model: "model", Task: "transcribe", Created: now, Started: &now}, tempFile(t))))
+	assert.NoError(store.Write(job.Restore(&schema.Job{Id: "missing", Status: schema.JobQueued, Model: "model", Task: "transcribe", Created: now}, filepath.Join(t.TempDir(), "missing"))))
+
+	// Both jobs are marked as failed when the queue is restored
+	queue, err := job.NewQueue(1, store, func(ctx context.Context, job *job.Job) (*schema.Transcription, error) {
+		return nil, ErrNotImplemented
+	}, nil)
+	if !assert.NoError(err) {
+		t.SkipNow()
+	}
+	defer queue.Close()
+	for _, id := range []string{"running", "missing"} {
+		if j := queue.Get(id); assert.NotNil(j, id) {
+			assert.Equal(schema.JobFailed, j.Status(), id)
+			assert.NotEmpty(j.Schema().Error, id)
+		}
+	}
+
+	// Removing a job removes it from the store
+	_, err = queue.Cancel("running")
+	assert.NoError(err)
+	jobs, err := store.Read()
+	assert.NoError(err)
+	assert.Len(jobs, 1)
+}
+
+func Test_queue_006(t *testing.T) {
+	assert := assert.New(t)
+	store, err := job.NewFileStore(t.TempDir())
+	if !assert.NoError(err) {
+		t.SkipNow()
+	}
+
+	// Persist a queued job, and a corrupt job file
+	assert.NoError(store.Write(job.Restore(&schema.Job{Id: "queued", Status: schema.JobQueued, Model: "model", Task: "transcribe", Created: time.Now()}, tempFile(t))))
+	assert.NoError(os.WriteFile(filepath.Join(store.Path(), "corrupt.json"), []byte("{"), 0600))
+
+	// The queue is created, the corrupt file is logged and moved aside
+	var logged []string
+	queue, err := job.NewQueue(1, store, func(ctx context.Context, job *job.Job) (*schema.Transcription, error) {
+		return &schema.Transcription{Task: job.Task()}, nil
+	}, func(text string) {
+		logged = append(logged, text)
+	})
+	if !assert.NoError(err) {
+		t.SkipNow()
+	}
+	defer queue.Close()
+	if assert.Len(logged, 1) {
+		assert.Contains(logged[0], "corrupt.json")
+	}
+	_, err = os.Stat(filepath.Join(store.Path(), "corrupt.json.bad"))
+	assert.NoError(err)
+
+	// The queued job is run
+	if j := queue.Get("queued"); assert.NotNil(j) {
+		assert.Equal(schema.JobCompleted, waitDone(t, j).Status)
+	}
+	assert.Nil(queue.Get("corrupt"))
+}
+
+// Create a temporary media file
+func tempFile(t *testing.T) string {
+	path := filepath.Join(t.TempDir(), "media")
+	if err := os.WriteFile(path, []byte("media"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+// Wait for a job to be done
+func waitDone(t *testing.T, j *job.Job) *schema.Job {
+	deadline := time.Now().Add(5 * time.Second)
+	for time.Now().Before(deadline) {
+		if result := j.Schema(); result.Status.Done() {
+			return result
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	t.Fatal("timeout waiting for job", j.Id())
+	return nil
+}
@@ -0,0 +1,189 @@
+package job
+
+import (
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+
+	// Packages
+	schema "github.com/mutablelogic/go-whisper/pkg/schema"
+
+	// Namespace imports
+	. "github.com/djthorpe/go-errors"
+)
+
+//////////////////////////////////////////////////////////////////////////////
+// TYPES
+
+// Store persists jobs and their results, so that they can be restored
+// when the queue is created
+type Store interface {
+	// Write a job, replacing any job with the same identifier
+	Write(*Job) error
+
+	// Read all jobs. Any jobs which cannot be read are skipped, and are
+	// returned as an error along with the jobs which were read
+	Read() ([]*Job, error)
+
+	// Remove a job by identifier
+	Remove(id string) error
+}
+
+// FileStore persists each job as a JSON file in a directory
+type FileStore struct {
+	sync.Mutex
+	path string
+}
+
+// The persisted job, which includes the path to the media
+type record struct {
+	*schema.Job
+	Path string `json:"path"`
+}
+
+var _ Store = (*FileStore)(nil)
+
+//////////////////////////////////////////////////////////////////////////////
+// GLOBALS
+
+const (
+	// This is the extension of the job files
+	extJob = ".json"
+
+	// This extension is added to job files which cannot be read
+	extBad = ".bad"
+)
+
+//////////////////////////////////////////////////////////////////////////////
+// LIFECYCLE
+
+// Create a new file store in a directory, which must exist
+func NewFileStore(path string) (*FileStore, error) {
+	if info, err := os.Stat(path); err != nil {
+		return nil, err
+	} else if !info.IsDir() {
+		return nil, ErrBadParameter.With("not a directory:", path)
+	}
+	return &FileStore{path: path}, nil
+}
+
+//////////////////////////////////////////////////////////////////////////////
+// STRINGIFY
+
+func (s *FileStore) MarshalJSON() ([]byte, error) {
+	return json.Marshal(struct {
+		Path string `json:"path"`
+	}{
+		Path: s.path,
+	})
+}
+
+func (s *FileStore) String() string {
+	data, err := json.MarshalIndent(s, "", "  ")
+	if err != nil {
+		return err.Error()
+	}
+	return string(data)
+}
+
+//////////////////////////////////////////////////////////////////////////////
+// PUBLIC METHODS
+
+// Return the path to the store
+func (s *FileStore) Path() string {
+	return s.path
+}
+
+// Write a job. The job is written to a temporary file first, so that
+// a partially written job is never read
+func (s *FileStore) Write(job *Job) error {
+	s.Lock()
+	defer s.Unlock()
+
+	data, err := json.MarshalIndent(record{Job: job.Schema(), Path: job.Path()}, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	// Write to a temporary file, then rename
+	f, err := os.CreateTemp(s.path, ".job-*")
+	if err != nil {
+		return err
+	}
+	if _, err := f.Write(data); err != nil {
+		return errors.Join(err, f.Close(), os.Remove(f.Name()))
+	}
+	if err := f.Close(); err != nil {
+		return errors.Join(err, os.Remove(f.Name()))
+	}
+	if err := os.Rename(f.Name(), s.filename(job.Id())); err != nil {
+		return errors.Join(err, os.Remove(f.Name()))
+	}
+
+	// Return success
+	return nil
+}
+
+// Read all jobs. A job file which cannot be read is renamed with a .bad
+// extension and skipped, and the error is returned with the other jobs
+func (s *FileStore) Read() ([]*Job, error) {
+	s.Lock()
+	defer s.Unlock()
+
+	entries, err := os.ReadDir(s.path)
+	if err != nil {
+		return nil, err
+	}
+
+	var result []*Job
+	var errs error
+	for _, entry := range entries {
+		if entry.IsDir() || filepath.Ext(entry.Name()) != extJob || strings.HasPrefix(entry.Name(), ".") {
+			continue
+		}
+		if job, err := s.read(entry.Name()); err != nil {
+			path := filepath.Join(s.path, entry.Name())
+			errs = errors.Join(errs, ErrBadParameter.Withf("%s: %v", entry.Name(), err), os.Rename(path, path+extBad))
+		} else {
+			result = append(result, job)
+		}
+	}
+
+	// Return the jobs, and any errors
+	return result, errs
+}
+
+// Remove a job by identifier
+func (s *FileStore) Remove(id string) error {
+	s.Lock()
+	defer s.Unlock()
+	if err := os.Remove(s.filename(id)); err != nil && !errors.Is(err, os.ErrNotExist) {
+		return err
+	}
+	return nil
+}
+
+//////////////////////////////////////////////////////////////////////////////
+// PRIVATE METHODS
+
+func (s *FileStore) filename(id string) string {
+	return filepath.Join(s.path, filepath.Base(id)+extJob)
+}
+
+// Read a job from a file in the store
+func (s *FileStore) read(name string) (*Job, error) {
+	data, err := os.ReadFile(filepath.Join(s.path, name))
+	if err != nil {
+		return nil, err
+	}
+	var r record
+	if err := json.Unmarshal(data, &r); err != nil {
+		return nil, err
+	} else if r.Job == nil || r.Id == "" {
+		return nil, ErrBadParameter.With("missing job")
+	}
+	return Restore(r.Job, r.Path), nil
+}
@@ -1,8 +1,13 @@
 package pool
 
 import (
+	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
+	"sync"
+	"sync/atomic"
+	"time"
 
 	// Packages
 	schema "github.com/mutablelogic/go-whisper/pkg/schema"
@@ -20,13 +25,51 @@ type ContextPool struct {
 	// Pool of context objects
 	*Pool
 
-	// Base path for models
-	path string
-
 	// GPU flags
 	gpu int
+
+	// Model weights, which are shared between contexts
+	models *task.ModelCache
+
+	// Number of times a context with the model loaded was returned,
+	// or a model was loaded
+	hits, misses atomic.Uint64
+
+	// Contexts in use and the model for each, and models being drained.
+	// The release channel is closed and replaced when a context is returned
+	mu       sync.Mutex
+	active   map[*task.Context]string
+	draining map[string]int
+	release  chan struct{}
+
+	// Memory limit for loaded models in bytes, and the time after which
+	// an idle context is unloaded. Zero means no limit
+	limit uint64
+	ttl   time.Duration
+
+	// Memory reserved for contexts which are being initialised, in bytes
+	reserved uint64
+
+	// The time each idle context was returned to the pool
+	idle map[*task.Context]time.Time
+
+	// Stop unloading idle contexts, once
+	done chan struct{}
+	once sync.Once
+	wg   sync.WaitGroup
 }
 
+// Context key for the priority
+type priorityKey struct{}
+
+//////////////////////////////////////////////////////////////////////////////
+// GLOBALS
+
+const (
+	// How often idle contexts are checked
+	expireInterval = time.Second
+)
+
 //////////////////////////////////////////////////////////////////////////////
 // LIFECYCLE
 
@@ -39,15 +82,32 @@ func NewContextPool(path string, max int, gpu int) *ContextPool {
 	pool.Pool = NewPool(max, func() any {
 		return task.New()
 	})
-	pool.path = path
 	pool.gpu = gpu
+	pool.models = task.NewModelCache(path, gpu)
+	pool.active = make(map[*task.Context]string)
+	pool.draining = make(map[string]int)
+	pool.release = make(chan struct{})
+	pool.idle = make(map[*task.Context]time.Time)
+	pool.done = make(chan struct{})
+
+	// Unload idle contexts in the background
+	pool.wg.Add(1)
+	go func() {
+		defer pool.wg.Done()
+		pool.run()
+	}()
 
 	// Return success
 	return pool
 }
 
-// Close the pool and release all resources
+// Close the pool and release all resources. Close can be called more
+// than once
 func (m *ContextPool) Close() error {
+	m.once.Do(func() {
+		close(m.done)
+	})
+	m.wg.Wait()
 	return m.Pool.Close()
 }
 
@@ -55,14 +115,35 @@ func (m *ContextPool) Close() error {
 // STRINGIFY
 
 func (m *ContextPool) MarshalJSON() ([]byte, error) {
+	stats := m.Stats()
 	return json.Marshal(struct {
-		Gpu int `json:"gpu"`
-		N   int `json:"n"`
-		Max int `json:"max"`
+		Gpu      int              `json:"gpu"`
+		N        int              `json:"n"`
+		Max      int              `json:"max"`
+		Queued   int              `json:"queued"`
+		Waits    uint64           `json:"waits"`
+		WaitTime schema.Timestamp `json:"wait_time"`
+		WaitMax  schema.Timestamp `json:"wait_max"`
+		Hits     uint64           `json:"hits"`
+		Misses   uint64           `json:"misses"`
+		Models   *task.ModelCache `json:"models"`
+		Memory   uint64           `json:"memory_used"`
+		Limit    uint64           `json:"memory_limit,omitempty"`
+		Idle     schema.Timestamp `json:"idle_timeout,omitempty"`
 	}{
-		Gpu: m.gpu,
-		N:   m.N(),
-		Max: m.max,
+		Gpu:      m.gpu,
+		N:        m.N(),
+		Max:      m.max,
+		Queued:   stats.Queued,
+		Waits:    stats.Waits,
+		WaitTime: schema.Timestamp(stats.WaitTime),
+		WaitMax:  schema.Timestamp(stats.WaitMax),
+		Hits:     m.hits.Load(),
+		Misses:   m.misses.Load(),
+		Models:   m.models,
+		Memory:   m.models.Used(),
+		Limit:    m.MemoryLimit(),
+		Idle:     schema.Timestamp(m.IdleTimeout()),
 	})
 }
 
@@ -77,28 +158,106 @@ func (m *ContextPool) String() string {
 //////////////////////////////////////////////////////////////////////////////
 // PUBLIC METHODS
 
-// Get a context from the pool, for a model
-func (m *ContextPool) Get(model *schema.Model) (*task.Context, error) {
+// Return a context with a priority for getting a context from the pool.
+// Higher priorities are served first, and the default priority is zero
+func WithPriority(ctx context.Context, priority int) context.Context {
+	return context.WithValue(ctx, priorityKey{}, priority)
+}
+
+// Set the memory limit for loaded models in bytes, or zero for no limit.
+// Idle contexts are unloaded to stay within the limit
+func (m *ContextPool) SetMemoryLimit(v uint64) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.limit = v
+}
+
+// Return the memory limit for loaded models in bytes, or zero
+func (m *ContextPool) MemoryLimit() uint64 {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.limit
+}
+
+// Set the time after which an idle context is unloaded, or zero
+// to keep idle contexts loaded
+func (m *ContextPool) SetIdleTimeout(v time.Duration) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.ttl = v
+}
+
+// Return the time after which an idle context is unloaded, or zero
+func (m *ContextPool) IdleTimeout() time.Duration {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.ttl
+}
+
+// Get a context from the pool, for a model. If all contexts are in use,
+// then wait in a queue until a context is returned to the pool, or the
+// context is done. The queue is ordered by priority (see WithPriority) and
+// then by arrival. Returns ErrDraining if the model is being drained,
+// ErrMemoryLimit if the model cannot be loaded within the memory limit, and
+// ErrClosed if the pool is closed.
+//
+// An idle context which already has the model loaded is preferred. Otherwise
+// a new context is created, or the least recently used idle context is
+// re-used, which requires the model to be loaded.
+func (m *ContextPool) Get(ctx context.Context, model *schema.Model) (*task.Context, error) {
 	// Check parameters
 	if model == nil {
 		return nil, ErrBadParameter
 	}
 
+	// Reject requests for a model which is being drained
+	if m.isDraining(model) {
+		return nil, fmt.Errorf("%w: %q", ErrDraining, model.Id)
+	}
+
 	// Get a context from the pool
-	t, ok := m.Pool.Get().(*task.Context)
+	priority, _ := ctx.Value(priorityKey{}).(int)
+	item, err := m.Pool.Wait(ctx, priority, func(item any) bool {
+		t, ok := item.(*task.Context)
+		return ok && t.Is(model)
+	})
+	if err != nil {
+		return nil, err
+	}
+	t, ok := item.(*task.Context)
 	if !ok || t == nil {
-		return nil, ErrChannelBlocked.With("unable to get a context from the pool, try again later")
+		return nil, ErrInternalAppError.With("unexpected context in the pool")
 	}
 
-	// If the model matches, return it, or else release the resources
+	// Mark the context as in use, unless the model started draining while
+	// waiting for the context
+	m.mu.Lock()
+	if m.draining[model.Id] > 0 {
+		m.mu.Unlock()
+		m.Pool.Put(t)
+		return nil, fmt.Errorf("%w: %q", ErrDraining, model.Id)
+	}
+	m.active[t] = model.Id
+	delete(m.idle, t)
+	m.mu.Unlock()
+
+	// If the model matches, return it
 	if t.Is(model) {
+		m.hits.Add(1)
 		return t, nil
-	} else if err := t.Close(); err != nil {
+	}
+
+	// Release the resources. The context is returned to the pool on error,
+	// so it can be re-used
+	m.misses.Add(1)
+	if err := t.Close(); err != nil {
+		m.Put(t)
 		return nil, err
 	}
 
 	// Initialise the context
-	if err := t.Init(m.path, model, m.gpu); err != nil {
+	if err := m.init(t, model); err != nil {
+		m.Put(t)
 		return nil, err
 	}
 
@@ -106,13 +265,194 @@ func (m *ContextPool) Get(model *schema.Model) (*task.Context, error) {
 	return t, nil
 }
 
-// Put a context back into the pool
+// Put a context back into the pool. A nil context is ignored
 func (m *ContextPool) Put(ctx *task.Context) {
+	if ctx == nil {
+		return
+	}
+	m.mu.Lock()
+	delete(m.active, ctx)
+	m.idle[ctx] = time.Now()
+	close(m.release)
+	m.release = make(chan struct{})
+	m.mu.Unlock()
+
 	m.Pool.Put(ctx)
 }
 
-// Drain the pool of all contexts for a model, freeing resources
-func (m *ContextPool) Drain(model *schema.Model) error {
-	fmt.Println("TODO: DRAIN", model.Id)
+// Drain the pool of all contexts for a model, freeing resources. Requests
+// for the model are rejected while draining. Waits for contexts which are in
+// use to be returned to the pool, and then calls fn, which can be nil, before
+// accepting requests for the model again. Returns ErrChannelBlocked if the
+// context is done before all contexts have been returned.
+func (m *ContextPool) Drain(ctx context.Context, model *schema.Model, fn func() error) error {
+	if model == nil {
+		return ErrBadParameter
+	}
+
+	// Reject new requests for the model
+	m.mu.Lock()
+	m.draining[model.Id]++
+	m.mu.Unlock()
+	defer func() {
+		m.mu.Lock()
+		if m.draining[model.Id]--; m.draining[model.Id] <= 0 {
+			delete(m.draining, model.Id)
+		}
+		m.mu.Unlock()
+	}()
+
+	// Wait for contexts in use to be returned
+	for {
+		m.mu.Lock()
+		n, release := m.inUse(model), m.release
+		m.mu.Unlock()
+		if n == 0 {
+			break
+		}
+		select {
+		case <-ctx.Done():
+			return ErrChannelBlocked.Withf("model %q is in use", model.Id)
+		case <-release:
+		}
+	}
+
+	// Free the idle contexts for the model, and return them to the pool
+	var result error
+	for _, item := range m.Pool.take(func(item any) bool {
+		t, ok := item.(*task.Context)
+		return ok && t.Is(model)
+	}) {
+		result = errors.Join(result, m.unload(item))
+	}
+	if result != nil {
+		return result
+	}
+
+	// Call the function while requests are still rejected
+	if fn != nil {
+		return fn()
+	}
+
+	// Return success
+	return nil
+}
+
+//////////////////////////////////////////////////////////////////////////////
+// PRIVATE METHODS
+
+// Initialise a context for a model. If there is a memory limit, then the
+// least recently used idle contexts are unloaded until the model fits, and
+// the memory is reserved while the model is loaded, so that models can be
+// loaded at the same time within the limit
+func (m *ContextPool) init(t *task.Context, model *schema.Model) error {
+	need, err := m.reserve(model)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		m.mu.Lock()
+		m.reserved -= need
+		m.mu.Unlock()
+	}()
+
+	// Initialise the context
+	return t.Init(m.models, model)
+}
+
+// Unload idle contexts until the model fits within the memory limit, and
+// reserve the memory needed. Returns the memory reserved, which is zero
+// if there is no limit
+func (m *ContextPool) reserve(model *schema.Model) (uint64, error) {
+	for {
+		need, err := m.models.Need(model)
+		if err != nil {
+			return 0, err
+		}
+
+		// Reserve the memory if the model fits
+		m.mu.Lock()
+		limit, used := m.limit, m.models.Used()+m.reserved
+		if limit == 0 {
+			m.mu.Unlock()
+			return 0, nil
+		} else if need > limit {
+			m.mu.Unlock()
+			return 0, ErrBadParameter.Withf("model %q needs %d bytes, which exceeds the memory limit of %d bytes", model.Id, need, limit)
+		} else if used+need <= limit {
+			m.reserved += need
+			m.mu.Unlock()
+			return need, nil
+		}
+		m.mu.Unlock()
+
+		// Unload the least recently used idle context
+		item := m.Pool.evict(func(item any) bool {
+			t, ok := item.(*task.Context)
+			return ok && t.Loaded()
+		})
+		if item == nil {
+			return 0, fmt.Errorf("%w: model %q needs %d bytes, but %d of %d bytes are in use", ErrMemoryLimit, model.Id, need, used, limit)
+		}
+		if err := m.unload(item); err != nil {
+			return 0, err
+		}
+	}
+}
+
+// Unload contexts which have been idle for longer than the idle timeout,
+// until the pool is closed
+func (m *ContextPool) run() {
+	ticker := time.NewTicker(expireInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-m.done:
+			return
+		case now := <-ticker.C:
+			if ttl := m.IdleTimeout(); ttl > 0 {
+				for _, item := range m.Pool.take(func(item any) bool {
+					t, ok := item.(*task.Context)
+					return ok && t.Loaded() && now.Sub(m.idleSince(t)) >= ttl
+				}) {
+					m.unload(item)
+				}
+			}
+		}
+	}
+}
+
+// Release the resources for an idle context which has been removed from the
+// pool, and return it to the pool
+func (m *ContextPool) unload(item any) error {
+	defer m.Pool.Put(item)
+	if t, ok := item.(*task.Context); ok {
+		return t.Close()
+	}
 	return nil
 }
+
+// Return the time an idle context was returned to the pool
+func (m *ContextPool) idleSince(t *task.Context) time.Time {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.idle[t]
+}
+
+// Return true if a model is being drained
+func (m *ContextPool) isDraining(model *schema.Model) bool {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.draining[model.Id] > 0
+}
+
+// Return the number of contexts in use for a model
+func (m *ContextPool) inUse(model *schema.Model) int {
+	var n int
+	for _, id := range m.active {
+		if id == model.Id {
+			n++
+		}
+	}
+	return n
+}
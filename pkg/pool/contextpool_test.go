@@ -1,17 +1,26 @@
 package pool_test
 
 import (
+	"context"
+	"encoding/binary"
+	"encoding/json"
+	"os"
+	"path/filepath"
 	"testing"
 
 	// Packages
 	pool "github.com/mutablelogic/go-whisper/pkg/pool"
 	schema "github.com/mutablelogic/go-whisper/pkg/schema"
+	assert "github.com/stretchr/testify/assert"
+
+	// Namespace imports
+	. "github.com/djthorpe/go-errors"
 )
 
 func Test_contextpool_001(t *testing.T) {
 	var pool = pool.NewContextPool(t.TempDir(), 2, 0)
 
-	model1, err := pool.Get(&schema.Model{
+	model1, err := pool.Get(context.Background(), &schema.Model{
 		Id: "model1",
 	})
 	if err != nil {
@@ -22,7 +31,7 @@ func Test_contextpool_001(t *testing.T) {
 	}
 	t.Log("Got model1", model1)
 
-	model2, err := pool.Get(&schema.Model{
+	model2, err := pool.Get(context.Background(), &schema.Model{
 		Id: "model2",
 	})
 	if err != nil {
@@ -35,7 +44,7 @@ func Test_contextpool_001(t *testing.T) {
 
 	pool.Put(model1)
 
-	model3, err := pool.Get(&schema.Model{
+	model3, err := pool.Get(context.Background(), &schema.Model{
 		Id: "model1",
 	})
 	if err != nil {
@@ -52,3 +61,60 @@ func Test_contextpool_001(t *testing.T) {
 	t.Log("Closing the pool")
 	pool.Close()
 }
+
+func Test_contextpool_002(t *testing.T) {
+	assert := assert.New(t)
+	var pool = pool.NewContextPool(t.TempDir(), 2, 0)
+	defer pool.Close()
+
+	// Requests for the model are rejected while it is drained
+	model := &schema.Model{Id: "model1"}
+	called := false
+	assert.NoError(pool.Drain(context.Background(), model, func() error {
+		called = true
+		_, err := pool.Get(context.Background(), model)
+		assert.ErrorIs(err, ErrChannelBlocked)
+		return nil
+	}))
+	assert.True(called)
+
+	// The error from the function is returned
+	assert.ErrorIs(pool.Drain(context.Background(), model, func() error {
+		return ErrNotFound
+	}), ErrNotFound)
+}
+
+func Test_contextpool_003(t *testing.T) {
+	assert := assert.New(t)
+	dir := t.TempDir()
+	var pool = pool.NewContextPool(dir, 2, 0)
+	defer pool.Close()
+
+	// Create a model file with the header of the tiny model
+	w, err := os.Create(filepath.Join(dir, "ggml-tiny.bin"))
+	if !assert.NoError(err) {
+		t.SkipNow()
+	}
+	binary.Write(w, binary.LittleEndian, []uint32{0x67676d6c, 51865, 1500, 384, 6, 4, 448, 384, 6, 4, 80, 1})
+	w.Close()
+
+	// The model does not fit in the memory limit
+	pool.SetMemoryLimit(1024)
+	_, err = pool.Get(context.Background(), &schema.Model{Id: "tiny", Path: "ggml-tiny.bin"})
+	assert.ErrorIs(err, ErrBadParameter)
+
+	// The memory limit is reported
+	data, err := json.Marshal(pool)
+	assert.NoError(err)
+	assert.Contains(string(data), `"memory_limit":1024`)
+	assert.Contains(string(data), `"memory_used":0`)
+}
+
+func Test_contextpool_004(t *testing.T) {
+	assert := assert.New(t)
+	var pool = pool.NewContextPool(t.TempDir(), 2, 0)
+
+	// The pool can be closed more than once
+	assert.NoError(pool.Close())
+	assert.NoError(pool.Close())
+}
@@ -0,0 +1,18 @@
+package pool
+
+import (
+	// Namespace imports
+	. "github.com/djthorpe/go-errors"
+)
+
+var (
+	// The pool is closed, and no more contexts are returned
+	ErrClosed = ErrChannelBlocked.With("pool is closed")
+
+	// The model is being drained, and requests for it are rejected
+	ErrDraining = ErrChannelBlocked.With("model is being drained")
+
+	// The model cannot be loaded within the memory limit, as the memory
+	// is used by contexts which are in use
+	ErrMemoryLimit = ErrChannelBlocked.With("memory limit reached")
+)
@@ -1,9 +1,13 @@
 package pool
 
 import (
+	"container/heap"
+	"context"
 	"errors"
 	"io"
+	"slices"
 	"sync"
+	"time"
 )
 
 ////////////////////////////////////////////////////////////////////////////////
@@ -11,7 +15,8 @@ import (
 
 // Pool is a pool of context objects, up to a maximum number
 // This acts as a cache so we don't need to reload models
-// If the pool is full, then Get will return nil
+// If the pool is full, then Get will return nil and Wait will wait
+// until an object is returned to the pool
 type Pool struct {
 	sync.RWMutex
 
@@ -21,11 +26,43 @@ type Pool struct {
 	n     int
 	max   int
 	empty bool
+
+	// Queue of waiters
+	waiters waiters
+	seq     uint64
+
+	// Wait statistics
+	waits    uint64
+	waitTime time.Duration
+	waitMax  time.Duration
 }
 
 // Create a new object to place in the pool
 type NewFunc func() any
 
+// Return true if an object in the pool matches what is needed
+type MatchFunc func(any) bool
+
+// Wait statistics
+type Stats struct {
+	Queued   int           // Number of waiters in the queue
+	Waits    uint64        // Number of times Wait returned an object after waiting
+	WaitTime time.Duration // Mean time waited
+	WaitMax  time.Duration // Maximum time waited
+}
+
+// A waiter in the queue
+type waiter struct {
+	ch       chan any
+	priority int
+	seq      uint64
+	index    int
+	ts       time.Time
+}
+
+// Priority queue of waiters
+type waiters []*waiter
+
 ////////////////////////////////////////////////////////////////////////////////
 // LIFECYCLE
 
@@ -52,8 +89,10 @@ func NewPool(max int, fn NewFunc) *Pool {
 func (m *Pool) Close() error {
 	var result error
 
-	// We repeatedly call Get until we get nil
+	// Set drain mode, and wake any waiters
 	m.setEmpty(true)
+
+	// We repeatedly call Get until we get nil
 	for {
 		ctx := m.Get()
 		if ctx == nil {
@@ -76,49 +115,235 @@ func (m *Pool) Close() error {
 func (m *Pool) Get() any {
 	m.Lock()
 	defer m.Unlock()
+	return m.get(nil)
+}
 
-	// Create a new item
-	var item any
-	if len(m.pool) > 0 {
-		item, m.pool = m.pool[0], m.pool[1:]
-	} else {
-		item = m.fn()
-		if item != nil {
-			m.n++
+// Returns an item, waiting until an item is returned to the pool if the
+// maximum number of contexts has been reached. Waiters with a higher priority
+// are served first, and waiters with the same priority are served in the
+// order they arrived. Returns an error if the context is done before an item
+// is available, or the pool is closed.
+//
+// If match is not nil, then an idle item which matches is preferred. Otherwise
+// a new item is created, or the least recently used idle item is returned.
+func (m *Pool) Wait(ctx context.Context, priority int, match MatchFunc) (any, error) {
+	m.Lock()
+
+	// Return an item if one is available and nobody is waiting
+	if len(m.waiters) == 0 {
+		if item := m.get(match); item != nil {
+			m.Unlock()
+			return item, nil
 		}
 	}
-	return item
+	if m.empty {
+		m.Unlock()
+		return nil, ErrClosed
+	}
+
+	// Join the queue
+	w := &waiter{
+		ch:       make(chan any, 1),
+		priority: priority,
+		seq:      m.seq,
+		ts:       time.Now(),
+	}
+	m.seq++
+	heap.Push(&m.waiters, w)
+	m.Unlock()
+
+	// Wait for an item or for the context to be done
+	select {
+	case item, ok := <-w.ch:
+		if !ok {
+			return nil, ErrClosed
+		}
+		return item, nil
+	case <-ctx.Done():
+		m.Lock()
+		if w.index >= 0 {
+			// Leave the queue
+			heap.Remove(&m.waiters, w.index)
+			m.Unlock()
+		} else {
+			// An item was handed over at the same time, so return it to the pool
+			m.Unlock()
+			if item, ok := <-w.ch; ok {
+				m.Put(item)
+			}
+		}
+		return nil, ctx.Err()
+	}
 }
 
-// Puts the context back in the pool
+// Puts the context back in the pool, or hands it to the next waiter
 func (m *Pool) Put(ctx any) {
 	m.Lock()
 	defer m.Unlock()
 
-	if ctx != nil {
+	if ctx == nil {
+		return
+	}
+	if len(m.waiters) > 0 {
+		w := heap.Pop(&m.waiters).(*waiter)
+		m.wait(time.Since(w.ts))
+		w.ch <- ctx
+	} else {
 		m.pool = append(m.pool, ctx)
-		m.n--
 	}
 }
 
-// Return the number of contexts in the pool
+// Return the number of contexts which have been created
 func (m *Pool) N() int {
 	m.RLock()
 	defer m.RUnlock()
 	return m.n
 }
 
+// Return the wait statistics
+func (m *Pool) Stats() Stats {
+	m.RLock()
+	defer m.RUnlock()
+	stats := Stats{
+		Queued:  len(m.waiters),
+		Waits:   m.waits,
+		WaitMax: m.waitMax,
+	}
+	if m.waits > 0 {
+		stats.WaitTime = m.waitTime / time.Duration(m.waits)
+	}
+	return stats
+}
+
 ////////////////////////////////////////////////////////////////////////////////
 // PRIVATE METHODS
 
+// Return an item from the pool, or create a new one. Idle items are
+// ordered from least to most recently used. If match is nil, then the
+// least recently used item is returned before creating a new one
+func (m *Pool) get(match MatchFunc) any {
+	// Return the most recently used item which matches
+	if match != nil {
+		for i := len(m.pool) - 1; i >= 0; i-- {
+			if item := m.pool[i]; match(item) {
+				m.pool = append(m.pool[:i], m.pool[i+1:]...)
+				return item
+			}
+		}
+	}
+
+	// Return the least recently used item
+	if match == nil && len(m.pool) > 0 {
+		item := m.pool[0]
+		m.pool = m.pool[1:]
+		return item
+	}
+
+	// Create a new item
+	if item := m.fn(); item != nil {
+		m.n++
+		return item
+	}
+
+	// Evict the least recently used item
+	if len(m.pool) > 0 {
+		item := m.pool[0]
+		m.pool = m.pool[1:]
+		return item
+	}
+
+	// No item is available
+	return nil
+}
+
+// Remove and return the idle items which match
+func (m *Pool) take(match MatchFunc) []any {
+	m.Lock()
+	defer m.Unlock()
+
+	var result []any
+	m.pool = slices.DeleteFunc(m.pool, func(item any) bool {
+		if match(item) {
+			result = append(result, item)
+			return true
+		}
+		return false
+	})
+	return result
+}
+
+// Remove and return the least recently used idle item which matches,
+// or nil if there is no idle item which matches
+func (m *Pool) evict(match MatchFunc) any {
+	m.Lock()
+	defer m.Unlock()
+
+	for i, item := range m.pool {
+		if match(item) {
+			m.pool = slices.Delete(m.pool, i, i+1)
+			return item
+		}
+	}
+	return nil
+}
+
+// Record the time waited
+func (m *Pool) wait(d time.Duration) {
+	m.waits++
+	m.waitTime += d
+	m.waitMax = max(m.waitMax, d)
+}
+
 // Return true if pool is at capacity
 func (m *Pool) atCapacity() bool {
 	return m.n >= m.max || m.empty
 }
 
-// Set pool in drain mode, no more contexts will be added
+// Set pool in drain mode, no more contexts will be added and
+// any waiters are released
 func (m *Pool) setEmpty(v bool) {
 	m.Lock()
 	defer m.Unlock()
 	m.empty = v
+	if v {
+		for len(m.waiters) > 0 {
+			close(heap.Pop(&m.waiters).(*waiter).ch)
+		}
+	}
+}
+
+////////////////////////////////////////////////////////////////////////////////
+// WAITERS
+
+func (w waiters) Len() int {
+	return len(w)
+}
+
+func (w waiters) Less(i, j int) bool {
+	if w[i].priority != w[j].priority {
+		return w[i].priority > w[j].priority
+	}
+	return w[i].seq < w[j].seq
+}
+
+func (w waiters) Swap(i, j int) {
+	w[i], w[j] = w[j], w[i]
+	w[i].index = i
+	w[j].index = j
+}
+
+func (w *waiters) Push(x any) {
+	item := x.(*waiter)
+	item.index = len(*w)
+	*w = append(*w, item)
+}
+
+func (w *waiters) Pop() any {
+	old := *w
+	n := len(old)
+	item := old[n-1]
+	old[n-1] = nil
+	item.index = -1
+	*w = old[:n-1]
+	return item
 }
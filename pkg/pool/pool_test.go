@@ -1,11 +1,17 @@
 package pool_test
 
 import (
+	"context"
 	"sync"
 	"testing"
+	"time"
 
 	// Packages
 	"github.com/mutablelogic/go-whisper/pkg/pool"
+	assert "github.com/stretchr/testify/assert"
+
+	// Namespace imports
+	. "github.com/djthorpe/go-errors"
 )
 
 type Item struct {
@@ -72,3 +78,121 @@ func Test_basepool_002(t *testing.T) {
 	t.Log("Closing the pool")
 	pool.Close()
 }
+
+func Test_basepool_003(t *testing.T) {
+	assert := assert.New(t)
+	var pool = pool.NewPool(1, func() any {
+		return &Item{t, false}
+	})
+
+	// Get the only item
+	item, err := pool.Wait(context.Background(), 0, nil)
+	assert.NoError(err)
+	assert.NotNil(item)
+	assert.Nil(pool.Get())
+
+	// Wait with a deadline
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	_, err = pool.Wait(ctx, 0, nil)
+	assert.ErrorIs(err, context.DeadlineExceeded)
+	assert.Equal(0, pool.Stats().Queued)
+
+	// Queue waiters in order, with one waiter at a higher priority
+	var wg sync.WaitGroup
+	var order []int
+	var mu sync.Mutex
+	for i, priority := range []int{0, 0, 1, 0} {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			item, err := pool.Wait(context.Background(), priority, nil)
+			assert.NoError(err)
+			mu.Lock()
+			order = append(order, i)
+			mu.Unlock()
+			pool.Put(item)
+		}()
+		for pool.Stats().Queued != i+1 {
+			time.Sleep(time.Millisecond)
+		}
+	}
+
+	// Release the item, which is passed to each waiter in turn
+	pool.Put(item)
+	wg.Wait()
+	assert.Equal([]int{2, 0, 1, 3}, order)
+
+	// Check statistics
+	stats := pool.Stats()
+	assert.Equal(0, stats.Queued)
+	assert.Equal(uint64(4), stats.Waits)
+	assert.Greater(stats.WaitMax, time.Duration(0))
+	assert.Equal(1, pool.N())
+	assert.NoError(pool.Close())
+}
+
+func Test_basepool_004(t *testing.T) {
+	assert := assert.New(t)
+	var pool = pool.NewPool(1, func() any {
+		return &Item{t, false}
+	})
+
+	// Get the only item
+	item := pool.Get()
+	assert.NotNil(item)
+
+	// Closing the pool releases waiters
+	errs := make(chan error)
+	go func() {
+		_, err := pool.Wait(context.Background(), 0, nil)
+		errs <- err
+	}()
+	for pool.Stats().Queued == 0 {
+		time.Sleep(time.Millisecond)
+	}
+	assert.NoError(pool.Close())
+	assert.ErrorIs(<-errs, ErrChannelBlocked)
+
+	// No waiting once the pool is closed
+	_, err := pool.Wait(context.Background(), 0, nil)
+	assert.ErrorIs(err, ErrChannelBlocked)
+}
+
+func Test_basepool_005(t *testing.T) {
+	assert := assert.New(t)
+	var n int
+	var p = pool.NewPool(2, func() any {
+		n++
+		item := n
+		return &item
+	})
+	match := func(v *int) pool.MatchFunc {
+		return func(item any) bool {
+			return item == v
+		}
+	}
+
+	// Create two items, and return them to the pool
+	a, err := p.Wait(context.Background(), 0, match(nil))
+	assert.NoError(err)
+	b, err := p.Wait(context.Background(), 0, match(nil))
+	assert.NoError(err)
+	assert.NotSame(a, b)
+	p.Put(a)
+	p.Put(b)
+
+	// Prefer the matching item, even though it was not the least recently used
+	item, err := p.Wait(context.Background(), 0, match(b.(*int)))
+	assert.NoError(err)
+	assert.Same(b, item)
+	p.Put(item)
+
+	// Evict the least recently used item when nothing matches
+	item, err = p.Wait(context.Background(), 0, match(nil))
+	assert.NoError(err)
+	assert.Same(a, item)
+	assert.Equal(2, p.N())
+	p.Put(item)
+	assert.NoError(p.Close())
+}
@@ -0,0 +1,60 @@
+package schema
+
+import (
+	"encoding/json"
+	"time"
+)
+
+//////////////////////////////////////////////////////////////////////////////
+// TYPES
+
+type JobStatus string
+
+type Job struct {
+	Id        string         `json:"id" writer:",width:24"`
+	Status    JobStatus      `json:"status" writer:",width:10"`
+	Model     string         `json:"model" writer:",width:28,wrap"`
+	Task      string         `json:"task" writer:",width:10"`
+	Language  string         `json:"language,omitempty" writer:",width:8"`
+	Progress  float64        `json:"progress" writer:",right,width:8"`
+	Created   time.Time      `json:"created"`
+	Started   *time.Time     `json:"started,omitempty" writer:"-"`
+	Completed *time.Time     `json:"completed,omitempty" writer:"-"`
+	Error     string         `json:"error,omitempty" writer:",wrap,width:40"`
+	Result    *Transcription `json:"result,omitempty" writer:"-"`
+}
+
+//////////////////////////////////////////////////////////////////////////////
+// GLOBALS
+
+const (
+	JobQueued    JobStatus = "queued"    // Job is waiting for a worker
+	JobRunning   JobStatus = "running"   // Job is being run by a worker
+	JobCompleted JobStatus = "completed" // Job completed and has a result
+	JobFailed    JobStatus = "failed"    // Job failed with an error
+	JobCancelled JobStatus = "cancelled" // Job was cancelled
+)
+
+//////////////////////////////////////////////////////////////////////////////
+// STRINGIFY
+
+func (j *Job) String() string {
+	data, err := json.MarshalIndent(j, "", "  ")
+	if err != nil {
+		return err.Error()
+	}
+	return string(data)
+}
+
+//////////////////////////////////////////////////////////////////////////////
+// PUBLIC METHODS
+
+// Returns true if the job has completed, failed or been cancelled
+func (s JobStatus) Done() bool {
+	switch s {
+	case JobCompleted, JobFailed, JobCancelled:
+		return true
+	default:
+		return false
+	}
+}
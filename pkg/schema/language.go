@@ -0,0 +1,27 @@
+package schema
+
+import (
+	"encoding/json"
+)
+
+//////////////////////////////////////////////////////////////////////////////
+// TYPES
+
+// Language is a detected language, with the probability that the
+// audio is in the language
+type Language struct {
+	Language    string  `json:"language" writer:",width:8"`
+	Name        string  `json:"name" writer:",width:20"`
+	Probability float32 `json:"probability" writer:",right,width:8"`
+}
+
+//////////////////////////////////////////////////////////////////////////////
+// STRINGIFY
+
+func (l *Language) String() string {
+	data, err := json.MarshalIndent(l, "", "  ")
+	if err != nil {
+		return err.Error()
+	}
+	return string(data)
+}
@@ -13,6 +13,25 @@ type Segment struct {
 	End         Timestamp `json:"end" writer:",right,width:5"`
 	Text        string    `json:"text" writer:",wrap,width:70"`
 	SpeakerTurn bool      `json:"speaker_turn,omitempty"` // TODO
+	Speaker     string    `json:"speaker,omitempty"`
+	Words       []*Word   `json:"words,omitempty" writer:"-"`
+
+	// Confidence metrics, where a low average log probability, a high
+	// compression ratio (repeated text) or a high no-speech probability
+	// indicates an unreliable segment
+	Temperature      float32 `json:"temperature" writer:"-"`
+	AvgLogProb       float32 `json:"avg_logprob" writer:"-"`
+	CompressionRatio float32 `json:"compression_ratio" writer:"-"`
+	NoSpeechProb     float32 `json:"no_speech_prob" writer:"-"`
+}
+
+// Word is a word in a segment, with timestamps and the average
+// probability of the tokens in the word
+type Word struct {
+	Word        string    `json:"word" writer:",width:30"`
+	Start       Timestamp `json:"start" writer:",right,width:5"`
+	End         Timestamp `json:"end" writer:",right,width:5"`
+	Probability float32   `json:"probability" writer:",right,width:5"`
 }
 
 //////////////////////////////////////////////////////////////////////////////
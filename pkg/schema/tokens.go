@@ -0,0 +1,28 @@
+package schema
+
+import (
+	"encoding/json"
+)
+
+//////////////////////////////////////////////////////////////////////////////
+// TYPES
+
+// Tokens is text and the tokens of the text for a model, with the maximum
+// number of tokens which can be used as a prompt
+type Tokens struct {
+	Model           string  `json:"model"`
+	Text            string  `json:"text"`
+	Tokens          []int32 `json:"tokens"`
+	MaxPromptTokens int     `json:"n_max_text_ctx"`
+}
+
+//////////////////////////////////////////////////////////////////////////////
+// STRINGIFY
+
+func (t *Tokens) String() string {
+	data, err := json.MarshalIndent(t, "", "  ")
+	if err != nil {
+		return err.Error()
+	}
+	return string(data)
+}
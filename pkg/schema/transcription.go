@@ -16,6 +16,7 @@ type Transcription struct {
 	Duration Timestamp  `json:"duration,omitempty" writer:",width:8,right"`
 	Text     string     `json:"text,omitempty" writer:",width:60,wrap"`
 	Segments []*Segment `json:"segments,omitempty" writer:",width:40,wrap"`
+	Words    []*Word    `json:"words,omitempty" writer:"-"`
 }
 
 //////////////////////////////////////////////////////////////////////////////
@@ -33,3 +34,13 @@ func (t Timestamp) MarshalJSON() ([]byte, error) {
 	// We convert durations into float64 seconds
 	return json.Marshal(time.Duration(t).Seconds())
 }
+
+func (t *Timestamp) UnmarshalJSON(data []byte) error {
+	// We convert float64 seconds into durations
+	var v float64
+	if err := json.Unmarshal(data, &v); err != nil {
+		return err
+	}
+	*t = Timestamp(v * float64(time.Second))
+	return nil
+}
@@ -0,0 +1,270 @@
+package segmenter
+
+import (
+	"context"
+	"errors"
+	"io"
+	"strings"
+	"syscall"
+	"time"
+
+	// Packages
+	ffmpeg "github.com/mutablelogic/go-media/pkg/ffmpeg"
+	ff "github.com/mutablelogic/go-media/sys/ffmpeg61"
+
+	// Namespace imports
+	. "github.com/djthorpe/go-errors"
+)
+
+//////////////////////////////////////////////////////////////////////////////
+// TYPES
+
+// The input demuxes media from a reader, and decodes a single audio stream.
+// It replaces the media reader in go-media, which keeps its format context
+// private, so that it cannot seek or read the metadata of a stream. The
+// go-media bindings and resampler are still used to decode the stream
+type input struct {
+	avio *ff.AVIOContextEx
+	ctx  *ff.AVFormatContext
+}
+
+// Read and seek callbacks for the demuxer
+type callback struct {
+	r io.Reader
+}
+
+// FrameFunc is called with each decoded frame
+type frameFunc func(*ffmpeg.Frame) error
+
+//////////////////////////////////////////////////////////////////////////////
+// GLOBALS
+
+const (
+	// Size of the buffer for reading media
+	bufSize = 4096
+
+	// Seek to the keyframe at or before the timestamp (AVSEEK_FLAG_BACKWARD)
+	seekBackward = 1
+)
+
+//////////////////////////////////////////////////////////////////////////////
+// LIFECYCLE
+
+// Open media from a reader, and read the stream information
+func newInput(r io.Reader) (*input, error) {
+	input := new(input)
+
+	// Allocate the AVIO context
+	if input.avio = ff.AVFormat_avio_alloc_context(bufSize, false, &callback{r}); input.avio == nil {
+		return nil, ErrInternalAppError.With("failed to allocate avio context")
+	}
+
+	// Open the media and find the streams
+	if ctx, err := ff.AVFormat_open_reader(input.avio, nil, nil); err != nil {
+		ff.AVFormat_avio_context_free(input.avio)
+		return nil, err
+	} else {
+		input.ctx = ctx
+	}
+	if err := ff.AVFormat_find_stream_info(input.ctx, nil); err != nil {
+		return nil, errors.Join(err, input.Close())
+	}
+
+	// Return success
+	return input, nil
+}
+
+// Close the input
+func (input *input) Close() error {
+	if input.ctx != nil {
+		ff.AVFormat_close_input(input.ctx)
+	}
+	if input.avio != nil {
+		ff.AVFormat_avio_context_free(input.avio)
+	}
+	input.ctx = nil
+	input.avio = nil
+	return nil
+}
+
+//////////////////////////////////////////////////////////////////////////////
+// PUBLIC METHODS
+
+// Return the duration of the media, or zero if the duration is unknown
+func (input *input) Duration() time.Duration {
+	if duration := input.ctx.Duration(); duration > 0 {
+		return time.Duration(duration) * time.Second / time.Duration(ff.AV_TIME_BASE)
+	}
+	return 0
+}
+
+// Return the index of the best audio stream, or -1 if there is no
+// audio stream
+func (input *input) BestStream() int {
+	if stream, _, err := ff.AVFormat_find_best_stream(input.ctx, ff.AVMEDIA_TYPE_AUDIO, -1, -1); err == nil {
+		return input.ctx.Stream(stream).Index()
+	}
+	return -1
+}
+
+// Return the index of the first audio stream with a language tag, such as
+// "eng", or -1 if there is no audio stream with the language
+func (input *input) LanguageStream(language string) int {
+	for _, stream := range input.ctx.Streams() {
+		if stream.CodecPar().CodecType() != ff.AVMEDIA_TYPE_AUDIO {
+			continue
+		}
+		if strings.EqualFold(streamMetadata(stream, "language"), language) {
+			return stream.Index()
+		}
+	}
+	return -1
+}
+
+// Return an audio stream by index
+func (input *input) Stream(index int) (*ff.AVStream, error) {
+	stream := input.ctx.Stream(index)
+	if stream == nil {
+		return nil, ErrNotFound.Withf("stream %d", index)
+	} else if stream.CodecPar().CodecType() != ff.AVMEDIA_TYPE_AUDIO {
+		return nil, ErrBadParameter.Withf("stream %d is not an audio stream", index)
+	}
+	return stream, nil
+}
+
+// Seek to the keyframe at or before the timestamp. The decoded frames have
+// timestamps, so that the samples before the timestamp can be trimmed
+func (input *input) Seek(ts time.Duration) error {
+	return ff.AVFormat_seek_frame(input.ctx, -1, int64(ts/(time.Second/ff.AV_TIME_BASE)), seekBackward)
+}
+
+// Decode an audio stream, resampling each frame with the parameters and
+// calling fn, until the end of the stream, or until fn returns io.EOF
+func (input *input) Decode(ctx context.Context, stream *ff.AVStream, par *ffmpeg.Par, fn frameFunc) error {
+	// Create the decoder
+	codec := ff.AVCodec_find_decoder(stream.CodecPar().CodecID())
+	if codec == nil {
+		return ErrNotImplemented.Withf("no decoder for stream %d", stream.Index())
+	}
+	decoder := ff.AVCodec_alloc_context(codec)
+	if decoder == nil {
+		return ErrInternalAppError.With("failed to allocate codec context")
+	}
+	defer ff.AVCodec_free_context(decoder)
+	if err := ff.AVCodec_parameters_to_context(decoder, stream.CodecPar()); err != nil {
+		return err
+	} else if err := ff.AVCodec_open(decoder, codec, nil); err != nil {
+		return err
+	}
+
+	// Create the resampler, and the packet and frame
+	re, err := ffmpeg.NewRe(par, false)
+	if err != nil {
+		return err
+	}
+	defer re.Close()
+	packet := ff.AVCodec_packet_alloc()
+	if packet == nil {
+		return ErrInternalAppError.With("failed to allocate packet")
+	}
+	defer ff.AVCodec_packet_free(packet)
+	frame := ff.AVUtil_frame_alloc()
+	if frame == nil {
+		return ErrInternalAppError.With("failed to allocate frame")
+	}
+	defer ff.AVUtil_frame_free(frame)
+
+	// Decode packets from the stream
+	for {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		if err := ff.AVFormat_read_frame(input.ctx, packet); errors.Is(err, io.EOF) {
+			break
+		} else if errors.Is(err, syscall.EAGAIN) {
+			continue
+		} else if err != nil {
+			return err
+		}
+		var err error
+		if packet.StreamIndex() == stream.Index() {
+			err = decode(decoder, packet, frame, stream.TimeBase(), re, fn)
+		}
+		ff.AVCodec_packet_unref(packet)
+		if errors.Is(err, io.EOF) {
+			return nil
+		} else if err != nil {
+			return err
+		}
+	}
+
+	// Flush the decoder and the resampler
+	if err := decode(decoder, nil, frame, stream.TimeBase(), re, fn); errors.Is(err, io.EOF) {
+		return nil
+	} else if err != nil {
+		return err
+	}
+	if dest, err := re.Frame(nil); err != nil {
+		return err
+	} else if dest != nil {
+		if err := fn(dest); err != nil && !errors.Is(err, io.EOF) {
+			return err
+		}
+	}
+
+	// Return success
+	return nil
+}
+
+//////////////////////////////////////////////////////////////////////////////
+// PRIVATE METHODS
+
+// Send a packet to the decoder, or flush the decoder if the packet is nil,
+// and call fn with each resampled frame
+func decode(decoder *ff.AVCodecContext, packet *ff.AVPacket, frame *ff.AVFrame, tb ff.AVRational, re *ffmpeg.Re, fn frameFunc) error {
+	if err := ff.AVCodec_send_packet(decoder, packet); err != nil {
+		return err
+	}
+	for {
+		if err := ff.AVCodec_receive_frame(decoder, frame); errors.Is(err, syscall.EAGAIN) || errors.Is(err, io.EOF) {
+			return nil
+		} else if err != nil {
+			return err
+		}
+		frame.SetTimeBase(tb)
+		dest, err := re.Frame((*ffmpeg.Frame)(frame))
+		if err == nil && dest != nil {
+			err = fn(dest)
+		}
+		ff.AVUtil_frame_unref(frame)
+		if err != nil {
+			return err
+		}
+	}
+}
+
+func (r *callback) Reader(buf []byte) int {
+	n, err := r.r.Read(buf)
+	if n == 0 && err != nil {
+		return ff.AVERROR_EOF
+	}
+	return n
+}
+
+func (r *callback) Seeker(offset int64, whence int) int64 {
+	seeker, ok := r.r.(io.Seeker)
+	if !ok {
+		return -1
+	}
+	switch whence &^ ff.AVSEEK_FORCE {
+	case io.SeekStart, io.SeekCurrent, io.SeekEnd:
+		if n, err := seeker.Seek(offset, whence&^ff.AVSEEK_FORCE); err == nil {
+			return n
+		}
+	}
+	return -1
+}
+
+func (r *callback) Writer([]byte) int {
+	return ff.AVERROR_EOF
+}
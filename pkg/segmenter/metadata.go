@@ -0,0 +1,36 @@
+package segmenter
+
+import (
+	"unsafe"
+
+	// Packages
+	ff "github.com/mutablelogic/go-media/sys/ffmpeg61"
+)
+
+///////////////////////////////////////////////////////////////////////////////
+// CGO
+
+/*
+#cgo pkg-config: libavformat
+#include <stdlib.h>
+#include <libavformat/avformat.h>
+*/
+import "C"
+
+///////////////////////////////////////////////////////////////////////////////
+// PRIVATE METHODS
+
+// Return a metadata value for a stream, or an empty string if the key
+// does not exist. The go-media bindings only expose the metadata of the
+// container: AVStream has no accessor for its metadata, and an AVDictionary
+// cannot be made from a C pointer outside of go-media, so the dictionary
+// is read here. This can be replaced when go-media exposes stream metadata
+func streamMetadata(stream *ff.AVStream, key string) string {
+	ckey := C.CString(key)
+	defer C.free(unsafe.Pointer(ckey))
+	entry := C.av_dict_get((*C.AVStream)(unsafe.Pointer(stream)).metadata, ckey, nil, 0)
+	if entry == nil {
+		return ""
+	}
+	return C.GoString(entry.value)
+}
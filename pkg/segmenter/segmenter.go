@@ -4,11 +4,13 @@ import (
 	"context"
 	"errors"
 	"io"
+	"math"
+	"strings"
 	"time"
 
 	// Packages
-	media "github.com/mutablelogic/go-media"
 	ffmpeg "github.com/mutablelogic/go-media/pkg/ffmpeg"
+	ff "github.com/mutablelogic/go-media/sys/ffmpeg61"
 
 	// Namespace imports
 	. "github.com/djthorpe/go-errors"
@@ -21,13 +23,58 @@ type Segmenter struct {
 	sample_rate int
 	n           int
 	buf         []float32
-	reader      *ffmpeg.Reader
+	input       *input
+
+	// The audio stream to decode, or -1 for the best stream, the language
+	// tag of the stream to decode, and the channel to decode, or -1 to
+	// downmix all channels to mono
+	stream   int
+	language string
+	channel  int
+
+	// The range of samples to decode, where end is zero to decode to the
+	// end of the stream, and the number of samples decoded
+	start, end int
+	decoded    int
+
+	// Number of samples at the end of each segment which are repeated at
+	// the start of the next segment, and the number of samples at the start
+	// of the buffer which have been repeated
+	overlap, repeat int
+
+	// Voice activity detection, which is nil if segments are not cut at
+	// silence. The tolerance is the number of samples either side of the
+	// segment size to search for silence. The buffer is scanned for speech,
+	// counting the samples of silence since any speech
+	vad       *silence
+	tolerance int
+	scanned   int
+	quiet     int
+	voiced    bool
 }
 
 // SegmentFunc is a callback function which is called when a segment is ready
 // to be processed. The first argument is the timestamp of the segment.
 type SegmentFunc func(time.Duration, []float32) error
 
+// Opt is an option for the segmenter
+type Opt func(*Segmenter) error
+
+//////////////////////////////////////////////////////////////////////////////
+// GLOBALS
+
+const (
+	// Default gain and energy threshold for detecting silence
+	vadGain      = 20
+	vadThreshold = 0.003
+
+	// Length of each frame which is tested for silence
+	vadFrame = 20 * time.Millisecond
+
+	// Length of silence kept before speech when silence is skipped
+	vadPad = 200 * time.Millisecond
+)
+
 //////////////////////////////////////////////////////////////////////////////
 // LIFECYCLE
 
@@ -39,8 +86,10 @@ type SegmentFunc func(time.Duration, []float32) error
 //
 // At the moment, the audio format is auto-detected, but there should be
 // a way to specify the audio format.
-func NewReader(r io.Reader, dur time.Duration, sample_rate int) (*Segmenter, error) {
+func NewReader(r io.Reader, dur time.Duration, sample_rate int, opts ...Opt) (*Segmenter, error) {
 	segmenter := new(Segmenter)
+	segmenter.stream = -1
+	segmenter.channel = -1
 
 	// Check arguments
 	if dur < 0 || sample_rate <= 0 {
@@ -55,12 +104,27 @@ func NewReader(r io.Reader, dur time.Duration, sample_rate int) (*Segmenter, err
 		segmenter.buf = make([]float32, 0, segmenter.n)
 	}
 
+	// Apply options
+	for _, opt := range opts {
+		if err := opt(segmenter); err != nil {
+			return nil, err
+		}
+	}
+	if segmenter.vad != nil && (segmenter.n == 0 || segmenter.tolerance >= segmenter.n) {
+		return nil, ErrBadParameter.With("voice activity detection needs a segment duration greater than the tolerance")
+	}
+	if segmenter.stream >= 0 && segmenter.language != "" {
+		return nil, ErrBadParameter.With("stream cannot be selected by both index and language")
+	}
+	if segmenter.overlap > 0 && segmenter.overlap*2 > segmenter.n {
+		return nil, ErrBadParameter.With("overlap needs a segment duration of at least twice the overlap")
+	}
+
 	// Open the file
-	media, err := ffmpeg.NewReader(r)
-	if err != nil {
+	if input, err := newInput(r); err != nil {
 		return nil, err
 	} else {
-		segmenter.reader = media
+		segmenter.input = input
 	}
 
 	return segmenter, nil
@@ -70,71 +134,336 @@ func NewReader(r io.Reader, dur time.Duration, sample_rate int) (*Segmenter, err
 func (s *Segmenter) Close() error {
 	var result error
 
-	if s.reader != nil {
-		result = errors.Join(result, s.reader.Close())
+	if s.input != nil {
+		result = errors.Join(result, s.input.Close())
 	}
-	s.reader = nil
+	s.input = nil
 	s.buf = nil
 
 	// Return any errors
 	return result
 }
 
+//////////////////////////////////////////////////////////////////////////////
+// OPTIONS
+
+// Cut segments at the nearest silence within the tolerance of the segment
+// duration, rather than at a fixed number of samples, and skip silence
+// which is longer than the skip duration. Timestamps include any
+// skipped silence
+func OptVAD(tolerance, skip time.Duration) Opt {
+	return func(s *Segmenter) error {
+		if tolerance < 0 || skip <= vadPad {
+			return ErrBadParameter.With("invalid voice activity detection arguments")
+		}
+		s.vad = &silence{Gain: vadGain, Threshold: vadThreshold, Timeout: skip}
+		s.tolerance = s.samples(tolerance)
+		return nil
+	}
+}
+
+// Repeat the end of each segment at the start of the next segment, so that
+// words at the boundary between segments are not lost. The timestamp of each
+// segment is the start of the repeated samples. With OptVAD, segments which
+// are cut at silence do not overlap
+func OptOverlap(overlap time.Duration) Opt {
+	return func(s *Segmenter) error {
+		if overlap < 0 {
+			return ErrBadParameter.With("invalid overlap")
+		}
+		s.overlap = s.samples(overlap)
+		return nil
+	}
+}
+
+// Decode the audio stream with the specified index, rather than the best
+// audio stream
+func OptStream(index int) Opt {
+	return func(s *Segmenter) error {
+		if index < 0 {
+			return ErrBadParameter.With("invalid stream index")
+		}
+		s.stream = index
+		return nil
+	}
+}
+
+// Decode the first audio stream with the language tag, such as "eng",
+// rather than the best audio stream. Decoding returns ErrNotFound if no
+// audio stream has the language
+func OptStreamLanguage(language string) Opt {
+	return func(s *Segmenter) error {
+		if language = strings.TrimSpace(language); language == "" {
+			return ErrBadParameter.With("invalid stream language")
+		}
+		s.language = language
+		return nil
+	}
+}
+
+// Decode a range of the audio stream, from the start up to the duration,
+// or to the end of the stream if the duration is zero. Timestamps are
+// from the start of the stream. The media is seeked to the start, and any
+// samples before the start are trimmed. If the media cannot seek, then the
+// samples before the start are decoded but not segmented
+func OptRange(start, duration time.Duration) Opt {
+	return func(s *Segmenter) error {
+		if start < 0 || duration < 0 {
+			return ErrBadParameter.With("invalid start or duration")
+		}
+		s.ts = start
+		s.start = s.samples(start)
+		if duration > 0 {
+			s.end = s.start + s.samples(duration)
+		}
+		return nil
+	}
+}
+
+// Decode a single channel of the audio stream, where zero is the first
+// channel, rather than downmixing all channels to mono
+func OptChannel(channel int) Opt {
+	return func(s *Segmenter) error {
+		if channel < 0 {
+			return ErrBadParameter.With("invalid channel")
+		}
+		s.channel = channel
+		return nil
+	}
+}
+
 //////////////////////////////////////////////////////////////////////////////
 // PUBLIC METHODS
 
-// Segments are output through a callback, with the samples and a timestamp
-// TODO: we could do some basic silence and voice detection to segment to ensure
-// we don't overtax the CPU/GPU with silence and non-speech
-// TODO: We whould be able to select the audio stream to use. At the moment
-// the "best" audio stream is used, based on ffmpeg heuristic.
+// Return the duration of the media, or zero if the duration is unknown
+func (s *Segmenter) Duration() time.Duration {
+	return s.input.Duration()
+}
+
+// Return the number of channels in the audio stream which is decoded
+func (s *Segmenter) Channels() (int, error) {
+	stream, err := s.audioStream()
+	if err != nil {
+		return 0, err
+	}
+	layout := stream.CodecPar().ChannelLayout()
+	return layout.NumChannels(), nil
+}
+
+// Segments are output through a callback, with the samples and a timestamp.
+// See OptVAD for cutting segments at silence and skipping non-speech.
+// The "best" audio stream is used, based on ffmpeg heuristic, unless
+// OptStream or OptStreamLanguage is used to select the stream.
 func (s *Segmenter) Decode(ctx context.Context, fn SegmentFunc) error {
 	// Check input parameters
 	if fn == nil {
 		return ErrBadParameter.With("SegmentFunc is nil")
 	}
 
-	// Map function chooses the best audio stream
-	mapFunc := func(stream int, params *ffmpeg.Par) (*ffmpeg.Par, error) {
-		if stream == s.reader.BestStream(media.AUDIO) {
-			return ffmpeg.NewAudioPar("flt", "mono", s.sample_rate)
-		}
-		// Ignore no-audio streams
-		return nil, nil
+	// Choose the stream
+	stream, err := s.audioStream()
+	if err != nil {
+		return err
 	}
+	par, err := s.par(stream)
+	if err != nil {
+		return err
+	}
+
+	// Seek to the start of the range. The position of the first frame
+	// decoded is then its timestamp
+	seek := s.start > 0 && s.input.Seek(s.ts) == nil
 
 	// Decode samples and segment
-	if err := s.reader.Decode(ctx, mapFunc, func(stream int, frame *ffmpeg.Frame) error {
-		// We get null frames sometimes, ignore them
-		if frame == nil {
-			return nil
+	if err := s.input.Decode(ctx, stream, par, func(frame *ffmpeg.Frame) error {
+		if seek {
+			if ts := frame.Ts(); ts != ffmpeg.TS_UNDEFINED {
+				s.decoded = int(math.Round(ts * float64(s.sample_rate)))
+			} else {
+				s.decoded = s.start
+			}
+			seek = false
 		}
 
-		// Append float32 samples from plane 0 to buffer
-		s.buf = append(s.buf, frame.Float32(0)...)
+		// Append float32 samples to buffer, from the plane of the channel
+		// when the channels are not downmixed, and within the range
+		samples := frame.Float32(max(s.channel, 0))
+		from, to := max(s.start-s.decoded, 0), len(samples)
+		if s.end > 0 {
+			to = min(to, s.end-s.decoded)
+		}
+		if from < to {
+			s.buf = append(s.buf, samples[from:to]...)
+		}
+		s.decoded += len(samples)
 
-		// n != 0 and len(buf) >= n we have a segment to process
-		if s.n != 0 && len(s.buf) >= s.n {
+		if s.vad != nil {
+			// Cut segments at silence
+			if err := s.segment(fn, false); err != nil {
+				return err
+			}
+		} else if s.n != 0 && len(s.buf) >= s.n {
+			// n != 0 and len(buf) >= n we have a segment to process
 			if err := fn(s.ts, s.buf); err != nil {
 				return err
 			}
-			// Increment the timestamp
-			s.ts += time.Duration(len(s.buf)) * time.Second / time.Duration(s.sample_rate)
-			// Clear the buffer
-			s.buf = s.buf[:0]
+			// Increment the timestamp and clear the buffer, keeping any overlap
+			s.advance(len(s.buf) - s.overlap)
+			s.repeat = s.overlap
 		}
 
-		// Continue processing
+		// Stop decoding at the end of the range, or continue processing
+		if s.end > 0 && s.decoded >= s.end {
+			return io.EOF
+		}
 		return nil
 	}); err != nil {
 		return err
 	}
 
 	// Output any remaining samples
-	if len(s.buf) > 0 {
-		fn(s.ts, s.buf)
+	if s.vad != nil {
+		return s.segment(fn, true)
+	} else if len(s.buf) > s.repeat {
+		return fn(s.ts, s.buf)
 	}
 
 	// Return success
 	return nil
 }
+
+//////////////////////////////////////////////////////////////////////////////
+// PRIVATE METHODS
+
+// Output segments from the buffer, cutting at silence and skipping silence.
+// If eof is true, then any remaining speech is output
+func (s *Segmenter) segment(fn SegmentFunc, eof bool) error {
+	for {
+		// Scan for speech, and output a segment when speech is followed by
+		// silence which is skipped, when there are enough samples to search
+		// for silence around the segment size, or at the end of the stream
+		var overlap int
+		cut, ok := s.scan(eof)
+		switch {
+		case ok:
+			break
+		case len(s.buf) >= s.n+s.tolerance:
+			if cut, ok = s.cut(); !ok {
+				overlap = s.overlap
+			}
+		case eof && s.voiced && len(s.buf) > s.repeat:
+			cut = len(s.buf)
+		default:
+			return nil
+		}
+		if err := fn(s.ts, s.buf[:cut]); err != nil {
+			return err
+		}
+
+		// Remove the segment from the buffer, keeping any overlap, and scan
+		// the remaining samples again
+		s.advance(cut - overlap)
+		s.scanned, s.quiet, s.voiced, s.repeat = 0, 0, false, overlap
+	}
+}
+
+// Scan the buffer for speech, up to the segment size and tolerance. Silence
+// before any speech which is longer than the skip duration is removed,
+// keeping some silence before the speech. Returns the end of the speech and
+// true if speech is followed by silence which is longer than the skip
+// duration. If eof is true, then silence at the end of the stream is removed
+func (s *Segmenter) scan(eof bool) (int, bool) {
+	frame, pad, skip := s.samples(vadFrame), s.samples(vadPad), s.samples(s.vad.Timeout)
+	for s.scanned < min(len(s.buf), s.n+s.tolerance) {
+		end := s.scanned + frame
+		if end > len(s.buf) {
+			if !eof {
+				break
+			}
+			end = len(s.buf)
+		}
+		if s.vad.Silent(s.buf[s.scanned:end]) {
+			s.quiet += end - s.scanned
+		} else {
+			s.voiced, s.quiet = true, 0
+		}
+		s.scanned = end
+
+		// Skip silence
+		if s.quiet >= skip {
+			if s.voiced {
+				return s.scanned - s.quiet + pad, true
+			}
+			n := s.scanned - pad
+			s.advance(n)
+			s.scanned, s.quiet = pad, pad
+		}
+	}
+
+	// Remove silence at the end of the stream
+	if eof && !s.voiced && s.scanned == len(s.buf) {
+		s.advance(len(s.buf))
+		s.scanned, s.quiet = 0, 0
+	}
+
+	// Speech is not followed by silence
+	return 0, false
+}
+
+// Return the middle of the silent frame nearest to the segment size,
+// within the tolerance, and true. Returns the segment size and false if
+// there is no silence
+func (s *Segmenter) cut() (int, bool) {
+	frame := s.samples(vadFrame)
+	for d := 0; d <= s.tolerance; d += frame {
+		for _, i := range []int{s.n - d, s.n + d} {
+			if i-frame/2 > 0 && i+frame/2 <= len(s.buf) && s.vad.Silent(s.buf[i-frame/2:i+frame/2]) {
+				return i, true
+			}
+		}
+	}
+	return s.n, false
+}
+
+// Remove samples from the start of the buffer, and increment the timestamp
+func (s *Segmenter) advance(n int) {
+	s.ts += time.Duration(n) * time.Second / time.Duration(s.sample_rate)
+	s.buf = append(s.buf[:0], s.buf[n:]...)
+	s.repeat = max(s.repeat-n, 0)
+}
+
+// Return the audio stream to decode, which is the stream with the language,
+// the stream with the index, or the best audio stream
+func (s *Segmenter) audioStream() (*ff.AVStream, error) {
+	index := s.stream
+	if s.language != "" {
+		if index = s.input.LanguageStream(s.language); index < 0 {
+			return nil, ErrNotFound.Withf("audio stream with language %q", s.language)
+		}
+	} else if index < 0 {
+		index = s.input.BestStream()
+	}
+	return s.input.Stream(index)
+}
+
+// Return the parameters to decode a stream, which are mono, or all the
+// channels of the stream if a channel is selected
+func (s *Segmenter) par(stream *ff.AVStream) (*ffmpeg.Par, error) {
+	if s.channel < 0 {
+		return ffmpeg.NewAudioPar("flt", "mono", s.sample_rate)
+	}
+	layout := stream.CodecPar().ChannelLayout()
+	if s.channel >= layout.NumChannels() {
+		return nil, ErrBadParameter.Withf("stream %d does not have channel %d", stream.Index(), s.channel)
+	}
+	name, err := ff.AVUtil_channel_layout_describe(&layout)
+	if err != nil {
+		return nil, err
+	}
+	return ffmpeg.NewAudioPar("fltp", name, s.sample_rate)
+}
+
+// Return the number of samples for a duration
+func (s *Segmenter) samples(d time.Duration) int {
+	return int(d.Seconds() * float64(s.sample_rate))
+}
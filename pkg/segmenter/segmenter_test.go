@@ -2,16 +2,25 @@ package segmenter_test
 
 import (
 	"context"
+	"encoding/binary"
+	"math"
 	"os"
+	"path/filepath"
 	"testing"
 	"time"
 
 	// Packages
 	segmenter "github.com/mutablelogic/go-whisper/pkg/segmenter"
 	assert "github.com/stretchr/testify/assert"
+
+	// Namespace imports
+	. "github.com/djthorpe/go-errors"
 )
 
-const SAMPLE = "../../samples/OlivierL.wav"
+const (
+	SAMPLE = "../../samples/OlivierL.wav"
+	JFK    = "../../samples/jfk.wav"
+)
 
 func Test_segmenter_001(t *testing.T) {
 	assert := assert.New(t)
@@ -20,7 +29,7 @@ func Test_segmenter_001(t *testing.T) {
 	if !assert.NoError(err) {
 		t.SkipNow()
 	}
-	segmenter, err := segmenter.New(f, 200*time.Millisecond, 16000)
+	segmenter, err := segmenter.NewReader(f, 200*time.Millisecond, 16000)
 	if !assert.NoError(err) {
 		t.SkipNow()
 	}
@@ -41,7 +50,7 @@ func Test_segmenter_002(t *testing.T) {
 	}
 
 	// No segmentation, just output the audio
-	segmenter, err := segmenter.New(f, 0, 16000)
+	segmenter, err := segmenter.NewReader(f, 0, 16000)
 	if !assert.NoError(err) {
 		t.SkipNow()
 	}
@@ -52,3 +61,358 @@ func Test_segmenter_002(t *testing.T) {
 		return nil
 	}))
 }
+
+func Test_segmenter_003(t *testing.T) {
+	assert := assert.New(t)
+
+	f, err := os.Open(SAMPLE)
+	if !assert.NoError(err) {
+		t.SkipNow()
+	}
+
+	// Cut segments at silence, within a second of the segment size
+	segmenter, err := segmenter.NewReader(f, 5*time.Second, 16000, segmenter.OptVAD(time.Second, 2*time.Second))
+	if !assert.NoError(err) {
+		t.SkipNow()
+	}
+	defer segmenter.Close()
+
+	var next time.Duration
+	assert.NoError(segmenter.Decode(context.Background(), func(ts time.Duration, buf []float32) error {
+		t.Log(ts, len(buf))
+		assert.GreaterOrEqual(ts, next)
+		assert.LessOrEqual(len(buf), 6*16000)
+		next = ts + time.Duration(len(buf))*time.Second/16000
+		return nil
+	}))
+}
+
+func Test_segmenter_004(t *testing.T) {
+	assert := assert.New(t)
+
+	// The segment size must be greater than the tolerance
+	_, err := segmenter.NewReader(nil, time.Second, 16000, segmenter.OptVAD(time.Second, 2*time.Second))
+	assert.ErrorIs(err, ErrBadParameter)
+	_, err = segmenter.NewReader(nil, 0, 16000, segmenter.OptVAD(time.Second, 2*time.Second))
+	assert.ErrorIs(err, ErrBadParameter)
+
+	// Segments are cut at the end of speech followed by silence which is
+	// skipped, keeping 200ms of silence, or at the silence nearest to 5s,
+	// within a second
+	tests := []struct {
+		name     string
+		signal   []float32
+		expected [][2]int
+	}{
+		{
+			// The first segment is cut 200ms after the tone at 2s, and the
+			// silence is skipped up to 1s before the next tone at 5s
+			name:     "skip",
+			signal:   signal(tone(2*time.Second), silent(3*time.Second), tone(2*time.Second)),
+			expected: [][2]int{{0, 35200}, {64000, 48000}},
+		},
+		{
+			// The silence from 3.5s to 4.5s is too short to skip, and the
+			// segment is cut in the silent frame nearest to 5s
+			name:     "cut",
+			signal:   signal(tone(3500*time.Millisecond), silent(time.Second), tone(3500*time.Millisecond)),
+			expected: [][2]int{{0, 71680}, {71680, 56320}},
+		},
+	}
+	for _, test := range tests {
+		segments, err := decode(wave(t, 1, test.signal), 5*time.Second, segmenter.OptVAD(time.Second, 2*time.Second))
+		if !assert.NoError(err, test.name) {
+			continue
+		}
+		var result [][2]int
+		for _, segment := range segments {
+			result = append(result, [2]int{segment.start(), len(segment.samples)})
+		}
+		assert.Equal(test.expected, result, test.name)
+	}
+}
+
+func Test_segmenter_005(t *testing.T) {
+	assert := assert.New(t)
+
+	// The segment size must be at least twice the overlap
+	_, err := segmenter.NewReader(nil, time.Second, 16000, segmenter.OptOverlap(time.Second))
+	assert.ErrorIs(err, ErrBadParameter)
+	_, err = segmenter.NewReader(nil, time.Second, 16000, segmenter.OptOverlap(-time.Second))
+	assert.ErrorIs(err, ErrBadParameter)
+
+	// Each segment starts with the last second of the previous segment
+	segments, err := decode(JFK, 4*time.Second, segmenter.OptOverlap(time.Second))
+	if !assert.NoError(err) {
+		t.SkipNow()
+	}
+	if !assert.Len(segments, 4) {
+		t.SkipNow()
+	}
+	total := len(segments[0].samples)
+	for i := 1; i < len(segments); i++ {
+		prev, next := segments[i-1], segments[i]
+		assert.Equal(prev.start()+len(prev.samples)-16000, next.start(), i)
+		assert.Equal(prev.samples[len(prev.samples)-16000:], next.samples[:16000], i)
+		total += len(next.samples) - 16000
+	}
+
+	// All the samples are decoded once, apart from the overlap
+	assert.Equal(176000, total)
+}
+
+func Test_segmenter_006(t *testing.T) {
+	assert := assert.New(t)
+
+	// The stream index and channel cannot be negative, the stream language
+	// cannot be empty, and a stream cannot be selected by index and language
+	_, err := segmenter.NewReader(nil, time.Second, 16000, segmenter.OptStream(-1))
+	assert.ErrorIs(err, ErrBadParameter)
+	_, err = segmenter.NewReader(nil, time.Second, 16000, segmenter.OptChannel(-1))
+	assert.ErrorIs(err, ErrBadParameter)
+	_, err = segmenter.NewReader(nil, time.Second, 16000, segmenter.OptStreamLanguage(" "))
+	assert.ErrorIs(err, ErrBadParameter)
+	_, err = segmenter.NewReader(nil, time.Second, 16000, segmenter.OptStream(0), segmenter.OptStreamLanguage("eng"))
+	assert.ErrorIs(err, ErrBadParameter)
+
+	// The best stream of a mono file is the first stream and channel
+	mono, err := decode(JFK, 0)
+	if !assert.NoError(err) || !assert.Len(mono, 1) {
+		t.SkipNow()
+	}
+	assert.Len(mono[0].samples, 176000)
+	t.Run("Stream", func(t *testing.T) {
+		segments, err := decode(JFK, 0, segmenter.OptStream(0))
+		if assert.NoError(err) && assert.Len(segments, 1) {
+			assert.Equal(mono[0].samples, segments[0].samples)
+		}
+		_, err = decode(JFK, 0, segmenter.OptStream(1))
+		assert.ErrorIs(err, ErrNotFound)
+		_, err = decode(JFK, 0, segmenter.OptStreamLanguage("eng"))
+		assert.ErrorIs(err, ErrNotFound)
+	})
+	t.Run("Channel", func(t *testing.T) {
+		segments, err := decode(JFK, 0, segmenter.OptChannel(0))
+		if assert.NoError(err) && assert.Len(segments, 1) {
+			assert.Equal(mono[0].samples, segments[0].samples)
+		}
+		_, err = decode(JFK, 0, segmenter.OptChannel(1))
+		assert.ErrorIs(err, ErrBadParameter)
+	})
+
+	// A stereo file with a different level on each channel
+	path := stereo(t, 0.25, -0.25)
+	if f, err := os.Open(path); assert.NoError(err) {
+		reader, err := segmenter.NewReader(f, 0, 16000)
+		if assert.NoError(err) {
+			channels, err := reader.Channels()
+			assert.NoError(err)
+			assert.Equal(2, channels)
+			reader.Close()
+		}
+		f.Close()
+	}
+	for channel, level := range map[int]float32{-1: 0, 0: 0.25, 1: -0.25} {
+		var opts []segmenter.Opt
+		if channel >= 0 {
+			opts = append(opts, segmenter.OptChannel(channel))
+		}
+		segments, err := decode(path, 0, opts...)
+		if assert.NoError(err, channel) && assert.Len(segments, 1, channel) {
+			assert.Len(segments[0].samples, 16000, channel)
+			for _, sample := range segments[0].samples {
+				if !assert.InDelta(level, sample, 1e-4, channel) {
+					break
+				}
+			}
+		}
+	}
+}
+
+func Test_segmenter_007(t *testing.T) {
+	assert := assert.New(t)
+
+	// The start and duration cannot be negative
+	_, err := segmenter.NewReader(nil, time.Second, 16000, segmenter.OptRange(-time.Second, 0))
+	assert.ErrorIs(err, ErrBadParameter)
+	_, err = segmenter.NewReader(nil, time.Second, 16000, segmenter.OptRange(0, -time.Second))
+	assert.ErrorIs(err, ErrBadParameter)
+
+	// Decode the whole file, to compare with each range
+	all, err := decode(JFK, 0)
+	if !assert.NoError(err) || !assert.Len(all, 1) {
+		t.SkipNow()
+	}
+	samples := all[0].samples
+
+	// A range starts at the exact sample, and the timestamp is from the
+	// start of the file
+	for _, r := range [][2]time.Duration{{2 * time.Second, 3 * time.Second}, {1500 * time.Millisecond, 0}, {10 * time.Second, 5 * time.Second}} {
+		segments, err := decode(JFK, 0, segmenter.OptRange(r[0], r[1]))
+		if !assert.NoError(err, r) || !assert.Len(segments, 1, r) {
+			continue
+		}
+		start, end := int(r[0]*16000/time.Second), len(samples)
+		if r[1] > 0 {
+			end = min(end, start+int(r[1]*16000/time.Second))
+		}
+		assert.Equal(r[0], segments[0].ts, r)
+		assert.Equal(samples[start:end], segments[0].samples, r)
+	}
+
+	// Segments within a range have timestamps from the start of the file
+	segments, err := decode(JFK, time.Second, segmenter.OptRange(3*time.Second, 4*time.Second))
+	if assert.NoError(err) && assert.NotEmpty(segments) {
+		assert.Equal(3*time.Second, segments[0].ts)
+		last := segments[len(segments)-1]
+		assert.Equal(7*16000, last.start()+len(last.samples))
+	}
+}
+
+func Test_segmenter_008(t *testing.T) {
+	assert := assert.New(t)
+
+	// An error from the callback is returned, including from the last
+	// segment, which is the only segment when the segment size is zero.
+	// Segments cut at silence and overlapping segments behave the same
+	tests := []struct {
+		name string
+		dur  time.Duration
+		opts []segmenter.Opt
+	}{
+		{"all", 0, nil},
+		{"segments", 4 * time.Second, nil},
+		{"overlap", 4 * time.Second, []segmenter.Opt{segmenter.OptOverlap(time.Second)}},
+		{"vad", 5 * time.Second, []segmenter.Opt{segmenter.OptVAD(time.Second, 2*time.Second)}},
+	}
+	for _, test := range tests {
+		segments, err := decode(JFK, test.dur, test.opts...)
+		if !assert.NoError(err, test.name) || !assert.NotEmpty(segments, test.name) {
+			continue
+		}
+		for i := range segments {
+			n, err := fail(JFK, test.dur, i, test.opts...)
+			assert.ErrorIs(err, context.Canceled, test.name, i)
+			assert.Equal(i+1, n, test.name, i)
+		}
+	}
+}
+
+//////////////////////////////////////////////////////////////////////////////
+
+type segment struct {
+	ts      time.Duration
+	samples []float32
+}
+
+// Return the start of the segment in samples
+func (s segment) start() int {
+	return int(s.ts * 16000 / time.Second)
+}
+
+// Decode a file at 16kHz, and return a copy of each segment
+func decode(path string, dur time.Duration, opts ...segmenter.Opt) ([]segment, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	reader, err := segmenter.NewReader(f, dur, 16000, opts...)
+	if err != nil {
+		return nil, err
+	}
+	defer reader.Close()
+
+	var result []segment
+	if err := reader.Decode(context.Background(), func(ts time.Duration, buf []float32) error {
+		result = append(result, segment{ts, append([]float32(nil), buf...)})
+		return nil
+	}); err != nil {
+		return nil, err
+	}
+	return result, nil
+}
+
+// Decode a file, returning context.Canceled from the callback for the
+// segment with the index. Returns the number of segments
+func fail(path string, dur time.Duration, index int, opts ...segmenter.Opt) (int, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return 0, err
+	}
+	defer f.Close()
+	reader, err := segmenter.NewReader(f, dur, 16000, opts...)
+	if err != nil {
+		return 0, err
+	}
+	defer reader.Close()
+
+	var n int
+	err = reader.Decode(context.Background(), func(ts time.Duration, buf []float32) error {
+		if n++; n > index {
+			return context.Canceled
+		}
+		return nil
+	})
+	return n, err
+}
+
+// Write one second of 16kHz stereo audio to a WAV file, with a constant
+// level on each channel, and return the path
+func stereo(t *testing.T, left, right float32) string {
+	var samples []float32
+	for i := 0; i < 16000; i++ {
+		samples = append(samples, left, right)
+	}
+	return wave(t, 2, samples)
+}
+
+// Write 16kHz audio to a WAV file, where the samples of each channel are
+// interleaved, and return the path
+func wave(t *testing.T, channels int, samples []float32) string {
+	var data []byte
+	for _, sample := range samples {
+		data = binary.LittleEndian.AppendUint16(data, uint16(int16(sample*32768)))
+	}
+	header := []byte("RIFF")
+	header = binary.LittleEndian.AppendUint32(header, uint32(36+len(data)))
+	header = append(header, "WAVEfmt "...)
+	header = binary.LittleEndian.AppendUint32(header, 16)
+	header = binary.LittleEndian.AppendUint16(header, 1)                        // PCM
+	header = binary.LittleEndian.AppendUint16(header, uint16(channels))         // Channels
+	header = binary.LittleEndian.AppendUint32(header, 16000)                    // Sample rate
+	header = binary.LittleEndian.AppendUint32(header, uint32(16000*2*channels)) // Byte rate
+	header = binary.LittleEndian.AppendUint16(header, uint16(2*channels))       // Block align
+	header = binary.LittleEndian.AppendUint16(header, 16)                       // Bits per sample
+	header = append(header, "data"...)
+	header = binary.LittleEndian.AppendUint32(header, uint32(len(data)))
+
+	path := filepath.Join(t.TempDir(), "audio.wav")
+	if err := os.WriteFile(path, append(header, data...), 0600); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+// Return a 440Hz tone at 16kHz
+func tone(d time.Duration) []float32 {
+	samples := make([]float32, int(d*16000/time.Second))
+	for i := range samples {
+		samples[i] = float32(0.5 * math.Sin(2*math.Pi*440*float64(i)/16000))
+	}
+	return samples
+}
+
+// Return silence at 16kHz
+func silent(d time.Duration) []float32 {
+	return make([]float32, int(d*16000/time.Second))
+}
+
+// Return the parts of a signal joined together
+func signal(parts ...[]float32) []float32 {
+	var result []float32
+	for _, part := range parts {
+		result = append(result, part...)
+	}
+	return result
+}
@@ -3,59 +3,38 @@ package segmenter
 import (
 	"math"
 	"time"
-	// Packages
 )
 
 ////////////////////////////////////////////////////////////////////////////////
 // TYPES
 
-// silence is a silence detector and audio booster for raw samples
+// silence is an energy-based silence detector for raw samples
 // typical values are gain=20, threshold=0.003, timeout=2s
 type silence struct {
 	Gain      float64       // gain in decibels
 	Threshold float64       // threshold for silence
-	Timeout   time.Duration // duration of silence before stopping recording
-
-	// When we last started recording
-	t time.Time
-	r bool
+	Timeout   time.Duration // duration of silence which is skipped
 }
 
 ////////////////////////////////////////////////////////////////////////////////
 // PUBLIC METHODS
 
 // Increase gain and compute energy of a frame of audio data, return true
-// if the frame of data should be recorded, false if it should be ignored
-func (s *silence) Process(data []float32) bool {
-	energy := process(data, float32(math.Pow(10, s.Gain/20.0)))
-
-	// Compute the gain
-	if energy > s.Threshold {
-		if s.t.IsZero() {
-			// Transition from silence to recording
-			s.r = true
-		}
-		s.t = time.Now()
-	} else if !s.t.IsZero() {
-		if time.Since(s.t) > s.Timeout {
-			// Transition from recording to silence
-			s.t = time.Time{}
-			s.r = false
-		}
-	}
-	return s.r
+// if the frame of data is silent and should be ignored
+func (s *silence) Silent(data []float32) bool {
+	return process(data, float32(math.Pow(10, s.Gain/20.0))) <= s.Threshold
 }
 
 ////////////////////////////////////////////////////////////////////////////////
 // PRIVATE METHODS
 
-// Increase gain and compute energy of a frame of audio data, return the
-// energy of the frame of data
+// Compute energy of a frame of audio data with gain applied, return the
+// energy of the frame of data. The data is not modified
 func process(data []float32, gain float32) float64 {
 	energy := float64(0)
 	for i := 0; i < len(data); i++ {
-		data[i] *= gain
-		energy += float64(data[i]) * float64(data[i])
+		v := float64(data[i] * gain)
+		energy += v * v
 	}
 	return energy / math.Sqrt(float64(len(data)))
 }
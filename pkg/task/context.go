@@ -4,7 +4,8 @@ import (
 	"context"
 	"encoding/json"
 	"fmt"
-	"path/filepath"
+	"math"
+	"strings"
 	"sync"
 	"time"
 
@@ -23,20 +24,57 @@ import (
 type Context struct {
 	sync.Mutex
 
-	// Model Id and whisper context
+	// Model Id, the shared model weights and the state for
+	// this context
 	model   string
+	cache   *ModelCache
+	weights *weights
 	whisper *whisper.Context
+	state   *whisper.State
 
 	// Parameters for the next transcription
 	params whisper.FullParams
 
-	// Collect the transcription
-	result *schema.Transcription
+	// Collect the transcription, labelling segments with the speaker
+	result  *schema.Transcription
+	speaker string
+
+	// Add the words of each segment to the result, and drop segments with
+	// an average log probability below the floor
+	words bool
+	floor float32
+
+	// Segments of the last transcription, and the threshold for the
+	// compression ratio above which decoding fails
+	segments []decoded
+	ratio    float32
+
+	// Duration of audio repeated at the start of each transcription, the
+	// end of the last transcription and the segments which are held back
+	overlap time.Duration
+	end     time.Duration
+	held    []span
+
+	// Explicit prompt tokens, the maximum number of tokens carried over from
+	// one transcription to the next, and the tokens carried over
+	prompt  []int32
+	context int
+	tokens  []int32
+
+	// Token sequences of the vocabulary terms, which are boosted during decoding
+	vocabulary [][]int32
 }
 
 // Callback for new segments during the transcription process
 type NewSegmentFunc func(*schema.Segment)
 
+// A segment decoded by whisper, with timestamps relative to the start of
+// the samples, and the temperature which decoded it
+type decoded struct {
+	*whisper.Segment
+	temperature float32
+}
+
 //////////////////////////////////////////////////////////////////////////////
 // LIFECYCLE
 
@@ -45,37 +83,35 @@ func New() *Context {
 	return new(Context)
 }
 
-// Init the context
-func (m *Context) Init(path string, model *schema.Model, gpu int) error {
+// Init the context with a model. The model weights are loaded into the
+// cache if necessary, and shared with any other contexts for the same model
+func (m *Context) Init(cache *ModelCache, model *schema.Model) error {
 	m.Lock()
 	defer m.Unlock()
 
 	// Check parameters
-	if model == nil {
+	if cache == nil || model == nil {
 		return ErrBadParameter
 	}
 
-	// Get default parameters
-	params := whisper.DefaultContextParams()
-
-	// If gpu is -1, then disable
-	// If gpu is 0, then use whatever the default is
-	// If gpu is >0, then enable and set the device
-	if gpu == -1 {
-		params.SetUseGpu(false)
-	} else if gpu > 0 {
-		params.SetUseGpu(true)
-		params.SetGpuDevice(gpu)
+	// Get the model weights
+	weights, err := cache.get(model)
+	if err != nil {
+		return err
 	}
 
-	// Get a context
-	ctx := whisper.Whisper_init_from_file_with_params(filepath.Join(path, model.Path), params)
-	if ctx == nil {
-		return ErrInternalAppError.With("whisper_init")
+	// Create a state
+	state := whisper.Whisper_init_state(weights.whisper)
+	if state == nil {
+		cache.release(weights)
+		return ErrInternalAppError.With("whisper_init_state")
 	}
 
 	// Set resources
-	m.whisper = ctx
+	m.cache = cache
+	m.weights = weights
+	m.whisper = weights.whisper
+	m.state = state
 	m.model = model.Id
 
 	// Return success
@@ -91,10 +127,16 @@ func (ctx *Context) Close() error {
 	}
 
 	// Release resources
-	if ctx.whisper != nil {
-		whisper.Whisper_free(ctx.whisper)
+	if ctx.state != nil {
+		whisper.Whisper_free_state(ctx.state)
+	}
+	if ctx.weights != nil {
+		ctx.cache.release(ctx.weights)
 	}
+	ctx.state = nil
+	ctx.weights = nil
 	ctx.whisper = nil
+	ctx.cache = nil
 	ctx.model = ""
 
 	// Return success
@@ -109,11 +151,13 @@ func (ctx *Context) MarshalJSON() ([]byte, error) {
 		Model   string             `json:"model"`
 		Params  whisper.FullParams `json:"params"`
 		Context string             `json:"context"`
+		State   string             `json:"state"`
 	}
 	return json.Marshal(j{
 		Model:   ctx.model,
 		Params:  ctx.params,
 		Context: fmt.Sprintf("%p", ctx.whisper),
+		State:   fmt.Sprintf("%p", ctx.state),
 	})
 }
 
@@ -128,6 +172,11 @@ func (ctx *Context) String() string {
 //////////////////////////////////////////////////////////////////////////////
 // PUBLIC METHODS
 
+// Context has a loaded model
+func (ctx *Context) Loaded() bool {
+	return ctx.model != ""
+}
+
 // Context has a loaded model that matches the argument
 func (ctx *Context) Is(model *schema.Model) bool {
 	if ctx.model == "" {
@@ -141,9 +190,19 @@ func (ctx *Context) Is(model *schema.Model) bool {
 
 // Reset task context for re-use
 func (task *Context) CopyParams() {
+	task.params.SetInitialPrompt("")
+	task.params.SetSuppressRegex("")
+	task.params.SetPromptTokens(nil)
+	task.params.SetGrammar(nil, 0)
 	task.params = whisper.DefaultFullParams(whisper.SAMPLING_GREEDY)
 	task.params.SetLanguage("auto")
 	task.result = new(schema.Transcription)
+	task.overlap, task.end, task.held = 0, 0, nil
+	task.speaker = ""
+	task.words, task.floor = false, float32(math.Inf(-1))
+	task.segments, task.ratio = nil, defaultCompressionRatio
+	task.prompt, task.context, task.tokens = nil, maxContextTokens, nil
+	task.vocabulary = nil
 }
 
 // Model is multilingual and can translate
@@ -153,51 +212,60 @@ func (task *Context) CanTranslate() bool {
 
 // Transcribe samples. The samples should be 16KHz float32 samples in
 // a single channel. Appends the transcription to the result, and includes
-// segment data if the new segment function is not nil
+// segment data if the new segment function is not nil. When the overlap is
+// set, segment data is always included, and duplicated words are removed
+// where the samples overlap the previous samples. The last tokens of the
+// transcription are used as the prompt for the next call. Flush should be
+// called after the last samples
 func (task *Context) Transcribe(ctx context.Context, ts time.Duration, samples []float32, fn NewSegmentFunc) error {
-	// Set the 'abort' function
-	task.params.SetAbortCallback(task.whisper, func() bool {
-		select {
-		case <-ctx.Done():
-			return true
-		default:
-			return false
-		}
-	})
-
-	// Set the new segment function
-	if fn != nil {
-		task.params.SetSegmentCallback(task.whisper, func(new_segments int) {
-			num_segments := task.whisper.NumSegments()
-			offset := len(task.result.Segments)
-			for i := num_segments - new_segments; i < num_segments; i++ {
-				fn(newSegment(ts, int32(offset), task.whisper.Segment(i)))
-			}
-		})
+	// Nothing to transcribe
+	if len(samples) == 0 {
+		return nil
 	}
 
-	// TODO: Set the initial prompt tokens from any previous transcription call
-
-	// Perform the transcription
-	if err := whisper.Whisper_full(task.whisper, task.params, samples); err != nil {
-		if ctx.Err() != nil {
-			return ctx.Err()
-		} else {
+	// Perform the transcription, and append the transcription
+	if task.overlap > 0 {
+		if err := task.transcribeOverlap(ctx, ts, samples, fn); err != nil {
 			return err
 		}
+	} else if err := task.transcribe(ctx, ts, samples, fn); err != nil {
+		return err
+	} else {
+		task.appendResult(ts, fn != nil)
 	}
 
-	// Remove the callbacks
-	task.params.SetAbortCallback(task.whisper, nil)
-	task.params.SetSegmentCallback(task.whisper, nil)
-
-	// Append the transcription
-	task.appendResult(ts, fn != nil)
+	// Carry the tokens over to the next transcription
+	task.carryTokens()
 
 	// Return success
 	return nil
 }
 
+// Preview transcribes samples without appending the transcription to the
+// result, and returns the segments. This is used to return a partial
+// transcription which will later be replaced by calling Transcribe.
+func (task *Context) Preview(ctx context.Context, ts time.Duration, samples []float32) ([]*schema.Segment, error) {
+	// Nothing to transcribe
+	if len(samples) == 0 {
+		return nil, nil
+	}
+
+	// Perform the transcription
+	if err := task.transcribe(ctx, ts, samples, nil); err != nil {
+		return nil, err
+	}
+
+	// Return the segments
+	offset := len(task.result.Segments)
+	segments := make([]*schema.Segment, 0, len(task.segments))
+	for _, seg := range task.segments {
+		if segment := task.newSegment(ts, int32(offset), seg); task.keep(segment) {
+			segments = append(segments, segment)
+		}
+	}
+	return segments, nil
+}
+
 // Set the language. For transcription, this is the language of the
 // audio samples. For translation, this is the language to translate
 // to. If you set this to "auto" then the language will be detected
@@ -238,26 +306,223 @@ func (ctx *Context) Diarize() bool {
 	return ctx.params.Diarize()
 }
 
+// Set single segment flag, which returns a single segment for
+// each transcription
+func (ctx *Context) SetSingleSegment(v bool) {
+	ctx.params.SetSingleSegment(v)
+}
+
+// Return the single segment flag
+func (ctx *Context) SingleSegment() bool {
+	return ctx.params.SingleSegment()
+}
+
+// Set the initial prompt, which is used to provide context to the
+// transcription. Set to an empty string to remove the prompt
+func (ctx *Context) SetPrompt(v string) {
+	ctx.params.SetInitialPrompt(v)
+}
+
+// Return the initial prompt
+func (ctx *Context) Prompt() string {
+	return ctx.params.InitialPrompt()
+}
+
+// Set the speaker label for new segments, which is used when each channel
+// of the audio is transcribed separately. Set to an empty string to remove
+// the label
+func (ctx *Context) SetSpeaker(v string) {
+	ctx.speaker = v
+}
+
+// Return the speaker label
+func (ctx *Context) Speaker() string {
+	return ctx.speaker
+}
+
 // Return the transcription result
 func (ctx *Context) Result() *schema.Transcription {
 	return ctx.result
 }
 
+// Interleave the segments in the result by start time, after each speaker
+// has been transcribed separately, and set the text and words in the same order
+func (ctx *Context) Interleave() {
+	SortSegments(ctx.result.Segments)
+	var text strings.Builder
+	var words []*schema.Word
+	for _, seg := range ctx.result.Segments {
+		text.WriteString(seg.Text)
+		words = append(words, seg.Words...)
+	}
+	ctx.result.Text = text.String()
+	ctx.result.Words = words
+}
+
 //////////////////////////////////////////////////////////////////////////////
 // PRIVATE METHODS
 
+// Perform the transcription, calling the segment function on each new
+// segment if it's not nil. Each window of audio is checked as it is decoded,
+// and when decoding fails, the window is decoded again at a higher
+// temperature, and then decoding continues at the initial temperature
+func (task *Context) transcribe(ctx context.Context, ts time.Duration, samples []float32, fn NewSegmentFunc) error {
+	// Set the 'abort' function, which also stops decoding after a window
+	// has failed, or after a window which was decoded again
+	var retry, restart bool
+	task.params.SetAbortCallbackWithState(task.state, func() bool {
+		select {
+		case <-ctx.Done():
+			return true
+		default:
+			return retry || restart
+		}
+	})
+	defer task.params.SetAbortCallbackWithState(task.state, nil)
+
+	// Disable the temperature fallback in whisper.cpp, so that the
+	// temperature which decoded each window is known
+	temperature, inc := task.params.Temperature(), task.params.TemperatureInc()
+	task.params.SetTemperatureInc(0)
+	defer task.params.SetTemperature(temperature)
+	defer task.params.SetTemperatureInc(inc)
+	defer task.params.SetSegmentCallbackWithState(task.state, nil)
+
+	// Set the logits filter to boost the vocabulary
+	if len(task.vocabulary) > 0 {
+		task.params.SetLogitsFilterCallbackWithState(task.state, task.boostVocabulary)
+		defer task.params.SetLogitsFilterCallbackWithState(task.state, nil)
+	}
+
+	// Decode from an offset into the samples until all windows are decoded
+	task.segments = task.segments[:0]
+	for offset, t := 0, temperature; offset < len(samples); {
+		start := time.Duration(offset) * time.Second / whisper.SampleRate
+		retry, restart = false, false
+		task.params.SetSegmentCallbackWithState(task.state, func(new_segments int) {
+			if retry || restart {
+				return
+			}
+			window := make([]decoded, 0, new_segments)
+			for i := task.state.NumSegments() - new_segments; i < task.state.NumSegments(); i++ {
+				window = append(window, decoded{Segment: offsetSegment(task.state.Segment(task.whisper, i), start), temperature: t})
+			}
+			if inc > 0 && t+inc <= maxTemperature+temperatureEpsilon && task.failed(window) {
+				retry = true
+			} else {
+				task.appendSegments(ts, window, fn)
+				restart = t != temperature
+			}
+		})
+
+		// Set the prompt from the initial prompt and any tokens carried over
+		// from the previous transcription and the decoded windows
+		task.params.SetTemperature(t)
+		if err := task.setPromptTokens(); err != nil {
+			return err
+		}
+
+		// Perform the transcription. Any windows after a window which failed
+		// or was decoded again are ignored, and decoded in the next attempt
+		err := whisper.Whisper_full_with_state(task.whisper, task.state, task.params, samples[offset:])
+		if ctx.Err() != nil {
+			return ctx.Err()
+		} else if !retry && !restart {
+			return err
+		}
+
+		// Continue after the last decoded segment, at a higher temperature
+		// if the window failed, or else at the initial temperature
+		next := offset
+		if n := len(task.segments); n > 0 {
+			next = max(next, int(task.segments[n-1].T1*whisper.SampleRate/time.Second))
+		}
+		if retry {
+			t += inc
+		} else if next > offset {
+			t = temperature
+		} else {
+			break
+		}
+		offset = next
+	}
+
+	// Return success
+	return nil
+}
+
+// Append the decoded segments, and call the segment function for each new
+// segment, except for segments below the confidence floor
+func (task *Context) appendSegments(ts time.Duration, segments []decoded, fn NewSegmentFunc) {
+	offset := len(task.result.Segments)
+	for _, seg := range segments {
+		seg.Id = int32(len(task.segments))
+		task.segments = append(task.segments, seg)
+		if fn == nil {
+			continue
+		}
+		if segment := task.newSegment(ts, int32(offset), seg); task.keep(segment) {
+			fn(segment)
+		}
+	}
+}
+
+// Set the prompt tokens from the explicit prompt tokens or the initial
+// prompt, followed by the tokens carried over and the tokens of the windows
+// which have been decoded. Past transcriptions held in
+// the state are never used, so that nothing is carried over between requests
+// which share the state
+func (task *Context) setPromptTokens() error {
+	task.params.SetNoContext(true)
+	carry := append(task.tokens[:len(task.tokens):len(task.tokens)], textTokens(task.segments)...)
+	carry = carry[max(len(carry)-task.context, 0):]
+	if len(carry) == 0 && len(task.prompt) == 0 {
+		task.params.SetPromptTokens(nil)
+		return nil
+	}
+
+	// Tokenize the initial prompt if there are no explicit prompt tokens,
+	// since the initial prompt is ignored when there are prompt tokens
+	tokens := task.prompt[:len(task.prompt):len(task.prompt)]
+	if prompt := task.params.InitialPrompt(); len(tokens) == 0 && prompt != "" {
+		if v, err := whisper.Whisper_tokenize(task.whisper, prompt); err != nil {
+			return err
+		} else {
+			tokens = v
+		}
+	}
+	task.params.SetPromptTokens(append(tokens, carry...))
+
+	// Return success
+	return nil
+}
+
+// Append the text tokens of the transcription to the tokens which are
+// carried over, keeping no more than the maximum number of tokens
+func (task *Context) carryTokens() {
+	if task.context == 0 {
+		task.tokens = nil
+		return
+	}
+	task.tokens = append(task.tokens, textTokens(task.segments)...)
+	if n := len(task.tokens) - task.context; n > 0 {
+		task.tokens = append(task.tokens[:0], task.tokens[n:]...)
+	}
+}
+
 func (ctx *Context) appendResult(ts time.Duration, segments bool) {
 	offset := len(ctx.result.Segments)
 
-	// Append text
-	for i := 0; i < ctx.whisper.NumSegments(); i++ {
-		seg := ctx.whisper.Segment(i)
-		ctx.result.Text += seg.Text
-	}
-	if segments {
-		// Append segments
-		for i := 0; i < ctx.whisper.NumSegments(); i++ {
-			ctx.result.Segments = append(ctx.result.Segments, newSegment(ts, int32(offset), ctx.whisper.Segment(i)))
+	// Append text and segments, except for segments below the confidence floor
+	for _, seg := range ctx.segments {
+		segment := ctx.newSegment(ts, int32(offset), seg)
+		if !ctx.keep(segment) {
+			continue
+		}
+		ctx.result.Text += segment.Text
+		if segments {
+			ctx.result.Segments = append(ctx.result.Segments, segment)
+			ctx.result.Words = append(ctx.result.Words, segment.Words...)
 		}
 	}
 }
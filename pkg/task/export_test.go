@@ -0,0 +1,131 @@
+package task
+
+import (
+	"time"
+
+	// Packages
+	schema "github.com/mutablelogic/go-whisper/pkg/schema"
+	whisper "github.com/mutablelogic/go-whisper/sys/whisper"
+)
+
+//////////////////////////////////////////////////////////////////////////////
+// PUBLIC METHODS
+
+// Merge held back segments with new segments which start at ts, where the
+// held back segments end at end. The timestamps of the segments and their
+// tokens are from the start of the audio. Returns the merged segments
+func MergeSegments(held, segments []*whisper.Segment, ts, end time.Duration) []*schema.Segment {
+	var result []*schema.Segment
+	for i, span := range merge(testSpans(held), testSpans(segments), ts, end) {
+		result = append(result, span.segment(int32(i), ""))
+	}
+	return result
+}
+
+// Return the words of text tokens, with timestamps offset by ts
+func Words(ts time.Duration, tokens []whisper.Token) []*schema.Word {
+	return schemaWords(appendWords(nil, ts, tokens))
+}
+
+// Return the average log probability of the text tokens
+func AvgLogProb(tokens []whisper.Token) float32 {
+	return avgLogProb(appendWords(nil, 0, tokens))
+}
+
+// Return the compression ratio of the text
+func CompressionRatio(text string) float32 {
+	return compressionRatio(text)
+}
+
+// Return the entropy of the tokens
+func Entropy(tokens []int32) float32 {
+	return entropy(tokens)
+}
+
+// Set the compression ratio, entropy and log probability thresholds, which
+// are otherwise set with the parameters
+func (task *Context) SetThresholds(ratio, entropy, logprob float32) {
+	task.ratio = ratio
+	task.params.SetEntropyThreshold(entropy)
+	task.params.SetLogProbThreshold(logprob)
+}
+
+// Return true if decoding a window of segments has failed
+func (task *Context) Failed(segments ...*whisper.Segment) bool {
+	return task.failed(testDecoded(0, segments))
+}
+
+// Append a window of segments decoded at a temperature, calling fn for each
+// new segment
+func (task *Context) AppendWindow(ts time.Duration, temperature float32, fn NewSegmentFunc, segments ...*whisper.Segment) {
+	task.appendSegments(ts, testDecoded(temperature, segments), fn)
+}
+
+// Return the parameters for the next transcription
+func (task *Context) Params() *whisper.FullParams {
+	return &task.params
+}
+
+// Set the explicit prompt tokens and the maximum number of tokens carried
+// over, which are otherwise set with the parameters
+func (task *Context) SetContextTokens(prompt []int32, n int) {
+	task.prompt, task.context = prompt, n
+}
+
+// Carry over the text tokens of the decoded segments, and return the
+// tokens which are carried over
+func (task *Context) CarryTokens(segments ...*whisper.Segment) []int32 {
+	task.segments = testDecoded(0, segments)
+	task.carryTokens()
+	return task.tokens
+}
+
+// Set the prompt tokens after the segments have been decoded, and return
+// the prompt tokens
+func (task *Context) PromptTokens(segments ...*whisper.Segment) ([]int32, error) {
+	task.segments = testDecoded(0, segments)
+	if err := task.setPromptTokens(); err != nil {
+		return nil, err
+	}
+	return task.params.PromptTokens(), nil
+}
+
+// Boost the logits of the vocabulary terms, which are tokens, after the
+// decoded tokens
+func (task *Context) BoostVocabulary(vocabulary [][]int32, tokens []int32, logits []float32) {
+	task.vocabulary = vocabulary
+	task.boostVocabulary(tokens, logits)
+}
+
+// Set the confidence floor, which is otherwise set with the parameters
+func (task *Context) SetFloor(v float32) {
+	task.floor = v
+}
+
+// Append segments decoded at a temperature to the result, as if they had
+// been transcribed from ts
+func (task *Context) AppendResult(ts time.Duration, temperature float32, segments ...*whisper.Segment) {
+	task.segments = testDecoded(temperature, segments)
+	task.appendResult(ts, true)
+}
+
+//////////////////////////////////////////////////////////////////////////////
+// PRIVATE METHODS
+
+// Return segments as spans
+func testSpans(segments []*whisper.Segment) []span {
+	result := make([]span, 0, len(segments))
+	for _, seg := range segments {
+		result = append(result, span{start: seg.T0, end: seg.T1, words: appendWords(nil, 0, seg.Tokens)})
+	}
+	return result
+}
+
+// Return segments decoded at a temperature
+func testDecoded(temperature float32, segments []*whisper.Segment) []decoded {
+	result := make([]decoded, 0, len(segments))
+	for _, seg := range segments {
+		result = append(result, decoded{Segment: seg, temperature: temperature})
+	}
+	return result
+}
@@ -0,0 +1,92 @@
+package task
+
+import (
+	"math"
+	"strings"
+	"time"
+
+	// Packages
+	whisper "github.com/mutablelogic/go-whisper/sys/whisper"
+)
+
+//////////////////////////////////////////////////////////////////////////////
+// GLOBALS
+
+const (
+	// Tolerance when comparing the temperature with the maximum temperature
+	temperatureEpsilon = 1e-3
+
+	// Default compression ratio above which decoding fails
+	defaultCompressionRatio = 2.4
+
+	// Number of tokens at the end of a window for which the entropy is
+	// calculated, as in whisper.cpp
+	entropyTokens = 32
+)
+
+//////////////////////////////////////////////////////////////////////////////
+// PRIVATE METHODS
+
+// Return true if decoding a window has failed, when the compression ratio
+// of the text is above the compression ratio threshold, the average log
+// probability of the text tokens is below the log probability threshold,
+// or the entropy of the last tokens is below the entropy threshold
+func (task *Context) failed(window []decoded) bool {
+	var text strings.Builder
+	var words []word
+	var tokens []int32
+	for _, seg := range window {
+		text.WriteString(seg.Text)
+		words = appendWords(words, 0, seg.Tokens)
+		for _, token := range seg.Tokens {
+			tokens = append(tokens, token.Id)
+		}
+	}
+	if len(words) == 0 {
+		return false
+	}
+	if task.ratio > 0 && compressionRatio(text.String()) > task.ratio {
+		return true
+	}
+	if len(tokens) > entropyTokens && entropy(tokens[len(tokens)-entropyTokens:]) < task.params.EntropyThreshold() {
+		return true
+	}
+	return avgLogProb(words) < task.params.LogProbThreshold()
+}
+
+// Return the entropy of the token counts, which is low when tokens repeat
+func entropy(tokens []int32) float32 {
+	counts := make(map[int32]int, len(tokens))
+	for _, token := range tokens {
+		counts[token]++
+	}
+	var result float64
+	for _, n := range counts {
+		p := float64(n) / float64(len(tokens))
+		result -= p * math.Log(p)
+	}
+	return float32(result)
+}
+
+// Return a segment with the timestamps of the segment and its tokens offset
+func offsetSegment(seg *whisper.Segment, offset time.Duration) *whisper.Segment {
+	seg.T0, seg.T1 = seg.T0+offset, seg.T1+offset
+	for i := range seg.Tokens {
+		seg.Tokens[i].T0 += offset
+		seg.Tokens[i].T1 += offset
+	}
+	return seg
+}
+
+// Return the text tokens of the segments
+func textTokens(segments []decoded) []int32 {
+	var result []int32
+	for _, seg := range segments {
+		for _, token := range seg.Tokens {
+			if token.Type == 0 {
+				result = append(result, token.Id)
+			}
+		}
+	}
+	return result
+}
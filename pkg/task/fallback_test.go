@@ -0,0 +1,121 @@
+package task_test
+
+import (
+	"fmt"
+	"math"
+	"strings"
+	"testing"
+	"time"
+
+	// Packages
+	schema "github.com/mutablelogic/go-whisper/pkg/schema"
+	task "github.com/mutablelogic/go-whisper/pkg/task"
+	whisper "github.com/mutablelogic/go-whisper/sys/whisper"
+	assert "github.com/stretchr/testify/assert"
+)
+
+func Test_fallback_001(t *testing.T) {
+	assert := assert.New(t)
+
+	// The entropy is zero when every token is the same, and the log of the
+	// number of tokens when every token is different
+	assert.Zero(task.Entropy([]int32{1, 1, 1, 1}))
+	assert.InDelta(math.Log(2), task.Entropy([]int32{1, 2, 1, 2}), 1e-6)
+	assert.InDelta(math.Log(32), task.Entropy(distinct(32)), 1e-6)
+}
+
+func Test_fallback_002(t *testing.T) {
+	assert := assert.New(t)
+
+	repeated := strings.Repeat(" the", 32)
+	ratio := task.CompressionRatio(repeated)
+	tests := []struct {
+		name                    string
+		ratio, entropy, logprob float32
+		window                  *whisper.Segment
+		expected                bool
+	}{
+		// A window without words never fails
+		{"no words", 2.4, 2.4, -1, window(nil, -10, 1), false},
+
+		// The compression ratio must be above the threshold, and a zero
+		// threshold disables the check
+		{"ratio above", ratio - 0.1, 0, -1, window(nil, 0, 0, repeated), true},
+		{"ratio equal", ratio, 0, -1, window(nil, 0, 0, repeated), false},
+		{"ratio zero", 0, 0, -1, window(nil, 0, 0, repeated), false},
+
+		// The entropy is of the last 32 tokens, when there are more than 32
+		// tokens, and must be below the threshold
+		{"entropy below", 0, 2.4, -1, window(same(33), 0, 0), true},
+		{"entropy tokens", 0, 2.4, -1, window(same(32), 0, 0), false},
+		{"entropy last", 0, 2.4, -1, window(append(same(1), distinct(32)...), 0, 0), false},
+		{"entropy equal", 0, task.Entropy(distinct(32)), -1, window(append(same(1), distinct(32)...), 0, 0), false},
+
+		// The average log probability must be below the threshold
+		{"logprob below", 0, 0, -1, window(distinct(4), -1.5, 0), true},
+		{"logprob equal", 0, 0, -1, window(distinct(4), -1, 0), false},
+	}
+	for _, test := range tests {
+		ctx := task.New()
+		ctx.CopyParams()
+		ctx.SetThresholds(test.ratio, test.entropy, test.logprob)
+		assert.Equal(test.expected, ctx.Failed(test.window), test.name)
+	}
+}
+
+func Test_fallback_003(t *testing.T) {
+	assert := assert.New(t)
+
+	// Each new segment has the temperature of the window which decoded it
+	var segments []*schema.Segment
+	fn := func(seg *schema.Segment) {
+		segments = append(segments, seg)
+	}
+	ctx := task.New()
+	ctx.CopyParams()
+	ctx.AppendWindow(0, 0, fn, segment(0, "The quick brown"))
+	ctx.AppendWindow(0, 0.4, fn, segment(3, "fox jumps"), segment(5, "over the dog"))
+
+	var temperatures []float32
+	for _, seg := range segments {
+		temperatures = append(temperatures, seg.Temperature)
+	}
+	assert.Equal([]float32{0, 0.4, 0.4}, temperatures)
+}
+
+// Return a segment with a text token for each token id and a non-text token
+// for each of n, where each token has the log probability lp. The text
+// of the tokens is the token id, unless the text is set
+func window(ids []int32, lp float32, n int, text ...string) *whisper.Segment {
+	seg := new(whisper.Segment)
+	for _, id := range ids {
+		seg.Tokens = append(seg.Tokens, whisper.Token{Id: id, Text: fmt.Sprint(" ", id), Plog: lp})
+	}
+	for _, text := range text {
+		seg.Tokens = append(seg.Tokens, whisper.Token{Text: text, Plog: lp})
+	}
+	for i := 0; i < n; i++ {
+		seg.Tokens = append(seg.Tokens, whisper.Token{Text: "[_BEG_]", Plog: lp, Type: 1})
+	}
+	for _, token := range seg.Tokens {
+		if token.Type == 0 {
+			seg.Text += token.Text
+		}
+	}
+	seg.T1 = time.Duration(len(seg.Tokens)) * time.Second
+	return seg
+}
+
+// Return n tokens with the same id
+func same(n int) []int32 {
+	return make([]int32, n)
+}
+
+// Return n tokens with different ids
+func distinct(n int) []int32 {
+	result := make([]int32, n)
+	for i := range result {
+		result[i] = int32(i + 1)
+	}
+	return result
+}
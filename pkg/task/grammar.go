@@ -0,0 +1,42 @@
+package task
+
+import (
+	// Packages
+	grammar "github.com/mutablelogic/go-whisper/pkg/grammar"
+	whisper "github.com/mutablelogic/go-whisper/sys/whisper"
+)
+
+//////////////////////////////////////////////////////////////////////////////
+// PUBLIC METHODS
+
+// Set a grammar in GBNF format which constrains decoding, starting with
+// the root rule. Set to an empty string to remove the grammar
+func (ctx *Context) SetGrammar(src string) error {
+	if src == "" {
+		ctx.params.SetGrammar(nil, 0)
+		return nil
+	}
+	g, err := grammar.Parse(src)
+	if err != nil {
+		return err
+	}
+	root, _ := g.Symbol(grammar.RootRule)
+
+	// Convert the rules
+	rules := make([][]whisper.GrammarElement, len(g.Rules()))
+	for i, rule := range g.Rules() {
+		rules[i] = make([]whisper.GrammarElement, len(rule))
+		for j, elem := range rule {
+			rules[i][j] = whisper.GrammarElement{Type: whisper.GrammarType(elem.Type), Value: elem.Value}
+		}
+	}
+	ctx.params.SetGrammar(rules, int(root))
+
+	// Return success
+	return nil
+}
+
+// Set the penalty for tokens which do not match the grammar
+func (ctx *Context) SetGrammarPenalty(v float32) {
+	ctx.params.SetGrammarPenalty(v)
+}
@@ -0,0 +1,56 @@
+package task
+
+import (
+	"context"
+	"sort"
+
+	// Packages
+	schema "github.com/mutablelogic/go-whisper/pkg/schema"
+	whisper "github.com/mutablelogic/go-whisper/sys/whisper"
+
+	// Namespace imports
+	. "github.com/djthorpe/go-errors"
+)
+
+//////////////////////////////////////////////////////////////////////////////
+// PUBLIC METHODS
+
+// Detect the language of the samples, which should be 16KHz float32 samples
+// in a single channel. Only the first thirty seconds of samples are used.
+// Returns the languages ordered by probability, most probable first
+func (task *Context) DetectLanguage(ctx context.Context, samples []float32) ([]*schema.Language, error) {
+	if len(samples) == 0 {
+		return nil, ErrBadParameter.With("no samples")
+	}
+	if !task.CanTranslate() {
+		return nil, ErrBadParameter.With("model is not multilingual, cannot detect language")
+	}
+
+	// Compute the spectrogram, then detect the language
+	threads := task.params.NumThreads()
+	if err := whisper.Whisper_pcm_to_mel_with_state(task.whisper, task.state, samples, threads); err != nil {
+		return nil, err
+	} else if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	_, probs, err := whisper.Whisper_lang_auto_detect_with_state(task.whisper, task.state, 0, threads)
+	if err != nil {
+		return nil, err
+	}
+
+	// Rank the languages by probability
+	result := make([]*schema.Language, 0, len(probs))
+	for id, p := range probs {
+		result = append(result, &schema.Language{
+			Language:    whisper.Whisper_lang_str(id),
+			Name:        whisper.Whisper_lang_str_full(id),
+			Probability: p,
+		})
+	}
+	sort.SliceStable(result, func(i, j int) bool {
+		return result[i].Probability > result[j].Probability
+	})
+
+	// Return success
+	return result, nil
+}
@@ -0,0 +1,58 @@
+package task
+
+import (
+	"bytes"
+	"compress/zlib"
+
+	// Packages
+	schema "github.com/mutablelogic/go-whisper/pkg/schema"
+)
+
+//////////////////////////////////////////////////////////////////////////////
+// PRIVATE METHODS
+
+// Set the temperature which decoded a segment and the confidence metrics
+// from its words, and add the words if word timestamps are enabled.
+// Returns the segment
+func (task *Context) setMetrics(seg *schema.Segment, temperature float32, words []word) *schema.Segment {
+	seg.Temperature = temperature
+	seg.AvgLogProb = avgLogProb(words)
+	seg.CompressionRatio = compressionRatio(seg.Text)
+	if task.words {
+		seg.Words = schemaWords(words)
+	}
+	return seg
+}
+
+// Return true if the segment is not below the confidence floor
+func (task *Context) keep(seg *schema.Segment) bool {
+	return seg.AvgLogProb >= task.floor
+}
+
+// Return the average log probability of the tokens in the words, or zero
+// if there are no tokens
+func avgLogProb(words []word) float32 {
+	var lp float32
+	var n int
+	for _, word := range words {
+		lp, n = lp+word.lp, n+word.n
+	}
+	if n == 0 {
+		return 0
+	}
+	return lp / float32(n)
+}
+
+// Return the ratio of the length of the text to the length of the
+// compressed text. Repeated text, which is a sign that decoding has
+// failed, has a high compression ratio
+func compressionRatio(text string) float32 {
+	if text == "" {
+		return 0
+	}
+	var buf bytes.Buffer
+	w := zlib.NewWriter(&buf)
+	w.Write([]byte(text))
+	w.Close()
+	return float32(len(text)) / float32(buf.Len())
+}
@@ -0,0 +1,84 @@
+package task_test
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	// Packages
+	task "github.com/mutablelogic/go-whisper/pkg/task"
+	whisper "github.com/mutablelogic/go-whisper/sys/whisper"
+	assert "github.com/stretchr/testify/assert"
+)
+
+func Test_metrics_001(t *testing.T) {
+	assert := assert.New(t)
+
+	// The average is over the text tokens of all the words
+	assert.InDelta(-0.6, task.AvgLogProb([]whisper.Token{
+		{Text: " Hel", Plog: -1},
+		{Text: "lo", Plog: -0.5},
+		{Text: " world", Plog: -0.3},
+		{Text: "[_TT_100]", Plog: -10, Type: 1},
+	}), 1e-6)
+
+	// With no text tokens, the average is zero
+	assert.Zero(task.AvgLogProb(nil))
+	assert.Zero(task.AvgLogProb([]whisper.Token{{Text: "[_BEG_]", Plog: -10, Type: 1}}))
+}
+
+func Test_metrics_002(t *testing.T) {
+	assert := assert.New(t)
+
+	// Empty text has no compression ratio
+	assert.Zero(task.CompressionRatio(""))
+
+	// Text without repetition does not compress, and repeated text compresses
+	// above the default threshold of 2.4
+	assert.Less(task.CompressionRatio(" And so, my fellow Americans, ask not what your country can do for you."), float32(1.5))
+	assert.Greater(task.CompressionRatio(strings.Repeat(" the", 32)), float32(2.4))
+}
+
+func Test_metrics_003(t *testing.T) {
+	assert := assert.New(t)
+
+	// Segments have the temperature and confidence metrics
+	ctx := task.New()
+	ctx.CopyParams()
+	ctx.AppendResult(time.Second, 0.2, logprob(0, "hello world", -0.25))
+
+	segments := ctx.Result().Segments
+	if assert.Len(segments, 1) {
+		assert.Equal(float32(0.2), segments[0].Temperature)
+		assert.InDelta(-0.25, segments[0].AvgLogProb, 1e-6)
+		assert.Equal(task.CompressionRatio(" hello world"), segments[0].CompressionRatio)
+	}
+}
+
+func Test_metrics_004(t *testing.T) {
+	assert := assert.New(t)
+
+	// Segments below the confidence floor are dropped from the segments and
+	// the text, and a segment at the floor is kept
+	ctx := task.New()
+	ctx.CopyParams()
+	ctx.SetFloor(-0.5)
+	ctx.AppendResult(0, 0, logprob(0, "kept", -0.2), logprob(1, "dropped", -1), logprob(2, "floor", -0.5))
+
+	var text []string
+	for _, seg := range ctx.Result().Segments {
+		text = append(text, strings.TrimSpace(seg.Text))
+	}
+	assert.Equal([]string{"kept", "floor"}, text)
+	assert.Equal(" kept floor", ctx.Result().Text)
+}
+
+// Return a segment which starts at a number of seconds, where every token
+// has the log probability lp
+func logprob(start int, text string, lp float32) *whisper.Segment {
+	seg := segment(start, text)
+	for i := range seg.Tokens {
+		seg.Tokens[i].Plog = lp
+	}
+	return seg
+}
@@ -0,0 +1,282 @@
+package task
+
+import (
+	"encoding/binary"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+
+	// Packages
+	schema "github.com/mutablelogic/go-whisper/pkg/schema"
+	whisper "github.com/mutablelogic/go-whisper/sys/whisper"
+
+	// Namespace imports
+	. "github.com/djthorpe/go-errors"
+)
+
+//////////////////////////////////////////////////////////////////////////////
+// TYPES
+
+// ModelCache holds the loaded model weights, which are shared between
+// contexts. Weights are loaded when the first context for a model is
+// initialised, and freed when the last context for the model is closed
+type ModelCache struct {
+	sync.Mutex
+
+	// Base path for models
+	path string
+
+	// GPU flags
+	gpu int
+
+	// Loaded models
+	models map[string]*weights
+}
+
+// Model weights, and the number of contexts which reference them.
+// The size of the weights and of each state are estimated. The loaded
+// channel is closed when the weights have been loaded, or have failed to load
+type weights struct {
+	id      string
+	whisper *whisper.Context
+	refs    int
+	size    uint64
+	state   uint64
+	loaded  chan struct{}
+	err     error
+}
+
+// Model hyperparameters, read from the header of the model file
+type hparams struct {
+	Vocab      int32
+	AudioCtx   int32
+	AudioState int32
+	AudioHead  int32
+	AudioLayer int32
+	TextCtx    int32
+	TextState  int32
+	TextHead   int32
+	TextLayer  int32
+	Mels       int32
+	Ftype      int32
+}
+
+//////////////////////////////////////////////////////////////////////////////
+// GLOBALS
+
+const (
+	// Magic number at the start of a model file
+	ggmlMagic = 0x67676d6c
+)
+
+//////////////////////////////////////////////////////////////////////////////
+// LIFECYCLE
+
+// Create a new model cache, with the path for the model storage.
+// If gpu is -1 then disable, if 0 then use default, if >0 then enable
+// and use the specified device
+func NewModelCache(path string, gpu int) *ModelCache {
+	cache := new(ModelCache)
+	cache.path = path
+	cache.gpu = gpu
+	cache.models = make(map[string]*weights)
+	return cache
+}
+
+//////////////////////////////////////////////////////////////////////////////
+// STRINGIFY
+
+func (c *ModelCache) MarshalJSON() ([]byte, error) {
+	type j struct {
+		Model  string `json:"model"`
+		Refs   int    `json:"refs"`
+		Memory uint64 `json:"memory"`
+	}
+	c.Lock()
+	defer c.Unlock()
+	result := make([]j, 0, len(c.models))
+	for _, model := range c.models {
+		result = append(result, j{Model: model.id, Refs: model.refs, Memory: model.memory()})
+	}
+	sort.Slice(result, func(a, b int) bool {
+		return result[a].Model < result[b].Model
+	})
+	return json.Marshal(result)
+}
+
+//////////////////////////////////////////////////////////////////////////////
+// PUBLIC METHODS
+
+// Return the number of models loaded
+func (c *ModelCache) Len() int {
+	c.Lock()
+	defer c.Unlock()
+	return len(c.models)
+}
+
+// Return the estimated memory used by loaded models, in bytes
+func (c *ModelCache) Used() uint64 {
+	c.Lock()
+	defer c.Unlock()
+	var result uint64
+	for _, model := range c.models {
+		result += model.memory()
+	}
+	return result
+}
+
+// Return the estimated memory needed to initialise a context for a model,
+// in bytes. If the model is already loaded, or is being loaded, then only
+// the memory for the state is needed
+func (c *ModelCache) Need(model *schema.Model) (uint64, error) {
+	c.Lock()
+	w, exists := c.models[model.Id]
+	if exists && w.whisper != nil {
+		defer c.Unlock()
+		return w.state, nil
+	}
+	c.Unlock()
+
+	// Estimate the memory needed from the model file
+	size, state, err := estimate(filepath.Join(c.path, model.Path))
+	if err != nil {
+		return 0, err
+	} else if exists {
+		return state, nil
+	}
+	return size + state, nil
+}
+
+//////////////////////////////////////////////////////////////////////////////
+// PRIVATE METHODS
+
+// Return the weights for a model, loading them if necessary, and add
+// a reference. The lock is not held while the weights are loaded, and
+// other callers for the same model wait for the weights to be loaded
+func (c *ModelCache) get(m *schema.Model) (*weights, error) {
+	c.Lock()
+
+	// Wait for the model to be loaded, and return the weights
+	if w, exists := c.models[m.Id]; exists {
+		w.refs++
+		c.Unlock()
+		<-w.loaded
+		if w.err != nil {
+			return nil, w.err
+		}
+		return w, nil
+	}
+
+	// Add the weights before loading them, so the model is only loaded once
+	w := &weights{id: m.Id, refs: 1, loaded: make(chan struct{})}
+	c.models[m.Id] = w
+	c.Unlock()
+
+	// Load the weights, and remove them on error
+	ctx, size, state, err := c.load(filepath.Join(c.path, m.Path))
+	c.Lock()
+	if err != nil {
+		delete(c.models, m.Id)
+	}
+	w.whisper, w.size, w.state, w.err = ctx, size, state, err
+	c.Unlock()
+	close(w.loaded)
+
+	// Return the weights
+	if w.err != nil {
+		return nil, w.err
+	}
+	return w, nil
+}
+
+// Load the weights from a model file, without a state, and return the
+// estimated memory used by the weights and by each state
+func (c *ModelCache) load(path string) (*whisper.Context, uint64, uint64, error) {
+	// Get default parameters
+	params := whisper.DefaultContextParams()
+
+	// If gpu is -1, then disable
+	// If gpu is 0, then use whatever the default is
+	// If gpu is >0, then enable and set the device
+	if c.gpu == -1 {
+		params.SetUseGpu(false)
+	} else if c.gpu > 0 {
+		params.SetUseGpu(true)
+		params.SetGpuDevice(c.gpu)
+	}
+
+	// Estimate the memory used
+	size, state, err := estimate(path)
+	if err != nil {
+		return nil, 0, 0, err
+	}
+
+	// Load the weights, without a state
+	ctx := whisper.Whisper_init_from_file_with_params_no_state(path, params)
+	if ctx == nil {
+		return nil, 0, 0, ErrInternalAppError.With("whisper_init")
+	}
+
+	// Return success
+	return ctx, size, state, nil
+}
+
+// Remove a reference to the weights for a model, and free them when
+// there are no more references
+func (c *ModelCache) release(w *weights) {
+	c.Lock()
+	defer c.Unlock()
+
+	if w.refs--; w.refs > 0 {
+		return
+	}
+	whisper.Whisper_free(w.whisper)
+	w.whisper = nil
+	delete(c.models, w.id)
+}
+
+// Return the estimated memory used by the weights and states, in bytes
+func (w *weights) memory() uint64 {
+	return w.size + uint64(w.refs)*w.state
+}
+
+// Estimate the memory used by the weights of a model, and by each state,
+// in bytes. The weights are loaded into memory, so the size of the
+// weights is the size of the file. The state is dominated by the key and
+// value caches and the encoder attention, which are sized from the header
+func estimate(path string) (uint64, uint64, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return 0, 0, err
+	}
+	defer f.Close()
+
+	// Get the size of the file
+	info, err := f.Stat()
+	if err != nil {
+		return 0, 0, err
+	}
+
+	// Read the header
+	var magic uint32
+	var hparams hparams
+	if err := binary.Read(f, binary.LittleEndian, &magic); err != nil {
+		return 0, 0, err
+	} else if magic != ggmlMagic {
+		return 0, 0, ErrBadParameter.Withf("not a model file: %q", filepath.Base(path))
+	}
+	if err := binary.Read(f, binary.LittleEndian, &hparams); err != nil {
+		return 0, 0, err
+	}
+
+	// Self-attention and cross-attention caches, stored as f16 keys and values,
+	// and the encoder attention scores stored as f32
+	textCtx := (uint64(hparams.TextCtx) + 255) &^ 255
+	kv := 2 * 2 * uint64(hparams.TextState) * uint64(hparams.TextLayer) * (textCtx + uint64(hparams.AudioCtx))
+	attn := 4 * uint64(hparams.AudioHead) * uint64(hparams.AudioCtx) * uint64(hparams.AudioCtx)
+
+	// Return the estimates
+	return uint64(info.Size()), kv + attn, nil
+}
@@ -0,0 +1,238 @@
+package task
+
+import (
+	"context"
+	"strings"
+	"time"
+	"unicode"
+
+	// Packages
+	schema "github.com/mutablelogic/go-whisper/pkg/schema"
+	whisper "github.com/mutablelogic/go-whisper/sys/whisper"
+
+	// Namespace imports
+	. "github.com/djthorpe/go-errors"
+)
+
+//////////////////////////////////////////////////////////////////////////////
+// TYPES
+
+// A span is a transcribed segment which is split into words, so that
+// the words at the boundary between overlapping segments can be aligned
+type span struct {
+	start, end   time.Duration
+	speakerTurn  bool
+	temperature  float32
+	noSpeechProb float32
+	words        []word
+}
+
+//////////////////////////////////////////////////////////////////////////////
+// GLOBALS
+
+const (
+	// Minimum number of words which need to match in the overlap between
+	// two segments for the words to be aligned
+	minOverlapWords = 2
+)
+
+//////////////////////////////////////////////////////////////////////////////
+// PUBLIC METHODS
+
+// Set the duration of audio which is repeated at the start of each call
+// to Transcribe. Duplicated words in the overlap are removed, and segments
+// at the end of each call are held back until the next call or Flush
+func (ctx *Context) SetOverlap(v time.Duration) error {
+	if v < 0 {
+		return ErrBadParameter.With("invalid overlap")
+	}
+	ctx.overlap = v
+	return nil
+}
+
+// Return the overlap duration
+func (ctx *Context) Overlap() time.Duration {
+	return ctx.overlap
+}
+
+// Flush any segments which have been held back, appending them to the
+// result, and discard the tokens carried over. This should be called after
+// the last call to Transcribe, and before transcribing another channel
+func (ctx *Context) Flush(fn NewSegmentFunc) {
+	ctx.emit(ctx.held, fn)
+	ctx.held, ctx.end = nil, 0
+	ctx.tokens = nil
+}
+
+//////////////////////////////////////////////////////////////////////////////
+// PRIVATE METHODS
+
+// Transcribe samples which overlap the previous samples, and merge the
+// new segments with any held back segments
+func (task *Context) transcribeOverlap(ctx context.Context, ts time.Duration, samples []float32, fn NewSegmentFunc) error {
+	// Word timestamps are needed to align the overlap, restoring the
+	// flag afterwards
+	defer task.params.SetTokenTimestamps(task.params.TokenTimestamps())
+	task.params.SetTokenTimestamps(true)
+	if err := task.transcribe(ctx, ts, samples, nil); err != nil {
+		return err
+	}
+
+	// Merge the segments in the overlap with the held back segments
+	spans := task.spans(ts)
+	if len(task.held) > 0 && ts < task.end {
+		spans = merge(task.held, spans, ts, task.end)
+	} else {
+		task.emit(task.held, fn)
+	}
+
+	// Hold back segments which end in the overlap with the next samples
+	end := ts + time.Duration(len(samples))*time.Second/whisper.SampleRate
+	i := len(spans)
+	for i > 0 && spans[i-1].end > end-task.overlap {
+		i--
+	}
+	task.emit(spans[:i], fn)
+	task.held, task.end = spans[i:], end
+
+	// Return success
+	return nil
+}
+
+// Return the segments from the state as spans, with words made from
+// the text tokens
+func (task *Context) spans(ts time.Duration) []span {
+	result := make([]span, 0, len(task.segments))
+	for _, seg := range task.segments {
+		span := span{start: seg.T0 + ts, end: seg.T1 + ts, speakerTurn: seg.SpeakerTurn, temperature: seg.temperature, noSpeechProb: seg.NoSpeechProb}
+		span.words = appendWords(nil, ts, seg.Tokens)
+		if len(span.words) > 0 {
+			result = append(result, span)
+		}
+	}
+	return result
+}
+
+// Append spans to the result as segments, and call the segment function
+// for each one if it's not nil
+func (task *Context) emit(spans []span, fn NewSegmentFunc) {
+	for _, span := range spans {
+		seg := task.setMetrics(span.segment(int32(len(task.result.Segments)), task.speaker), span.temperature, span.words)
+		if !task.keep(seg) {
+			continue
+		}
+		task.result.Text += seg.Text
+		task.result.Segments = append(task.result.Segments, seg)
+		task.result.Words = append(task.result.Words, seg.Words...)
+		if fn != nil {
+			fn(seg)
+		}
+	}
+}
+
+// Merge the held back spans with the new spans, where the new spans start
+// at ts and the held back spans end at end. The words in the overlap are
+// aligned on the longest run of matching words, keeping the held back words
+// up to the end of the run and the new words after it. If there is no run,
+// then the overlap is split at the midpoint.
+func merge(held, spans []span, ts, end time.Duration) []span {
+	a, b := words(held), words(spans)
+
+	// Find the words in the overlap
+	i, j := len(a), 0
+	for i > 0 && a[i-1].t1 > ts {
+		i--
+	}
+	for j < len(b) && b[j].t0 < end {
+		j++
+	}
+
+	// Find the longest run of matching words
+	x, y, n := align(a[i:], b[:j])
+	if n >= min(minOverlapWords, len(a)-i, j) && n > 0 {
+		i, j = i+x+n, y+n
+	} else {
+		mid := ts + (end-ts)/2
+		for i = len(a); i > 0 && a[i-1].t0 >= mid; i-- {
+		}
+		for j = 0; j < len(b) && b[j].t0 < mid; j++ {
+		}
+	}
+
+	// Return the held back words before the cut, and the new words after it
+	return append(trim(held, 0, i), trim(spans, j, len(b))...)
+}
+
+// Return the longest run of matching words in a and b, as the start of
+// the run in a and b, and the length of the run
+func align(a, b []word) (int, int, int) {
+	var x, y, n int
+	for i := range a {
+		for j := range b {
+			k := 0
+			for i+k < len(a) && j+k < len(b) && normalize(a[i+k].text) == normalize(b[j+k].text) {
+				k++
+			}
+			if k > n {
+				x, y, n = i, j, k
+			}
+		}
+	}
+	return x, y, n
+}
+
+// Return the words of the spans
+func words(spans []span) []word {
+	var result []word
+	for _, span := range spans {
+		result = append(result, span.words...)
+	}
+	return result
+}
+
+// Return the spans which contain the words from index i up to index j,
+// adjusting the timestamps of any spans which are cut
+func trim(spans []span, i, j int) []span {
+	var result []span
+	var k int
+	for _, s := range spans {
+		from, to := max(i-k, 0), min(j-k, len(s.words))
+		k += len(s.words)
+		if from >= to {
+			continue
+		}
+		if from > 0 {
+			s.start = s.words[from].t0
+		}
+		if to < len(s.words) {
+			s.end = s.words[to-1].t1
+		}
+		s.words = s.words[from:to]
+		result = append(result, s)
+	}
+	return result
+}
+
+// Return a word in lower case, without punctuation
+func normalize(v string) string {
+	return strings.ToLower(strings.TrimFunc(v, func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+	}))
+}
+
+// Return a span as a segment
+func (s span) segment(id int32, speaker string) *schema.Segment {
+	var text strings.Builder
+	for _, word := range s.words {
+		text.WriteString(word.text)
+	}
+	return &schema.Segment{
+		Id:           id,
+		Start:        schema.Timestamp(s.start),
+		End:          schema.Timestamp(s.end),
+		Text:         text.String(),
+		SpeakerTurn:  s.speakerTurn,
+		Speaker:      speaker,
+		NoSpeechProb: s.noSpeechProb,
+	}
+}
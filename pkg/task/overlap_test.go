@@ -0,0 +1,73 @@
+package task_test
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	// Packages
+	task "github.com/mutablelogic/go-whisper/pkg/task"
+	whisper "github.com/mutablelogic/go-whisper/sys/whisper"
+	assert "github.com/stretchr/testify/assert"
+)
+
+func Test_overlap_001(t *testing.T) {
+	assert := assert.New(t)
+
+	// Each test merges segments held back until 5s with new segments from
+	// 3s, or from 2s in the last test
+	tests := []struct {
+		name      string
+		held, new []*whisper.Segment
+		ts        time.Duration
+		expected  []string
+	}{
+		{
+			// The held back words are kept up to the end of the matching
+			// words, ignoring case and punctuation, and the new segment is
+			// cut after them
+			name:     "match",
+			held:     []*whisper.Segment{segment(0, "The quick brown fox jumps")},
+			new:      []*whisper.Segment{segment(3, "Fox, jumps over the dog")},
+			ts:       3 * time.Second,
+			expected: []string{"0s-5s The quick brown fox jumps", "5s-8s over the dog"},
+		},
+		{
+			// With no matching words, the overlap is cut at the midpoint
+			// of 4s, where the word which starts at 4s is new
+			name:     "midpoint",
+			held:     []*whisper.Segment{segment(0, "The quick brown fox jumps")},
+			new:      []*whisper.Segment{segment(3, "box bumps over the dog")},
+			ts:       3 * time.Second,
+			expected: []string{"0s-4s The quick brown fox", "4s-8s bumps over the dog"},
+		},
+		{
+			// Spans are cut partway through on both sides of the midpoint
+			// of 3.5s, and spans before the overlap are kept whole
+			name:     "spans",
+			held:     []*whisper.Segment{segment(0, "The quick brown"), segment(3, "fox jumps")},
+			new:      []*whisper.Segment{segment(2, "red cat sat"), segment(5, "down")},
+			ts:       2 * time.Second,
+			expected: []string{"0s-3s The quick brown", "3s-4s fox", "4s-5s sat", "5s-6s down"},
+		},
+	}
+	for _, test := range tests {
+		var result []string
+		for _, seg := range task.MergeSegments(test.held, test.new, test.ts, 5*time.Second) {
+			result = append(result, time.Duration(seg.Start).String()+"-"+time.Duration(seg.End).String()+" "+strings.TrimSpace(seg.Text))
+		}
+		assert.Equal(test.expected, result, test.name)
+	}
+}
+
+// Return a segment which starts at a number of seconds, with a word for
+// each second
+func segment(start int, text string) *whisper.Segment {
+	seg := &whisper.Segment{Text: " " + text, T0: time.Duration(start) * time.Second}
+	for _, word := range strings.Fields(text) {
+		t0 := seg.T0 + time.Duration(len(seg.Tokens))*time.Second
+		seg.Tokens = append(seg.Tokens, whisper.Token{Text: " " + word, T0: t0, T1: t0 + time.Second})
+	}
+	seg.T1 = seg.T0 + time.Duration(len(seg.Tokens))*time.Second
+	return seg
+}
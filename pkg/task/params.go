@@ -0,0 +1,201 @@
+package task
+
+import (
+	"regexp"
+	"strings"
+
+	// Packages
+	grammar "github.com/mutablelogic/go-whisper/pkg/grammar"
+
+	// Namespace imports
+	. "github.com/djthorpe/go-errors"
+)
+
+//////////////////////////////////////////////////////////////////////////////
+// TYPES
+
+// Params are the decoding parameters for a transcription. Any parameter
+// which is nil keeps the default value
+type Params struct {
+	Temperature      *float32 `json:"temperature,omitempty"`             // initial decoding temperature
+	TemperatureInc   *float32 `json:"temperature_inc,omitempty"`         // temperature increase when decoding fails, or zero to disable
+	BeamSize         *int     `json:"beam_size,omitempty"`               // number of beams for beam search, or zero for greedy sampling
+	BestOf           *int     `json:"best_of,omitempty"`                 // number of candidates when sampling with a non-zero temperature
+	Patience         *float32 `json:"patience,omitempty"`                // beam search patience
+	EntropyThreshold *float32 `json:"entropy_thold,omitempty"`           // decoding fails when the entropy of the tokens is below this
+	RatioThreshold   *float32 `json:"compression_ratio_thold,omitempty"` // decoding fails when the compression ratio of the text is above this, or zero to disable
+	LogProbThreshold *float32 `json:"logprob_thold,omitempty"`           // decoding fails when the average log probability is below this
+	MaxLen           *int     `json:"max_len,omitempty"`                 // maximum segment length in characters, or zero for no limit
+	SplitOnWord      *bool    `json:"split_on_word,omitempty"`           // split segments on words rather than tokens, with max_len
+	SuppressBlank    *bool    `json:"suppress_blank,omitempty"`          // suppress blank output at the start of a segment
+	SuppressRegex    *string  `json:"suppress_regex,omitempty"`          // suppress tokens which match a regular expression
+	Prompt           *string  `json:"prompt,omitempty"`                  // text which provides context, such as names and spellings
+	PromptTokens     []int32  `json:"prompt_tokens,omitempty"`           // tokens which are used instead of the prompt text
+	ContextTokens    *int     `json:"context_tokens,omitempty"`          // number of tokens carried over between segments, or zero to disable
+	MinAvgLogProb    *float32 `json:"min_avg_logprob,omitempty"`         // segments with an average log probability below this are dropped
+	Grammar          *string  `json:"grammar,omitempty"`                 // grammar in GBNF format which constrains decoding
+	GrammarPenalty   *float32 `json:"grammar_penalty,omitempty"`         // penalty for tokens which do not match the grammar
+	Vocabulary       []string `json:"vocabulary,omitempty"`              // terms which are boosted during decoding, repeated or comma-separated
+}
+
+//////////////////////////////////////////////////////////////////////////////
+// GLOBALS
+
+const (
+	maxTemperature = 1.0
+
+	// Maximum number of tokens which are carried over from one segment to
+	// the next, which is half the text context of the decoder. The prompt
+	// is truncated by whisper to this length
+	maxContextTokens = 224
+)
+
+//////////////////////////////////////////////////////////////////////////////
+// PUBLIC METHODS
+
+// Validate the parameters, and return ErrBadParameter if any are out of range
+func (p Params) Validate() error {
+	if p.Temperature != nil && (*p.Temperature < 0 || *p.Temperature > maxTemperature) {
+		return ErrBadParameter.Withf("temperature must be between 0 and %v", maxTemperature)
+	}
+	if p.TemperatureInc != nil && (*p.TemperatureInc < 0 || *p.TemperatureInc > maxTemperature) {
+		return ErrBadParameter.Withf("temperature_inc must be between 0 and %v", maxTemperature)
+	}
+	if p.BeamSize != nil && (*p.BeamSize < 0 || *p.BeamSize > maxDecoders) {
+		return ErrBadParameter.Withf("beam_size must be between 0 and %v", maxDecoders)
+	}
+	if p.BestOf != nil && (*p.BestOf < 1 || *p.BestOf > maxDecoders) {
+		return ErrBadParameter.Withf("best_of must be between 1 and %v", maxDecoders)
+	}
+	if p.Patience != nil && *p.Patience <= 0 {
+		return ErrBadParameter.With("patience must be positive")
+	}
+	if p.EntropyThreshold != nil && *p.EntropyThreshold < 0 {
+		return ErrBadParameter.With("entropy_thold cannot be negative")
+	}
+	if p.RatioThreshold != nil && *p.RatioThreshold < 0 {
+		return ErrBadParameter.With("compression_ratio_thold cannot be negative")
+	}
+	if p.LogProbThreshold != nil && *p.LogProbThreshold > 0 {
+		return ErrBadParameter.With("logprob_thold cannot be positive")
+	}
+	if p.MaxLen != nil && *p.MaxLen < 0 {
+		return ErrBadParameter.With("max_len cannot be negative")
+	}
+	if p.MinAvgLogProb != nil && *p.MinAvgLogProb > 0 {
+		return ErrBadParameter.With("min_avg_logprob cannot be positive")
+	}
+	if len(p.PromptTokens) > maxContextTokens {
+		return ErrBadParameter.Withf("prompt_tokens cannot have more than %v tokens", maxContextTokens)
+	}
+	if p.ContextTokens != nil && (*p.ContextTokens < 0 || *p.ContextTokens > maxContextTokens) {
+		return ErrBadParameter.Withf("context_tokens must be between 0 and %v", maxContextTokens)
+	}
+	if p.Grammar != nil && *p.Grammar != "" {
+		if _, err := grammar.Parse(*p.Grammar); err != nil {
+			return err
+		}
+	}
+	if p.GrammarPenalty != nil && *p.GrammarPenalty < 0 {
+		return ErrBadParameter.With("grammar_penalty cannot be negative")
+	}
+	if len(p.vocabulary()) > maxVocabulary {
+		return ErrBadParameter.Withf("vocabulary cannot have more than %v terms", maxVocabulary)
+	}
+	if p.SuppressRegex != nil {
+		if _, err := regexp.Compile(*p.SuppressRegex); err != nil {
+			return ErrBadParameter.Withf("suppress_regex: %v", err)
+		}
+	}
+	return nil
+}
+
+// Set the decoding parameters for the next transcription, after validating
+// them. Parameters which are nil are not changed. The beam size is set
+// first, since it resets the other sampling parameters
+func (ctx *Context) SetParams(p Params) error {
+	if err := p.Validate(); err != nil {
+		return err
+	} else if err := ctx.validateTokens(p.PromptTokens); err != nil {
+		return err
+	}
+	if p.BeamSize != nil {
+		ctx.SetBeamSize(*p.BeamSize)
+	}
+	if p.BestOf != nil {
+		ctx.SetBestOf(*p.BestOf)
+	}
+	if p.Patience != nil {
+		ctx.SetPatience(*p.Patience)
+	}
+	if p.Temperature != nil {
+		ctx.params.SetTemperature(*p.Temperature)
+	}
+	if p.TemperatureInc != nil {
+		ctx.params.SetTemperatureInc(*p.TemperatureInc)
+	}
+	if p.EntropyThreshold != nil {
+		ctx.params.SetEntropyThreshold(*p.EntropyThreshold)
+	}
+	if p.RatioThreshold != nil {
+		ctx.ratio = *p.RatioThreshold
+	}
+	if p.LogProbThreshold != nil {
+		ctx.params.SetLogProbThreshold(*p.LogProbThreshold)
+	}
+	if p.MaxLen != nil {
+		ctx.params.SetMaxLen(*p.MaxLen)
+	}
+	if p.SplitOnWord != nil {
+		ctx.params.SetSplitOnWord(*p.SplitOnWord)
+	}
+	if p.SuppressBlank != nil {
+		ctx.params.SetSuppressBlank(*p.SuppressBlank)
+	}
+	if p.SuppressRegex != nil {
+		ctx.params.SetSuppressRegex(*p.SuppressRegex)
+	}
+	if p.Prompt != nil {
+		ctx.SetPrompt(*p.Prompt)
+	}
+	if p.PromptTokens != nil {
+		ctx.prompt = p.PromptTokens
+	}
+	if p.ContextTokens != nil {
+		ctx.context = *p.ContextTokens
+	}
+	if p.MinAvgLogProb != nil {
+		ctx.floor = *p.MinAvgLogProb
+	}
+	if p.Grammar != nil {
+		if err := ctx.SetGrammar(*p.Grammar); err != nil {
+			return err
+		}
+	}
+	if p.GrammarPenalty != nil {
+		ctx.SetGrammarPenalty(*p.GrammarPenalty)
+	}
+	if p.Vocabulary != nil {
+		if err := ctx.SetVocabulary(p.vocabulary()); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+//////////////////////////////////////////////////////////////////////////////
+// PRIVATE METHODS
+
+// Return the vocabulary terms, splitting values on commas and removing
+// empty terms
+func (p Params) vocabulary() []string {
+	var terms []string
+	for _, v := range p.Vocabulary {
+		for _, term := range strings.Split(v, ",") {
+			if term = strings.TrimSpace(term); term != "" {
+				terms = append(terms, term)
+			}
+		}
+	}
+	return terms
+}
@@ -0,0 +1,185 @@
+package task_test
+
+import (
+	"strings"
+	"testing"
+
+	// Packages
+	task "github.com/mutablelogic/go-whisper/pkg/task"
+	whisper "github.com/mutablelogic/go-whisper/sys/whisper"
+	assert "github.com/stretchr/testify/assert"
+
+	// Namespace imports
+	. "github.com/djthorpe/go-errors"
+)
+
+func Test_params_001(t *testing.T) {
+	assert := assert.New(t)
+
+	// Parameters are applied to the context, and parameters which are nil
+	// keep the default value
+	ctx := task.New()
+	ctx.CopyParams()
+	inc := ctx.Params().TemperatureInc()
+	temperature, entropy, logprob := float32(0.4), float32(2.8), float32(-0.5)
+	assert.NoError(ctx.SetParams(task.Params{Temperature: &temperature, EntropyThreshold: &entropy, LogProbThreshold: &logprob}))
+	assert.Equal(temperature, ctx.Params().Temperature())
+	assert.Equal(entropy, ctx.Params().EntropyThreshold())
+	assert.Equal(logprob, ctx.Params().LogProbThreshold())
+	assert.Equal(inc, ctx.Params().TemperatureInc())
+}
+
+func Test_params_002(t *testing.T) {
+	assert := assert.New(t)
+
+	// Parameters which are out of range are rejected, and no parameters are
+	// applied
+	ctx := task.New()
+	ctx.CopyParams()
+	temperature, entropy, invalid, regex := float32(0.4), float32(2.8), float32(1.5), "[0-9"
+	assert.NoError(ctx.SetParams(task.Params{Temperature: &temperature}))
+	assert.ErrorIs(ctx.SetParams(task.Params{EntropyThreshold: &entropy, Temperature: &invalid}), ErrBadParameter)
+	assert.ErrorIs(ctx.SetParams(task.Params{EntropyThreshold: &entropy, SuppressRegex: &regex}), ErrBadParameter)
+	assert.Equal(temperature, ctx.Params().Temperature())
+	assert.NotEqual(entropy, ctx.Params().EntropyThreshold())
+}
+
+func Test_params_003(t *testing.T) {
+	assert := assert.New(t)
+
+	// The text tokens of each transcription are carried over, keeping the
+	// last tokens
+	ctx := task.New()
+	ctx.CopyParams()
+	ctx.SetContextTokens(nil, 4)
+	assert.Equal([]int32{1, 2, 3}, ctx.CarryTokens(window([]int32{1, 2, 3}, 0, 1)))
+	assert.Equal([]int32{2, 3, 4, 5}, ctx.CarryTokens(window([]int32{4}, 0, 0), window([]int32{5}, 0, 0)))
+
+	// The prompt is the tokens carried over followed by the tokens of the
+	// windows which have been decoded, keeping the last tokens
+	prompt, err := ctx.PromptTokens(window([]int32{6}, 0, 1))
+	assert.NoError(err)
+	assert.Equal([]int32{3, 4, 5, 6}, prompt)
+}
+
+func Test_params_004(t *testing.T) {
+	assert := assert.New(t)
+
+	// Nothing is carried over when the context tokens are disabled
+	ctx := task.New()
+	ctx.CopyParams()
+	ctx.SetContextTokens(nil, 0)
+	assert.Empty(ctx.CarryTokens(window([]int32{1, 2, 3}, 0, 0)))
+	prompt, err := ctx.PromptTokens(window([]int32{4}, 0, 0))
+	assert.NoError(err)
+	assert.Empty(prompt)
+}
+
+func Test_params_005(t *testing.T) {
+	assert := assert.New(t)
+
+	// The confidence floor drops segments from the result
+	ctx := task.New()
+	ctx.CopyParams()
+	floor := float32(-0.8)
+	assert.NoError(ctx.SetParams(task.Params{MinAvgLogProb: &floor}))
+	ctx.AppendResult(0, 0, logprob(0, "kept", -0.5), logprob(1, "dropped", -1))
+	assert.Equal(" kept", ctx.Result().Text)
+}
+
+func Test_params_006(t *testing.T) {
+	assert := assert.New(t)
+
+	// Explicit prompt tokens are used instead of the prompt text, followed by
+	// the tokens carried over
+	ctx := task.New()
+	ctx.CopyParams()
+	ctx.SetPrompt("Whisper, GGML")
+	ctx.SetContextTokens([]int32{7, 8}, 4)
+	prompt, err := ctx.PromptTokens(window([]int32{1, 2}, 0, 0))
+	assert.NoError(err)
+	assert.Equal([]int32{7, 8, 1, 2}, prompt)
+}
+
+func Test_params_007(t *testing.T) {
+	assert := assert.New(t)
+
+	// The grammar rules are set from the grammar, including a rule which is
+	// generated for the repetition. The rules are kept when the grammar
+	// cannot be parsed, and removed when the grammar is empty
+	ctx := task.New()
+	ctx.CopyParams()
+	valid, invalid, empty := `root ::= "on" | "off" | number
+number ::= [0-9]+`, `root ::= "on`, ""
+	assert.NoError(ctx.SetParams(task.Params{Grammar: &valid}))
+	assert.Equal(3, ctx.Params().NumGrammarRules())
+	assert.ErrorIs(ctx.SetParams(task.Params{Grammar: &invalid}), ErrBadParameter)
+	assert.Equal(3, ctx.Params().NumGrammarRules())
+	assert.NoError(ctx.SetParams(task.Params{Grammar: &empty}))
+	assert.Zero(ctx.Params().NumGrammarRules())
+}
+
+func Test_params_008(t *testing.T) {
+	assert := assert.New(t)
+
+	// The first token of each term is boosted, and the next token of a term
+	// is boosted more after the first tokens of the term have been decoded.
+	// Tokens which are not in the logits are ignored
+	vocabulary := [][]int32{{1, 2, 3}, {4}, {9, 10}}
+	tests := []struct {
+		name     string
+		tokens   []int32
+		expected []float32
+	}{
+		{"start", nil, []float32{0, 1, 0, 0, 1, 0, 0, 0}},
+		{"first token", []int32{5, 1}, []float32{0, 0, 5, 0, 1, 0, 0, 0}},
+		{"next token", []int32{1, 2}, []float32{0, 0, 0, 5, 1, 0, 0, 0}},
+		{"complete", []int32{1, 2, 3}, []float32{0, 1, 0, 0, 1, 0, 0, 0}},
+	}
+	for _, test := range tests {
+		ctx := task.New()
+		logits := make([]float32, 8)
+		ctx.BoostVocabulary(vocabulary, test.tokens, logits)
+		assert.Equal(test.expected, logits, test.name)
+	}
+}
+
+func Test_params_009(t *testing.T) {
+	assert := assert.New(t)
+
+	// A beam size selects beam search, and a zero beam size selects greedy
+	// sampling. The beam size is set before the other sampling parameters,
+	// which are not reset
+	ctx := task.New()
+	ctx.CopyParams()
+	zero, four, three, patience := 0, 4, 3, float32(1.5)
+	assert.NoError(ctx.SetParams(task.Params{Patience: &patience, BeamSize: &four}))
+	assert.Equal(whisper.SAMPLING_BEAM_SEARCH, ctx.Params().Strategy())
+	assert.Equal(4, ctx.BeamSize())
+	assert.Equal(patience, ctx.Params().Patience())
+
+	assert.NoError(ctx.SetParams(task.Params{BestOf: &three, BeamSize: &zero}))
+	assert.Equal(whisper.SAMPLING_GREEDY, ctx.Params().Strategy())
+	assert.Equal(0, ctx.BeamSize())
+	assert.Equal(3, ctx.Params().BestOf())
+}
+
+func Test_params_010(t *testing.T) {
+	assert := assert.New(t)
+
+	// Decoding fails when repeated text is above the default compression
+	// ratio threshold, which is disabled when zero
+	repeated := window(nil, 0, 0, strings.Repeat(" the", 32))
+	ctx := task.New()
+	ctx.CopyParams()
+	assert.True(ctx.Failed(repeated))
+	zero := float32(0)
+	assert.NoError(ctx.SetParams(task.Params{RatioThreshold: &zero}))
+	assert.False(ctx.Failed(repeated))
+
+	// Decoding fails when the average log probability is below the threshold
+	logprob := float32(-0.5)
+	assert.NoError(ctx.SetParams(task.Params{LogProbThreshold: &logprob}))
+	assert.False(ctx.Failed(window(distinct(4), -0.5, 0)))
+	assert.True(ctx.Failed(window(distinct(4), -0.6, 0)))
+}
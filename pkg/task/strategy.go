@@ -0,0 +1,49 @@
+package task
+
+import (
+	// Packages
+	whisper "github.com/mutablelogic/go-whisper/sys/whisper"
+)
+
+//////////////////////////////////////////////////////////////////////////////
+// GLOBALS
+
+const (
+	// Maximum number of beams or candidates, which is the maximum number
+	// of decoders in whisper.cpp
+	maxDecoders = 8
+)
+
+//////////////////////////////////////////////////////////////////////////////
+// PUBLIC METHODS
+
+// Set the beam size. When the beam size is greater than zero, the params
+// are rebuilt for beam search, and when it is zero they are rebuilt for
+// greedy sampling. The best of and patience parameters are reset
+func (ctx *Context) SetBeamSize(v int) {
+	if v > 0 {
+		ctx.params.SetStrategy(whisper.SAMPLING_BEAM_SEARCH)
+		ctx.params.SetBeamSize(v)
+	} else {
+		ctx.params.SetStrategy(whisper.SAMPLING_GREEDY)
+	}
+}
+
+// Return the beam size, or zero for greedy sampling
+func (ctx *Context) BeamSize() int {
+	if ctx.params.Strategy() != whisper.SAMPLING_BEAM_SEARCH {
+		return 0
+	}
+	return ctx.params.BeamSize()
+}
+
+// Set the number of candidates when sampling with a non-zero temperature,
+// of which the most likely is kept
+func (ctx *Context) SetBestOf(v int) {
+	ctx.params.SetBestOf(v)
+}
+
+// Set the beam search patience
+func (ctx *Context) SetPatience(v float32) {
+	ctx.params.SetPatience(v)
+}
@@ -0,0 +1,55 @@
+package task
+
+import (
+	"strings"
+
+	// Packages
+	whisper "github.com/mutablelogic/go-whisper/sys/whisper"
+
+	// Namespace imports
+	. "github.com/djthorpe/go-errors"
+)
+
+//////////////////////////////////////////////////////////////////////////////
+// PUBLIC METHODS
+
+// Convert text into the tokens of the model
+func (task *Context) Tokenize(text string) ([]int32, error) {
+	return whisper.Whisper_tokenize(task.whisper, text)
+}
+
+// Convert tokens of the model into text. Returns ErrBadParameter if any
+// token is not in the vocabulary of the model
+func (task *Context) Detokenize(tokens []int32) (string, error) {
+	if err := task.validateTokens(tokens); err != nil {
+		return "", err
+	}
+	var text strings.Builder
+	for _, token := range tokens {
+		text.WriteString(whisper.Whisper_token_to_str(task.whisper, token))
+	}
+	return text.String(), nil
+}
+
+// Return the maximum number of tokens which can be used as a prompt, which
+// is half the text context of the decoder
+func (task *Context) MaxPromptTokens() int {
+	return whisper.Whisper_n_text_ctx(task.whisper) / 2
+}
+
+//////////////////////////////////////////////////////////////////////////////
+// PRIVATE METHODS
+
+// Return ErrBadParameter if any token is not in the vocabulary of the model
+func (task *Context) validateTokens(tokens []int32) error {
+	if len(tokens) == 0 {
+		return nil
+	}
+	n := whisper.Whisper_n_vocab(task.whisper)
+	for _, token := range tokens {
+		if token < 0 || int(token) >= n {
+			return ErrBadParameter.Withf("invalid token: %d", token)
+		}
+	}
+	return nil
+}
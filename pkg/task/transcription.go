@@ -4,34 +4,48 @@ import (
 	"fmt"
 	"io"
 	"regexp"
+	"sort"
 	"strings"
 	"time"
 
 	// Packages
 	"github.com/mutablelogic/go-whisper/pkg/schema"
-	"github.com/mutablelogic/go-whisper/sys/whisper"
 )
 
 //////////////////////////////////////////////////////////////////////////////
 // LIFECYCLE
 
-func newSegment(ts time.Duration, offset int32, seg *whisper.Segment) *schema.Segment {
-	// Dumb copy function
-	return &schema.Segment{
-		Id:          offset + seg.Id,
-		Text:        seg.Text,
-		Start:       schema.Timestamp(seg.T0 + ts),
-		End:         schema.Timestamp(seg.T1 + ts),
-		SpeakerTurn: seg.SpeakerTurn,
-	}
+func (task *Context) newSegment(ts time.Duration, offset int32, seg decoded) *schema.Segment {
+	return task.setMetrics(&schema.Segment{
+		Id:           offset + seg.Id,
+		Text:         seg.Text,
+		Start:        schema.Timestamp(seg.T0 + ts),
+		End:          schema.Timestamp(seg.T1 + ts),
+		SpeakerTurn:  seg.SpeakerTurn,
+		Speaker:      task.speaker,
+		NoSpeechProb: seg.NoSpeechProb,
+	}, seg.temperature, appendWords(nil, ts, seg.Tokens))
 }
 
 //////////////////////////////////////////////////////////////////////////////
 // PUBLIC METHODS
 
+// Sort segments by start time, and renumber them. This is used to
+// interleave segments which have been transcribed separately for each speaker
+func SortSegments(segments []*schema.Segment) {
+	sort.SliceStable(segments, func(i, j int) bool {
+		return segments[i].Start < segments[j].Start
+	})
+	for i, seg := range segments {
+		seg.Id = int32(i)
+	}
+}
+
 func WriteSegmentSrt(w io.Writer, seg *schema.Segment) {
 	fmt.Fprintf(w, "%d\n%s --> %s\n", seg.Id, tsToSrt(time.Duration(seg.Start)), tsToSrt(time.Duration(seg.End)))
-	if seg.SpeakerTurn {
+	if seg.Speaker != "" {
+		fmt.Fprintf(w, "[%s] ", seg.Speaker)
+	} else if seg.SpeakerTurn {
 		fmt.Fprintf(w, "[SPEAKER] ")
 	}
 	fmt.Fprintf(w, "%s\n\n", strings.TrimSpace(seg.Text))
@@ -39,7 +53,9 @@ func WriteSegmentSrt(w io.Writer, seg *schema.Segment) {
 
 func WriteSegmentVtt(w io.Writer, seg *schema.Segment) {
 	fmt.Fprintf(w, "%s --> %s\n", tsToVtt(time.Duration(seg.Start)), tsToVtt(time.Duration(seg.End)))
-	if seg.SpeakerTurn {
+	if seg.Speaker != "" {
+		fmt.Fprintf(w, "<v %s>", seg.Speaker)
+	} else if seg.SpeakerTurn {
 		fmt.Fprintf(w, "<v Speaker>")
 	}
 	fmt.Fprintf(w, "%s\n\n", strings.TrimSpace(seg.Text))
@@ -54,6 +70,13 @@ func WriteSegmentText(w io.Writer, seg *schema.Segment) {
 		fmt.Fprint(w, "\n\n"+strings.TrimSpace(seg.Text)+"\n")
 		return
 	}
+	if seg.Speaker != "" {
+		if seg.Id > 0 {
+			fmt.Fprint(w, "\n")
+		}
+		fmt.Fprintf(w, "[%s] %s", seg.Speaker, strings.TrimSpace(seg.Text))
+		return
+	}
 	if seg.SpeakerTurn {
 		fmt.Fprint(w, "\n\n[SPEAKER]")
 	}
@@ -0,0 +1,43 @@
+package task_test
+
+import (
+	"bytes"
+	"testing"
+	"time"
+
+	// Packages
+	schema "github.com/mutablelogic/go-whisper/pkg/schema"
+	task "github.com/mutablelogic/go-whisper/pkg/task"
+	assert "github.com/stretchr/testify/assert"
+)
+
+func Test_transcription_001(t *testing.T) {
+	assert := assert.New(t)
+
+	// Interleave the segments of two speakers by start time
+	segments := []*schema.Segment{
+		{Id: 0, Start: schema.Timestamp(0), Text: " Hello", Speaker: "agent"},
+		{Id: 1, Start: schema.Timestamp(4 * time.Second), Text: " Goodbye", Speaker: "agent"},
+		{Id: 2, Start: schema.Timestamp(2 * time.Second), Text: " Hi", Speaker: "customer"},
+	}
+	task.SortSegments(segments)
+	assert.Equal("agent", segments[0].Speaker)
+	assert.Equal("customer", segments[1].Speaker)
+	assert.Equal("agent", segments[2].Speaker)
+	for i, segment := range segments {
+		assert.Equal(int32(i), segment.Id)
+	}
+}
+
+func Test_transcription_002(t *testing.T) {
+	assert := assert.New(t)
+
+	// The speaker label is written with the segment
+	var buf bytes.Buffer
+	task.WriteSegmentVtt(&buf, &schema.Segment{Start: 0, End: schema.Timestamp(time.Second), Text: " Hello", Speaker: "agent"})
+	assert.Equal("00:00:00.000 --> 00:00:01.000\n<v agent>Hello\n\n", buf.String())
+
+	buf.Reset()
+	task.WriteSegmentText(&buf, &schema.Segment{Id: 1, Text: " Hello", Speaker: "agent"})
+	assert.Equal("\n[agent] Hello", buf.String())
+}
@@ -0,0 +1,86 @@
+package task
+
+import (
+	"strings"
+
+	// Packages
+	whisper "github.com/mutablelogic/go-whisper/sys/whisper"
+)
+
+//////////////////////////////////////////////////////////////////////////////
+// GLOBALS
+
+const (
+	// Maximum number of vocabulary terms
+	maxVocabulary = 100
+
+	// Amount added to the logit of the first token of a term, and to the
+	// logit of the next token of a term which has been partially decoded
+	vocabularyStartBias = 1.0
+	vocabularyBias      = 5.0
+)
+
+//////////////////////////////////////////////////////////////////////////////
+// PUBLIC METHODS
+
+// Set the vocabulary, which is a list of terms such as names and product
+// codes. The tokens of each term are boosted during decoding, so that the
+// terms are more likely to be transcribed. Set to nil to remove the vocabulary
+func (ctx *Context) SetVocabulary(terms []string) error {
+	ctx.vocabulary = ctx.vocabulary[:0]
+	for _, term := range terms {
+		if term = strings.TrimSpace(term); term == "" {
+			continue
+		}
+
+		// Tokenize the term at the start of the text and after a space
+		for _, text := range []string{term, " " + term} {
+			if tokens, err := whisper.Whisper_tokenize(ctx.whisper, text); err != nil {
+				return err
+			} else if len(tokens) > 0 {
+				ctx.vocabulary = append(ctx.vocabulary, tokens)
+			}
+		}
+	}
+
+	// Return success
+	return nil
+}
+
+//////////////////////////////////////////////////////////////////////////////
+// PRIVATE METHODS
+
+// Boost the logits of the tokens which start or continue a term in the
+// vocabulary. A term is continued when the decoded tokens end with the
+// first tokens of the term
+func (ctx *Context) boostVocabulary(tokens []int32, logits []float32) {
+	for _, term := range ctx.vocabulary {
+		for n := min(len(term)-1, len(tokens)); n >= 0; n-- {
+			if !hasSuffix(tokens, term[:n]) {
+				continue
+			}
+			if next := term[n]; int(next) < len(logits) {
+				if n == 0 {
+					logits[next] += vocabularyStartBias
+				} else {
+					logits[next] += vocabularyBias
+				}
+			}
+			break
+		}
+	}
+}
+
+// Return true if the tokens end with the suffix
+func hasSuffix(tokens, suffix []int32) bool {
+	offset := len(tokens) - len(suffix)
+	if offset < 0 {
+		return false
+	}
+	for i, token := range suffix {
+		if tokens[offset+i] != token {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,78 @@
+package task
+
+import (
+	"strings"
+	"time"
+
+	// Packages
+	schema "github.com/mutablelogic/go-whisper/pkg/schema"
+	whisper "github.com/mutablelogic/go-whisper/sys/whisper"
+)
+
+//////////////////////////////////////////////////////////////////////////////
+// TYPES
+
+// A word is one or more tokens, with absolute timestamps and the sum of
+// the probabilities and log probabilities of the tokens
+type word struct {
+	text   string
+	t0, t1 time.Duration
+	p, lp  float32
+	n      int
+}
+
+//////////////////////////////////////////////////////////////////////////////
+// PUBLIC METHODS
+
+// Set word timestamps, which adds the words of each segment with their
+// timestamps and probability to the result
+func (ctx *Context) SetWordTimestamps(v bool) {
+	ctx.words = v
+	ctx.params.SetTokenTimestamps(v)
+}
+
+// Return the word timestamps flag
+func (ctx *Context) WordTimestamps() bool {
+	return ctx.words
+}
+
+//////////////////////////////////////////////////////////////////////////////
+// PRIVATE METHODS
+
+// Append the text tokens to words, where a token which starts with a space
+// starts a new word, and any other token is part of the previous word
+func appendWords(words []word, ts time.Duration, tokens []whisper.Token) []word {
+	for _, token := range tokens {
+		if token.Type != 0 {
+			continue
+		}
+		if n := len(words); n == 0 || strings.HasPrefix(token.Text, " ") {
+			words = append(words, word{text: token.Text, t0: token.T0 + ts, t1: token.T1 + ts, p: token.P, lp: token.Plog, n: 1})
+		} else {
+			words[n-1].text += token.Text
+			words[n-1].t1 = token.T1 + ts
+			words[n-1].p += token.P
+			words[n-1].lp += token.Plog
+			words[n-1].n++
+		}
+	}
+	return words
+}
+
+// Return words in the schema format
+func schemaWords(words []word) []*schema.Word {
+	result := make([]*schema.Word, 0, len(words))
+	for _, word := range words {
+		text := strings.TrimSpace(word.text)
+		if text == "" {
+			continue
+		}
+		result = append(result, &schema.Word{
+			Word:        text,
+			Start:       schema.Timestamp(word.t0),
+			End:         schema.Timestamp(word.t1),
+			Probability: word.p / float32(word.n),
+		})
+	}
+	return result
+}
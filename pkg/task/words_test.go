@@ -0,0 +1,53 @@
+package task_test
+
+import (
+	"testing"
+	"time"
+
+	// Packages
+	schema "github.com/mutablelogic/go-whisper/pkg/schema"
+	task "github.com/mutablelogic/go-whisper/pkg/task"
+	whisper "github.com/mutablelogic/go-whisper/sys/whisper"
+	assert "github.com/stretchr/testify/assert"
+)
+
+func Test_words_001(t *testing.T) {
+	assert := assert.New(t)
+
+	// A token with a leading space starts a word, and other tokens continue
+	// the word. Tokens which are not text are skipped, and so are words
+	// which are only a space
+	tokens := []whisper.Token{
+		{Text: "[_BEG_]", Type: 1, P: 0.1, T0: 0, T1: 0},
+		{Text: " Hel", P: 0.5, Plog: -0.7, T0: 0, T1: 200 * time.Millisecond},
+		{Text: "lo", P: 1.0, Plog: 0, T0: 200 * time.Millisecond, T1: 500 * time.Millisecond},
+		{Text: "[_TT_50]", Type: 1, P: 0.1, T0: 500 * time.Millisecond, T1: 500 * time.Millisecond},
+		{Text: ",", P: 0.9, T0: 500 * time.Millisecond, T1: 600 * time.Millisecond},
+		{Text: " world", P: 0.8, T0: time.Second, T1: 1500 * time.Millisecond},
+		{Text: " ", P: 0.2, T0: 1500 * time.Millisecond, T1: 1600 * time.Millisecond},
+	}
+
+	// The probability of a word is the average of its tokens, and the
+	// timestamps are from its first and last tokens, offset by ts
+	words := task.Words(10*time.Second, tokens)
+	if assert.Len(words, 2) {
+		assert.Equal("Hello,", words[0].Word)
+		assert.InDelta((0.5+1.0+0.9)/3, words[0].Probability, 1e-6)
+		assert.Equal(schema.Timestamp(10*time.Second), words[0].Start)
+		assert.Equal(schema.Timestamp(10600*time.Millisecond), words[0].End)
+		assert.Equal("world", words[1].Word)
+		assert.InDelta(0.8, words[1].Probability, 1e-6)
+		assert.Equal(schema.Timestamp(11*time.Second), words[1].Start)
+		assert.Equal(schema.Timestamp(11500*time.Millisecond), words[1].End)
+	}
+
+	// A first token without a leading space starts a word
+	words = task.Words(0, []whisper.Token{{Text: "Hi", P: 1}, {Text: " there", P: 1}})
+	if assert.Len(words, 2) {
+		assert.Equal("Hi", words[0].Word)
+		assert.Equal("there", words[1].Word)
+	}
+
+	// No text tokens is no words
+	assert.Empty(task.Words(0, tokens[:1]))
+}
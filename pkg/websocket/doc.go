@@ -0,0 +1,2 @@
+/* websocket implements the server side of the WebSocket protocol (RFC 6455) for realtime sessions */
+package websocket
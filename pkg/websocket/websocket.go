@@ -0,0 +1,367 @@
+package websocket
+
+import (
+	"bufio"
+	"crypto/sha1"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"io"
+	"net"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	// Packages
+	httpresponse "github.com/mutablelogic/go-server/pkg/httpresponse"
+
+	// Namespace imports
+	. "github.com/djthorpe/go-errors"
+)
+
+//////////////////////////////////////////////////////////////////////////////
+// TYPES
+
+// Conn is a server-side websocket connection. Messages can be written
+// from any goroutine, but should only be read from one goroutine.
+type Conn struct {
+	sync.Mutex
+
+	conn   net.Conn
+	rw     *bufio.ReadWriter
+	closed bool
+}
+
+// MessageType is the type of a websocket message
+type MessageType int
+
+//////////////////////////////////////////////////////////////////////////////
+// GLOBALS
+
+const (
+	ContinuationMessage MessageType = 0x0
+	TextMessage         MessageType = 0x1
+	BinaryMessage       MessageType = 0x2
+	CloseMessage        MessageType = 0x8
+	PingMessage         MessageType = 0x9
+	PongMessage         MessageType = 0xA
+)
+
+const (
+	// Magic value used in the handshake
+	acceptGUID = "258EAFA5-E914-47DA-95CA-C5AB0DC85B11"
+
+	// Maximum size of a message, including all fragments, and of the
+	// payload of a control frame
+	maxMessageSize = 16 << 20 // 16 MB
+	maxControlSize = 125
+
+	// Time allowed to read the next frame from the client, and to write
+	// a frame to the client
+	readTimeout  = 60 * time.Second
+	writeTimeout = 10 * time.Second
+
+	// Close status codes
+	CloseNormal        = 1000
+	CloseProtocolError = 1002
+	CloseMessageTooBig = 1009
+	CloseInternalError = 1011
+)
+
+//////////////////////////////////////////////////////////////////////////////
+// LIFECYCLE
+
+// Upgrade an HTTP request to a websocket connection. On error, an error
+// response has been written or the connection has been closed, so the
+// caller should not write to the response.
+func Upgrade(w http.ResponseWriter, r *http.Request) (*Conn, error) {
+	conn, rw, err := hijack(w, r)
+	if err != nil {
+		return nil, err
+	}
+
+	// Complete the handshake
+	rw.WriteString("HTTP/1.1 101 Switching Protocols\r\n")
+	rw.WriteString("Upgrade: websocket\r\n")
+	rw.WriteString("Connection: Upgrade\r\n")
+	rw.WriteString("Sec-WebSocket-Accept: " + acceptKey(r.Header.Get("Sec-Websocket-Key")) + "\r\n\r\n")
+	if err := rw.Flush(); err != nil {
+		return nil, errors.Join(err, conn.Close())
+	}
+
+	// Return success
+	return &Conn{conn: conn, rw: rw}, nil
+}
+
+// Close the connection with a normal status
+func (c *Conn) Close() error {
+	return c.CloseWithStatus(CloseNormal)
+}
+
+// Close the connection, sending a close message with a status code to the
+// client first, unless a close message has already been sent
+func (c *Conn) CloseWithStatus(code int) error {
+	var result error
+
+	// Send close message if not already done
+	if err := c.writeClose(code); err != nil && !errors.Is(err, net.ErrClosed) {
+		result = errors.Join(result, err)
+	}
+	if err := c.conn.Close(); err != nil && !errors.Is(err, net.ErrClosed) {
+		result = errors.Join(result, err)
+	}
+
+	// Return any errors
+	return result
+}
+
+//////////////////////////////////////////////////////////////////////////////
+// PUBLIC METHODS
+
+// Read the next text or binary message from the connection. Ping and close
+// messages are answered automatically. Returns io.EOF when the client has
+// closed the connection.
+func (c *Conn) ReadMessage() (MessageType, []byte, error) {
+	var msgtype MessageType
+	var data []byte
+	for {
+		fin, opcode, payload, err := c.readFrame()
+		if err != nil {
+			return 0, nil, err
+		}
+		switch opcode {
+		case PingMessage:
+			if err := c.WriteMessage(PongMessage, payload); err != nil {
+				return 0, nil, err
+			}
+			continue
+		case PongMessage:
+			continue
+		case CloseMessage:
+			code := CloseNormal
+			if len(payload) >= 2 {
+				code = int(binary.BigEndian.Uint16(payload))
+			}
+			c.writeClose(code)
+			return 0, nil, io.EOF
+		case TextMessage, BinaryMessage:
+			if msgtype != 0 {
+				c.writeClose(CloseProtocolError)
+				return 0, nil, ErrBadParameter.With("websocket: expected continuation frame")
+			}
+			msgtype = opcode
+		case ContinuationMessage:
+			if msgtype == 0 {
+				c.writeClose(CloseProtocolError)
+				return 0, nil, ErrBadParameter.With("websocket: unexpected continuation frame")
+			}
+		default:
+			c.writeClose(CloseProtocolError)
+			return 0, nil, ErrBadParameter.Withf("websocket: unsupported opcode %d", opcode)
+		}
+
+		// Append the payload
+		if len(data)+len(payload) > maxMessageSize {
+			c.writeClose(CloseMessageTooBig)
+			return 0, nil, ErrBadParameter.With("websocket: message too large")
+		}
+		data = append(data, payload...)
+
+		// Return the message when complete
+		if fin {
+			return msgtype, data, nil
+		}
+	}
+}
+
+// Write a message to the connection
+func (c *Conn) WriteMessage(t MessageType, data []byte) error {
+	c.Lock()
+	defer c.Unlock()
+	if c.closed {
+		return net.ErrClosed
+	}
+	return c.writeFrame(t, data)
+}
+
+// Write a value as a JSON text message
+func (c *Conn) WriteJSON(v any) error {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+	return c.WriteMessage(TextMessage, data)
+}
+
+//////////////////////////////////////////////////////////////////////////////
+// PRIVATE METHODS
+
+// Check the handshake and take over the connection. On error, an error
+// response is written
+func hijack(w http.ResponseWriter, r *http.Request) (net.Conn, *bufio.ReadWriter, error) {
+	// Check the handshake
+	if r.Method != http.MethodGet {
+		httpresponse.Error(w, http.StatusMethodNotAllowed, "websocket: method must be GET")
+		return nil, nil, ErrBadParameter.With("websocket: method must be GET")
+	}
+	if !headerContains(r.Header, "Connection", "upgrade") || !headerContains(r.Header, "Upgrade", "websocket") {
+		httpresponse.Error(w, http.StatusBadRequest, "websocket: not a websocket handshake")
+		return nil, nil, ErrBadParameter.With("websocket: not a websocket handshake")
+	}
+	if r.Header.Get("Sec-Websocket-Version") != "13" {
+		w.Header().Set("Sec-Websocket-Version", "13")
+		httpresponse.Error(w, http.StatusUpgradeRequired, "websocket: unsupported version")
+		return nil, nil, ErrBadParameter.With("websocket: unsupported version")
+	}
+	if r.Header.Get("Sec-Websocket-Key") == "" {
+		httpresponse.Error(w, http.StatusBadRequest, "websocket: missing key")
+		return nil, nil, ErrBadParameter.With("websocket: missing key")
+	}
+
+	// Take over the connection
+	hijacker, ok := w.(http.Hijacker)
+	if !ok {
+		httpresponse.Error(w, http.StatusInternalServerError, "websocket: response does not support hijacking")
+		return nil, nil, ErrNotImplemented.With("websocket: response does not support hijacking")
+	}
+	conn, rw, err := hijacker.Hijack()
+	if err != nil {
+		httpresponse.Error(w, http.StatusInternalServerError, err.Error())
+		return nil, nil, err
+	}
+
+	// Return the connection
+	return conn, rw, nil
+}
+
+// Read a single frame, and unmask the payload
+func (c *Conn) readFrame() (bool, MessageType, []byte, error) {
+	if err := c.conn.SetReadDeadline(time.Now().Add(readTimeout)); err != nil {
+		return false, 0, nil, err
+	}
+	var header [2]byte
+	if _, err := io.ReadFull(c.rw, header[:]); err != nil {
+		return false, 0, nil, err
+	}
+	fin := header[0]&0x80 != 0
+	rsv := header[0] & 0x70
+	opcode := MessageType(header[0] & 0x0F)
+	masked := header[1]&0x80 != 0
+	control := opcode&0x8 != 0
+
+	// Frames from the client must be masked, and no extensions are
+	// negotiated, so the reserved bits must be zero
+	if !masked {
+		c.writeClose(CloseProtocolError)
+		return false, 0, nil, ErrBadParameter.With("websocket: unmasked client frame")
+	}
+	if rsv != 0 {
+		c.writeClose(CloseProtocolError)
+		return false, 0, nil, ErrBadParameter.With("websocket: reserved bits are set")
+	}
+
+	// Control frames cannot be fragmented
+	if control && !fin {
+		c.writeClose(CloseProtocolError)
+		return false, 0, nil, ErrBadParameter.With("websocket: fragmented control frame")
+	}
+
+	// Read the payload length
+	n := uint64(header[1] & 0x7F)
+	switch n {
+	case 126:
+		var ext [2]byte
+		if _, err := io.ReadFull(c.rw, ext[:]); err != nil {
+			return false, 0, nil, err
+		}
+		n = uint64(binary.BigEndian.Uint16(ext[:]))
+	case 127:
+		var ext [8]byte
+		if _, err := io.ReadFull(c.rw, ext[:]); err != nil {
+			return false, 0, nil, err
+		}
+		n = binary.BigEndian.Uint64(ext[:])
+	}
+	if control && n > maxControlSize {
+		c.writeClose(CloseProtocolError)
+		return false, 0, nil, ErrBadParameter.With("websocket: control frame too large")
+	}
+	if n > maxMessageSize {
+		c.writeClose(CloseMessageTooBig)
+		return false, 0, nil, ErrBadParameter.With("websocket: message too large")
+	}
+
+	// Read the mask and payload
+	var mask [4]byte
+	if _, err := io.ReadFull(c.rw, mask[:]); err != nil {
+		return false, 0, nil, err
+	}
+	payload := make([]byte, n)
+	if _, err := io.ReadFull(c.rw, payload); err != nil {
+		return false, 0, nil, err
+	}
+	for i := range payload {
+		payload[i] ^= mask[i%4]
+	}
+
+	// Return the frame
+	return fin, opcode, payload, nil
+}
+
+// Write a single unmasked frame, which should be called with the lock held
+func (c *Conn) writeFrame(t MessageType, data []byte) error {
+	if err := c.conn.SetWriteDeadline(time.Now().Add(writeTimeout)); err != nil {
+		return err
+	}
+	header := []byte{0x80 | byte(t), 0}
+	switch n := len(data); {
+	case n < 126:
+		header[1] = byte(n)
+	case n <= 0xFFFF:
+		header[1] = 126
+		header = binary.BigEndian.AppendUint16(header, uint16(n))
+	default:
+		header[1] = 127
+		header = binary.BigEndian.AppendUint64(header, uint64(n))
+	}
+	if _, err := c.rw.Write(header); err != nil {
+		return err
+	}
+	if _, err := c.rw.Write(data); err != nil {
+		return err
+	}
+	return c.rw.Flush()
+}
+
+// Write a close frame with a status code, after which no more messages
+// can be written
+func (c *Conn) writeClose(code int) error {
+	c.Lock()
+	defer c.Unlock()
+	if c.closed {
+		return nil
+	}
+	c.closed = true
+	return c.writeFrame(CloseMessage, binary.BigEndian.AppendUint16(nil, uint16(code)))
+}
+
+// Return the accept key for the handshake
+func acceptKey(key string) string {
+	h := sha1.New()
+	h.Write([]byte(key + acceptGUID))
+	return base64.StdEncoding.EncodeToString(h.Sum(nil))
+}
+
+// Return true if a comma-separated header contains a token
+func headerContains(h http.Header, key, token string) bool {
+	for _, value := range h.Values(key) {
+		for _, v := range strings.Split(value, ",") {
+			if strings.EqualFold(strings.TrimSpace(v), token) {
+				return true
+			}
+		}
+	}
+	return false
+}
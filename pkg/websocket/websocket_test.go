@@ -0,0 +1,207 @@
+package websocket_test
+
+import (
+	"bufio"
+	"encoding/binary"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	// Packages
+	websocket "github.com/mutablelogic/go-whisper/pkg/websocket"
+	assert "github.com/stretchr/testify/assert"
+)
+
+func Test_websocket_001(t *testing.T) {
+	assert := assert.New(t)
+
+	// Echo server
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		conn, err := websocket.Upgrade(w, r)
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+		for {
+			t, data, err := conn.ReadMessage()
+			if err != nil {
+				return
+			}
+			conn.WriteMessage(t, data)
+		}
+	}))
+	defer server.Close()
+
+	// Connect and perform the handshake
+	conn, rw := dial(t, server.URL)
+	defer conn.Close()
+
+	t.Run("Text", func(t *testing.T) {
+		writeFrame(rw, 0x81, []byte("hello"))
+		opcode, data := readFrame(t, rw)
+		assert.Equal(byte(0x81), opcode)
+		assert.Equal("hello", string(data))
+	})
+
+	t.Run("Binary", func(t *testing.T) {
+		payload := make([]byte, 70000)
+		for i := range payload {
+			payload[i] = byte(i)
+		}
+		writeFrame(rw, 0x82, payload)
+		opcode, data := readFrame(t, rw)
+		assert.Equal(byte(0x82), opcode)
+		assert.Equal(payload, data)
+	})
+
+	t.Run("Fragmented", func(t *testing.T) {
+		writeFrame(rw, 0x01, []byte("hello "))
+		writeFrame(rw, 0x89, []byte("ping"))
+		writeFrame(rw, 0x80, []byte("world"))
+		opcode, data := readFrame(t, rw)
+		assert.Equal(byte(0x8A), opcode)
+		assert.Equal("ping", string(data))
+		opcode, data = readFrame(t, rw)
+		assert.Equal(byte(0x81), opcode)
+		assert.Equal("hello world", string(data))
+	})
+
+	t.Run("Close", func(t *testing.T) {
+		writeFrame(rw, 0x88, binary.BigEndian.AppendUint16(nil, 1000))
+		opcode, data := readFrame(t, rw)
+		assert.Equal(byte(0x88), opcode)
+		assert.Equal(uint16(1000), binary.BigEndian.Uint16(data))
+	})
+}
+
+func Test_websocket_002(t *testing.T) {
+	assert := assert.New(t)
+
+	// Not a websocket request
+	w := httptest.NewRecorder()
+	r := httptest.NewRequest(http.MethodGet, "/", nil)
+	_, err := websocket.Upgrade(w, r)
+	assert.Error(err)
+	assert.Equal(http.StatusBadRequest, w.Code)
+
+	// Unsupported version
+	w = httptest.NewRecorder()
+	r.Header.Set("Connection", "Upgrade")
+	r.Header.Set("Upgrade", "websocket")
+	r.Header.Set("Sec-WebSocket-Version", "8")
+	_, err = websocket.Upgrade(w, r)
+	assert.Error(err)
+	assert.Equal(http.StatusUpgradeRequired, w.Code)
+	assert.Equal("13", w.Header().Get("Sec-WebSocket-Version"))
+}
+
+func Test_websocket_003(t *testing.T) {
+	assert := assert.New(t)
+
+	// Server which reads messages until an error
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		conn, err := websocket.Upgrade(w, r)
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+		for {
+			if _, _, err := conn.ReadMessage(); err != nil {
+				return
+			}
+		}
+	}))
+	defer server.Close()
+
+	// Each invalid frame is answered with a protocol error
+	for name, frame := range map[string]struct {
+		header  byte
+		payload []byte
+	}{
+		"Reserved":          {0xC1, []byte("hello")},
+		"FragmentedControl": {0x09, []byte("ping")},
+		"LargeControl":      {0x89, make([]byte, 126)},
+	} {
+		t.Run(name, func(t *testing.T) {
+			conn, rw := dial(t, server.URL)
+			defer conn.Close()
+			writeFrame(rw, frame.header, frame.payload)
+			opcode, data := readFrame(t, rw)
+			assert.Equal(byte(0x88), opcode)
+			if assert.Len(data, 2) {
+				assert.Equal(uint16(1002), binary.BigEndian.Uint16(data))
+			}
+		})
+	}
+}
+
+//////////////////////////////////////////////////////////////////////////////
+
+func dial(t *testing.T, url string) (net.Conn, *bufio.ReadWriter) {
+	conn, err := net.Dial("tcp", strings.TrimPrefix(url, "http://"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	rw := bufio.NewReadWriter(bufio.NewReader(conn), bufio.NewWriter(conn))
+	rw.WriteString("GET / HTTP/1.1\r\nHost: localhost\r\nConnection: Upgrade\r\nUpgrade: websocket\r\n")
+	rw.WriteString("Sec-WebSocket-Version: 13\r\nSec-WebSocket-Key: dGhlIHNhbXBsZSBub25jZQ==\r\n\r\n")
+	rw.Flush()
+
+	// Read the response
+	resp, err := http.ReadResponse(rw.Reader, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if resp.StatusCode != http.StatusSwitchingProtocols {
+		t.Fatal("unexpected status", resp.Status)
+	}
+	if accept := resp.Header.Get("Sec-Websocket-Accept"); accept != "s3pPLMBiTxaQ9kYGzzhZRbK+xOo=" {
+		t.Fatal("unexpected accept key", accept)
+	}
+	return conn, rw
+}
+
+func writeFrame(rw *bufio.ReadWriter, header byte, payload []byte) {
+	mask := []byte{1, 2, 3, 4}
+	frame := []byte{header}
+	switch n := len(payload); {
+	case n < 126:
+		frame = append(frame, 0x80|byte(n))
+	case n <= 0xFFFF:
+		frame = binary.BigEndian.AppendUint16(append(frame, 0x80|126), uint16(n))
+	default:
+		frame = binary.BigEndian.AppendUint64(append(frame, 0x80|127), uint64(n))
+	}
+	frame = append(frame, mask...)
+	for i, b := range payload {
+		frame = append(frame, b^mask[i%4])
+	}
+	rw.Write(frame)
+	rw.Flush()
+}
+
+func readFrame(t *testing.T, rw *bufio.ReadWriter) (byte, []byte) {
+	var header [2]byte
+	if _, err := io.ReadFull(rw, header[:]); err != nil {
+		t.Fatal(err)
+	}
+	n := uint64(header[1] & 0x7F)
+	switch n {
+	case 126:
+		var ext [2]byte
+		io.ReadFull(rw, ext[:])
+		n = uint64(binary.BigEndian.Uint16(ext[:]))
+	case 127:
+		var ext [8]byte
+		io.ReadFull(rw, ext[:])
+		n = binary.BigEndian.Uint64(ext[:])
+	}
+	data := make([]byte, n)
+	if _, err := io.ReadFull(rw, data); err != nil {
+		t.Fatal(err)
+	}
+	return header[0], data
+}
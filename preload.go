@@ -0,0 +1,68 @@
+package whisper
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	// Packages
+	task "github.com/mutablelogic/go-whisper/pkg/task"
+
+	// Namespace imports
+	. "github.com/djthorpe/go-errors"
+)
+
+//////////////////////////////////////////////////////////////////////////////
+// GLOBALS
+
+const (
+	// Length of silence which is transcribed to warm up a model
+	warmupDuration = 2 * time.Second
+)
+
+//////////////////////////////////////////////////////////////////////////////
+// PUBLIC METHODS
+
+// Preload models into the pool, so that the first request for each model
+// does not wait for the model to be loaded. If warmup is true, then a short
+// silence is transcribed with each model. The service is not ready until
+// all models have been preloaded. Returns any errors.
+func (w *Whisper) Preload(ctx context.Context, warmup bool, ids ...string) error {
+	w.preloading.Add(1)
+	defer w.preloading.Add(-1)
+	return w.preload(ctx, warmup, ids...)
+}
+
+// Return true when the service is ready to accept requests, which is when
+// no models are being preloaded
+func (w *Whisper) Ready() bool {
+	return w.preloading.Load() == 0
+}
+
+//////////////////////////////////////////////////////////////////////////////
+// PRIVATE METHODS
+
+// Preload models in order, and return any errors
+func (w *Whisper) preload(ctx context.Context, warmup bool, ids ...string) error {
+	var result error
+	for _, id := range ids {
+		model := w.store.ById(id)
+		if model == nil {
+			result = errors.Join(result, ErrNotFound.Withf("model %q", id))
+			continue
+		}
+		if err := w.WithModel(ctx, model, func(taskctx *task.Context) error {
+			if !warmup {
+				return nil
+			}
+			return taskctx.Transcribe(ctx, 0, make([]float32, int(warmupDuration.Seconds()*SampleRate)), nil)
+		}); err != nil {
+			result = errors.Join(result, fmt.Errorf("model %q: %w", id, err))
+		}
+		if ctx.Err() != nil {
+			return errors.Join(result, ctx.Err())
+		}
+	}
+	return result
+}
@@ -0,0 +1,230 @@
+package whisper
+
+import (
+	"sync"
+	"unsafe"
+)
+
+///////////////////////////////////////////////////////////////////////////////
+// CGO
+
+/*
+#cgo pkg-config: libwhisper
+#include <whisper.h>
+#include <stdbool.h>
+#include <stdint.h>
+
+extern void whisper_progress_cb_ex(struct whisper_context * ctx, struct whisper_state * state, int progress, void * user_data);
+extern void whisper_segment_cb_ex(struct whisper_context * ctx, struct whisper_state * state, int n, void * user_data);
+extern bool whisper_abort_cb_ex(void * user_data);
+extern void whisper_logits_filter_cb_ex(struct whisper_context * ctx, struct whisper_state * state, whisper_token_data * tokens, int n_tokens, float * logits, void * user_data);
+
+// Call the logits filter callback, which takes non-const tokens
+static void whisper_logits_filter_cb(struct whisper_context * ctx, struct whisper_state * state, const whisper_token_data * tokens, int n_tokens, float * logits, void * user_data) {
+	whisper_logits_filter_cb_ex(ctx, state, (whisper_token_data*)tokens, n_tokens, logits, user_data);
+}
+
+// Set callbacks
+static void set_callbacks(struct whisper_full_params* params,  bool enabled) {
+	if (enabled) {
+		params->progress_callback = whisper_progress_cb_ex;
+		params->abort_callback = whisper_abort_cb_ex;
+		params->new_segment_callback = whisper_segment_cb_ex;
+	} else {
+		params->progress_callback = NULL;
+		params->abort_callback = NULL;
+		params->new_segment_callback = NULL;
+	}
+}
+
+// Set the logits filter callback, which is only installed when there is
+// a filter, as it is called before sampling every token
+static void set_logits_filter_callback(struct whisper_full_params* params, bool enabled) {
+	params->logits_filter_callback = enabled ? whisper_logits_filter_cb : NULL;
+}
+
+// Return callback user data from a key
+static void* cb_user_data(uintptr_t key) {
+	return (void*)key;
+}
+*/
+import "C"
+
+///////////////////////////////////////////////////////////////////////////////
+// TYPES
+
+// Returns the new segment number
+type ProgressCallback func(progress int)
+
+// Returns the new segment number
+type SegmentCallback func(segment int)
+
+// If it returns true, the computation is aborted
+type AbortCallback func() bool
+
+// Called before sampling each token with the tokens decoded so far in the
+// segment, and the logits of the next token, which can be modified
+type LogitsFilterCallback func(tokens []int32, logits []float32)
+
+///////////////////////////////////////////////////////////////////////////////
+// GLOBALS
+
+var (
+	// Map a uintptr context or state to a callback
+	cbLock     sync.RWMutex
+	progressCb = map[uint]ProgressCallback{}
+	segmentCb  = map[uint]SegmentCallback{}
+	abortCb    = map[uint]AbortCallback{}
+	logitsCb   = map[uint]LogitsFilterCallback{}
+)
+
+///////////////////////////////////////////////////////////////////////////////
+// PUBLIC METHODS
+
+func (c *FullParams) SetProgressCallback(ctx *Context, cb ProgressCallback) {
+	c.setProgressCallback(cbkey(unsafe.Pointer(ctx)), cb)
+}
+
+func (c *FullParams) SetSegmentCallback(ctx *Context, cb SegmentCallback) {
+	c.setSegmentCallback(cbkey(unsafe.Pointer(ctx)), cb)
+}
+
+func (c *FullParams) SetAbortCallback(ctx *Context, cb AbortCallback) {
+	c.setAbortCallback(cbkey(unsafe.Pointer(ctx)), cb)
+}
+
+func (c *FullParams) SetLogitsFilterCallback(ctx *Context, cb LogitsFilterCallback) {
+	c.setLogitsFilterCallback(cbkey(unsafe.Pointer(ctx)), cb)
+}
+
+// Set the progress callback for a transcription with a state, so that
+// callbacks for states which share a context are kept apart
+func (c *FullParams) SetProgressCallbackWithState(state *State, cb ProgressCallback) {
+	c.setProgressCallback(cbkey(unsafe.Pointer(state)), cb)
+}
+
+// Set the new segment callback for a transcription with a state
+func (c *FullParams) SetSegmentCallbackWithState(state *State, cb SegmentCallback) {
+	c.setSegmentCallback(cbkey(unsafe.Pointer(state)), cb)
+}
+
+// Set the abort callback for a transcription with a state
+func (c *FullParams) SetAbortCallbackWithState(state *State, cb AbortCallback) {
+	c.setAbortCallback(cbkey(unsafe.Pointer(state)), cb)
+}
+
+// Set the logits filter callback for a transcription with a state
+func (c *FullParams) SetLogitsFilterCallbackWithState(state *State, cb LogitsFilterCallback) {
+	c.setLogitsFilterCallback(cbkey(unsafe.Pointer(state)), cb)
+}
+
+///////////////////////////////////////////////////////////////////////////////
+// PRIVATE METHODS
+
+// Install the callbacks, which are called with a key as the user data
+func (c *FullParams) setCallbacks() {
+	C.set_callbacks((*C.struct_whisper_full_params)(c), C.bool(true))
+}
+
+func cbkey(ptr unsafe.Pointer) uint {
+	return uint(uintptr(ptr))
+}
+
+func (c *FullParams) setProgressCallback(key uint, cb ProgressCallback) {
+	cbLock.Lock()
+	defer cbLock.Unlock()
+	if cb == nil {
+		c.progress_callback_user_data = nil
+		delete(progressCb, key)
+	} else {
+		c.progress_callback_user_data = C.cb_user_data(C.uintptr_t(key))
+		progressCb[key] = cb
+	}
+}
+
+func (c *FullParams) setSegmentCallback(key uint, cb SegmentCallback) {
+	cbLock.Lock()
+	defer cbLock.Unlock()
+	if cb == nil {
+		c.new_segment_callback_user_data = nil
+		delete(segmentCb, key)
+	} else {
+		c.new_segment_callback_user_data = C.cb_user_data(C.uintptr_t(key))
+		segmentCb[key] = cb
+	}
+}
+
+func (c *FullParams) setAbortCallback(key uint, cb AbortCallback) {
+	cbLock.Lock()
+	defer cbLock.Unlock()
+	if cb == nil {
+		c.abort_callback_user_data = nil
+		delete(abortCb, key)
+	} else {
+		c.abort_callback_user_data = C.cb_user_data(C.uintptr_t(key))
+		abortCb[key] = cb
+	}
+}
+
+func (c *FullParams) setLogitsFilterCallback(key uint, cb LogitsFilterCallback) {
+	cbLock.Lock()
+	defer cbLock.Unlock()
+	C.set_logits_filter_callback((*C.struct_whisper_full_params)(c), C.bool(cb != nil))
+	if cb == nil {
+		c.logits_filter_callback_user_data = nil
+		delete(logitsCb, key)
+	} else {
+		c.logits_filter_callback_user_data = C.cb_user_data(C.uintptr_t(key))
+		logitsCb[key] = cb
+	}
+}
+
+//export whisper_progress_cb_ex
+func whisper_progress_cb_ex(ctx *C.struct_whisper_context, state *C.struct_whisper_state, progress C.int, user_data unsafe.Pointer) {
+	cbLock.RLock()
+	cb, ok := progressCb[cbkey(user_data)]
+	cbLock.RUnlock()
+	if ok {
+		cb(int(progress))
+	}
+}
+
+//export whisper_segment_cb_ex
+func whisper_segment_cb_ex(ctx *C.struct_whisper_context, state *C.struct_whisper_state, n C.int, user_data unsafe.Pointer) {
+	cbLock.RLock()
+	cb, ok := segmentCb[cbkey(user_data)]
+	cbLock.RUnlock()
+	if ok {
+		cb(int(n))
+	}
+}
+
+//export whisper_abort_cb_ex
+func whisper_abort_cb_ex(user_data unsafe.Pointer) C.bool {
+	cbLock.RLock()
+	cb, ok := abortCb[cbkey(user_data)]
+	cbLock.RUnlock()
+	if ok {
+		return C.bool(cb())
+	}
+	return C.bool(false)
+}
+
+//export whisper_logits_filter_cb_ex
+func whisper_logits_filter_cb_ex(ctx *C.struct_whisper_context, state *C.struct_whisper_state, tokens *C.whisper_token_data, n_tokens C.int, logits *C.float, user_data unsafe.Pointer) {
+	cbLock.RLock()
+	cb, ok := logitsCb[cbkey(user_data)]
+	cbLock.RUnlock()
+	if !ok || logits == nil {
+		return
+	}
+
+	// Copy the token ids, and pass the logits without copying so they can be modified
+	ids := make([]int32, int(n_tokens))
+	if n_tokens > 0 {
+		for i, token := range unsafe.Slice(tokens, int(n_tokens)) {
+			ids[i] = int32(token.id)
+		}
+	}
+	cb(ids, unsafe.Slice((*float32)(unsafe.Pointer(logits)), int(C.whisper_n_vocab(ctx))))
+}
@@ -4,6 +4,9 @@ import "errors"
 
 var (
 	ErrTranscriptionFailed = errors.New("whisper_full failed")
+	ErrTokenizeFailed      = errors.New("whisper_tokenize failed")
+	ErrPcmToMelFailed      = errors.New("whisper_pcm_to_mel failed")
+	ErrLangDetectFailed    = errors.New("whisper_lang_auto_detect failed")
 )
 
 type HTTPError struct {
@@ -13,24 +13,8 @@ import (
 #cgo pkg-config: libwhisper
 #include <whisper.h>
 #include <stdio.h>
+#include <stdlib.h>
 #include <stdbool.h>
-
-extern void whisper_progress_cb_ex(struct whisper_context * ctx, struct whisper_state * state, int progress, void * user_data);
-extern void whisper_segment_cb_ex(struct whisper_context * ctx, struct whisper_state * state, int n, void * user_data);
-extern bool whisper_abort_cb_ex(void * user_data);
-
-// Set callbacks
-static void set_callbacks(struct whisper_full_params* params,  bool enabled) {
-	if (enabled) {
-		params->progress_callback = whisper_progress_cb_ex;
-		params->abort_callback = whisper_abort_cb_ex;
-		params->new_segment_callback = whisper_segment_cb_ex;
-	} else {
-		params->progress_callback = NULL;
-		params->abort_callback = NULL;
-		params->new_segment_callback = NULL;
-	}
-}
 */
 import "C"
 
@@ -40,16 +24,14 @@ import "C"
 type (
 	FullParams       C.struct_whisper_full_params
 	SamplingStrategy C.enum_whisper_sampling_strategy
+	GrammarType      C.enum_whisper_gretype
 )
 
-// Returns the new segment number
-type ProgressCallback func(progress int)
-
-// Returns the new segment number
-type SegmentCallback func(segment int)
-
-// If it returns true, the computation is aborted
-type AbortCallback func() bool
+// An element of a grammar rule
+type GrammarElement struct {
+	Type  GrammarType
+	Value uint32
+}
 
 ///////////////////////////////////////////////////////////////////////////////
 // GLOBALS
@@ -59,11 +41,14 @@ const (
 	SAMPLING_BEAM_SEARCH SamplingStrategy = C.WHISPER_SAMPLING_BEAM_SEARCH // similar to OpenAI's BeamSearchDecoder
 )
 
-var (
-	// Map a uintptr context to a callback
-	progressCb = map[uint]ProgressCallback{}
-	segmentCb  = map[uint]SegmentCallback{}
-	abortCb    = map[uint]AbortCallback{}
+const (
+	GRETYPE_END            GrammarType = C.WHISPER_GRETYPE_END            // end of rule definition
+	GRETYPE_ALT            GrammarType = C.WHISPER_GRETYPE_ALT            // start of alternate definition for rule
+	GRETYPE_RULE_REF       GrammarType = C.WHISPER_GRETYPE_RULE_REF       // non-terminal element: reference to rule
+	GRETYPE_CHAR           GrammarType = C.WHISPER_GRETYPE_CHAR           // terminal element: character (code point)
+	GRETYPE_CHAR_NOT       GrammarType = C.WHISPER_GRETYPE_CHAR_NOT       // inverse char(s)
+	GRETYPE_CHAR_RNG_UPPER GrammarType = C.WHISPER_GRETYPE_CHAR_RNG_UPPER // modifies a preceding CHAR or CHAR_ALT to be an inclusive range
+	GRETYPE_CHAR_ALT       GrammarType = C.WHISPER_GRETYPE_CHAR_ALT       // modifies a preceding CHAR or CHAR_RNG_UPPER to add an alternate char
 )
 
 ///////////////////////////////////////////////////////////////////////////////
@@ -71,7 +56,7 @@ var (
 
 func DefaultFullParams(strategy SamplingStrategy) FullParams {
 	params := (FullParams)(C.whisper_full_default_params((C.enum_whisper_sampling_strategy)(strategy)))
-	C.set_callbacks((*C.struct_whisper_full_params)(&params), C.bool(true))
+	params.setCallbacks()
 	return params
 }
 
@@ -82,6 +67,9 @@ func (ctx FullParams) MarshalJSON() ([]byte, error) {
 	type j struct {
 		Strategy                SamplingStrategy `json:"strategy"`
 		NumThreads              int              `json:"n_threads,omitempty"`
+		BestOf                  int              `json:"best_of,omitempty"`        // number of candidates when sampling with a non-zero temperature
+		BeamSize                int              `json:"beam_size,omitempty"`      // number of beams with beam search
+		Patience                float32          `json:"patience,omitempty"`       // beam search patience, not implemented by whisper.cpp
 		MaxTextCtx              int              `json:"n_max_text_ctx,omitempty"` // max tokens to use from past text as prompt for the decoder
 		OffsetMS                int              `json:"offset_ms,omitempty"`      // start offset in ms
 		DurationMS              int              `json:"duration_ms,omitempty"`    // audio duration to process in ms
@@ -104,7 +92,7 @@ func (ctx FullParams) MarshalJSON() ([]byte, error) {
 		DiarizeEnable           bool             `json:"tdrz_enable,omitempty"`      // enable tinydiarize speaker turn detection
 		SuppressRegex           string           `json:"suppress_regex,omitempty"`   // A regular expression that matches tokens to suppress
 		InitialPrompt           string           `json:"initial_prompt,omitempty"`   // tokens to provide to the whisper decoder as initial prompt
-		PromptTokens            []string         `json:"prompt_tokens,omitempty"`    // use whisper_tokenize() to convert text to tokens
+		PromptTokens            []int32          `json:"prompt_tokens,omitempty"`    // use whisper_tokenize() to convert text to tokens
 		Language                string           `json:"language,omitempty"`         // for auto-detection, set to "" or "auto"
 		DetectLanguage          bool             `json:"detect_language,omitempty"`
 		SuppressBlank           bool             `json:"suppress_blank,omitempty"`             // ref: https://github.com/openai/whisper/blob/f82bc59f5ea234d4b97fb2860842ed38519f7e65/whisper/decoding.py#L89
@@ -115,13 +103,20 @@ func (ctx FullParams) MarshalJSON() ([]byte, error) {
 		TemperatureInc          float32          `json:"temperature_inc,omitempty"`            // ref: https://github.com/openai/whisper/blob/f82bc59f5ea234d4b97fb2860842ed38519f7e65/whisper/transcribe.py#L274-L278
 		EntropyThreshold        float32          `json:"entropy_thold,omitempty"`              // similar to OpenAI's "compression_ratio_threshold"
 		LogProbThreshold        float32          `json:"logprob_thold,omitempty"`
+		NumGrammarRules         int              `json:"n_grammar_rules,omitempty"` // number of grammar rules which constrain decoding
+		StartRule               int              `json:"i_start_rule,omitempty"`    // index of the grammar rule to start with
+		GrammarPenalty          float32          `json:"grammar_penalty,omitempty"` // penalty for tokens which do not match the grammar
 		ProgressCallback        uintptr          `json:"progress_callback,omitempty"`
 		AbortCallback           uintptr          `json:"abort_callback,omitempty"`
 		SegmentCallback         uintptr          `json:"segment_callback,omitempty"`
+		LogitsFilterCallback    uintptr          `json:"logits_filter_callback,omitempty"`
 	}
 	return json.Marshal(j{
 		Strategy:                SamplingStrategy(ctx.strategy),
 		NumThreads:              int(ctx.n_threads),
+		BestOf:                  int(ctx.greedy.best_of),
+		BeamSize:                int(ctx.beam_search.beam_size),
+		Patience:                float32(ctx.beam_search.patience),
 		MaxTextCtx:              int(ctx.n_max_text_ctx),
 		OffsetMS:                int(ctx.offset_ms),
 		DurationMS:              int(ctx.duration_ms),
@@ -143,7 +138,7 @@ func (ctx FullParams) MarshalJSON() ([]byte, error) {
 		DiarizeEnable:           bool(ctx.tdrz_enable),
 		SuppressRegex:           C.GoString(ctx.suppress_regex),
 		InitialPrompt:           C.GoString(ctx.initial_prompt),
-		PromptTokens:            nil, // TODO
+		PromptTokens:            ctx.PromptTokens(),
 		Language:                C.GoString(ctx.language),
 		DetectLanguage:          bool(ctx.detect_language),
 		SuppressBlank:           bool(ctx.suppress_blank),
@@ -154,9 +149,13 @@ func (ctx FullParams) MarshalJSON() ([]byte, error) {
 		TemperatureInc:          float32(ctx.temperature_inc),
 		EntropyThreshold:        float32(ctx.entropy_thold),
 		LogProbThreshold:        float32(ctx.logprob_thold),
+		NumGrammarRules:         int(ctx.n_grammar_rules),
+		StartRule:               int(ctx.i_start_rule),
+		GrammarPenalty:          float32(ctx.grammar_penalty),
 		ProgressCallback:        uintptr(ctx.progress_callback_user_data),
 		AbortCallback:           uintptr(ctx.abort_callback_user_data),
 		SegmentCallback:         uintptr(ctx.new_segment_callback_user_data),
+		LogitsFilterCallback:    uintptr(ctx.logits_filter_callback_user_data),
 	})
 }
 
@@ -186,10 +185,51 @@ func (v SamplingStrategy) String() string {
 ///////////////////////////////////////////////////////////////////////////////
 // PUBLIC METHODS
 
+// Set the sampling strategy, and reset the greedy and beam search
+// parameters to the defaults for the strategy
+func (c *FullParams) SetStrategy(v SamplingStrategy) {
+	params := C.whisper_full_default_params((C.enum_whisper_sampling_strategy)(v))
+	c.strategy = params.strategy
+	c.greedy = params.greedy
+	c.beam_search = params.beam_search
+}
+
+func (c *FullParams) Strategy() SamplingStrategy {
+	return SamplingStrategy(c.strategy)
+}
+
+func (c *FullParams) SetBestOf(v int) {
+	c.greedy.best_of = (C.int)(v)
+}
+
+func (c *FullParams) BestOf() int {
+	return int(c.greedy.best_of)
+}
+
+func (c *FullParams) SetBeamSize(v int) {
+	c.beam_search.beam_size = (C.int)(v)
+}
+
+func (c *FullParams) BeamSize() int {
+	return int(c.beam_search.beam_size)
+}
+
+func (c *FullParams) SetPatience(v float32) {
+	c.beam_search.patience = (C.float)(v)
+}
+
+func (c *FullParams) Patience() float32 {
+	return float32(c.beam_search.patience)
+}
+
 func (c *FullParams) SetNumThreads(v int) {
 	c.n_threads = (C.int)(v)
 }
 
+func (c *FullParams) NumThreads() int {
+	return int(c.n_threads)
+}
+
 func (c *FullParams) SetMaxTextCtx(v int) {
 	c.n_max_text_ctx = (C.int)(v)
 }
@@ -214,6 +254,10 @@ func (c *FullParams) SetSingleSegment(v bool) {
 	c.single_segment = (C.bool)(v)
 }
 
+func (c *FullParams) SingleSegment() bool {
+	return bool(c.single_segment)
+}
+
 func (c *FullParams) SetPrintSpecial(v bool) {
 	c.print_special = (C.bool)(v)
 }
@@ -230,10 +274,163 @@ func (c *FullParams) SetPrintTimestamps(v bool) {
 	c.print_timestamps = (C.bool)(v)
 }
 
+// Set the initial prompt, which is copied into C memory. Setting the
+// prompt to an empty string releases the memory.
+func (c *FullParams) SetInitialPrompt(v string) {
+	if c.initial_prompt != nil {
+		C.free(unsafe.Pointer(c.initial_prompt))
+	}
+	if v == "" {
+		c.initial_prompt = nil
+	} else {
+		c.initial_prompt = C.CString(v)
+	}
+}
+
+func (c *FullParams) InitialPrompt() string {
+	return C.GoString(c.initial_prompt)
+}
+
+// Set the prompt tokens, which are copied into C memory and are used
+// instead of the initial prompt. Setting the tokens to nil releases the
+// memory.
+func (c *FullParams) SetPromptTokens(v []int32) {
+	if c.prompt_tokens != nil {
+		C.free(unsafe.Pointer(c.prompt_tokens))
+	}
+	if len(v) == 0 {
+		c.prompt_tokens = nil
+		c.prompt_n_tokens = 0
+	} else {
+		ptr := (*C.whisper_token)(C.malloc(C.size_t(len(v)) * C.size_t(unsafe.Sizeof(C.whisper_token(0)))))
+		copy(unsafe.Slice((*int32)(unsafe.Pointer(ptr)), len(v)), v)
+		c.prompt_tokens = ptr
+		c.prompt_n_tokens = C.int(len(v))
+	}
+}
+
+// Return the number of prompt tokens
+func (c *FullParams) NumPromptTokens() int {
+	return int(c.prompt_n_tokens)
+}
+
+// Set the grammar rules which constrain decoding, and the index of the rule
+// to start with. The rules are copied into C memory. Setting the rules to
+// nil releases the memory.
+func (c *FullParams) SetGrammar(rules [][]GrammarElement, start int) {
+	if c.grammar_rules != nil {
+		for _, rule := range unsafe.Slice(c.grammar_rules, int(c.n_grammar_rules)) {
+			C.free(unsafe.Pointer(rule))
+		}
+		C.free(unsafe.Pointer(c.grammar_rules))
+	}
+	if len(rules) == 0 {
+		c.grammar_rules = nil
+		c.n_grammar_rules = 0
+		c.i_start_rule = 0
+		return
+	}
+
+	// Allocate an array of rules, each of which is an array of elements
+	ptrs := unsafe.Slice((**C.whisper_grammar_element)(C.malloc(C.size_t(len(rules))*C.size_t(unsafe.Sizeof((*C.whisper_grammar_element)(nil))))), len(rules))
+	for i, rule := range rules {
+		n := max(len(rule), 1)
+		elems := unsafe.Slice((*C.whisper_grammar_element)(C.malloc(C.size_t(n)*C.size_t(unsafe.Sizeof(C.whisper_grammar_element{})))), n)
+		for j, elem := range rule {
+			elems[j]._type = C.enum_whisper_gretype(elem.Type)
+			elems[j].value = C.uint32_t(elem.Value)
+		}
+		ptrs[i] = &elems[0]
+	}
+	c.grammar_rules = &ptrs[0]
+	c.n_grammar_rules = C.size_t(len(rules))
+	c.i_start_rule = C.size_t(start)
+}
+
+// Return the number of grammar rules
+func (c *FullParams) NumGrammarRules() int {
+	return int(c.n_grammar_rules)
+}
+
+// Set the penalty applied to tokens which do not match the grammar
+func (c *FullParams) SetGrammarPenalty(v float32) {
+	c.grammar_penalty = (C.float)(v)
+}
+
+// Return a copy of the prompt tokens, or nil if there are none
+func (c *FullParams) PromptTokens() []int32 {
+	if c.prompt_tokens == nil || c.prompt_n_tokens <= 0 {
+		return nil
+	}
+	return append([]int32(nil), unsafe.Slice((*int32)(unsafe.Pointer(c.prompt_tokens)), int(c.prompt_n_tokens))...)
+}
+
+func (c *FullParams) SetMaxLen(v int) {
+	c.max_len = (C.int)(v)
+}
+
+func (c *FullParams) SetSplitOnWord(v bool) {
+	c.split_on_word = (C.bool)(v)
+}
+
+func (c *FullParams) SetSuppressBlank(v bool) {
+	c.suppress_blank = (C.bool)(v)
+}
+
+// Set a regular expression which matches tokens to suppress, which is
+// copied into C memory. Setting the expression to an empty string releases
+// the memory.
+func (c *FullParams) SetSuppressRegex(v string) {
+	if c.suppress_regex != nil {
+		C.free(unsafe.Pointer(c.suppress_regex))
+	}
+	if v == "" {
+		c.suppress_regex = nil
+	} else {
+		c.suppress_regex = C.CString(v)
+	}
+}
+
+func (c *FullParams) SetTemperature(v float32) {
+	c.temperature = (C.float)(v)
+}
+
+func (c *FullParams) Temperature() float32 {
+	return float32(c.temperature)
+}
+
+func (c *FullParams) SetTemperatureInc(v float32) {
+	c.temperature_inc = (C.float)(v)
+}
+
+func (c *FullParams) TemperatureInc() float32 {
+	return float32(c.temperature_inc)
+}
+
+func (c *FullParams) SetEntropyThreshold(v float32) {
+	c.entropy_thold = (C.float)(v)
+}
+
+func (c *FullParams) EntropyThreshold() float32 {
+	return float32(c.entropy_thold)
+}
+
+func (c *FullParams) SetLogProbThreshold(v float32) {
+	c.logprob_thold = (C.float)(v)
+}
+
+func (c *FullParams) LogProbThreshold() float32 {
+	return float32(c.logprob_thold)
+}
+
 func (c *FullParams) SetTokenTimestamps(v bool) {
 	c.token_timestamps = (C.bool)(v)
 }
 
+func (c *FullParams) TokenTimestamps() bool {
+	return bool(c.token_timestamps)
+}
+
 func (c *FullParams) SetTranslate(v bool) {
 	c.translate = (C.bool)(v)
 }
@@ -268,68 +465,3 @@ func (c *FullParams) Language() string {
 	}
 	return v
 }
-
-func (c *FullParams) SetProgressCallback(ctx *Context, cb ProgressCallback) {
-	key := cbkey(unsafe.Pointer(ctx))
-	if cb == nil {
-		c.progress_callback_user_data = nil
-		delete(progressCb, key)
-	} else {
-		c.progress_callback_user_data = unsafe.Pointer(uintptr(key))
-		progressCb[key] = cb
-	}
-}
-
-func (c *FullParams) SetSegmentCallback(ctx *Context, cb SegmentCallback) {
-	key := cbkey(unsafe.Pointer(ctx))
-	if cb == nil {
-		c.new_segment_callback_user_data = nil
-		delete(segmentCb, key)
-	} else {
-		c.new_segment_callback_user_data = unsafe.Pointer(uintptr(key))
-		segmentCb[key] = cb
-	}
-}
-
-func (c *FullParams) SetAbortCallback(ctx *Context, cb AbortCallback) {
-	key := cbkey(unsafe.Pointer(ctx))
-	if cb == nil {
-		c.abort_callback_user_data = nil
-		delete(abortCb, key)
-	} else {
-		c.abort_callback_user_data = unsafe.Pointer(uintptr(key))
-		abortCb[key] = cb
-	}
-}
-
-///////////////////////////////////////////////////////////////////////////////
-// PRIVATE METHODS
-
-func cbkey(ptr unsafe.Pointer) uint {
-	return uint(uintptr(ptr))
-}
-
-//export whisper_progress_cb_ex
-func whisper_progress_cb_ex(ctx *C.struct_whisper_context, state *C.struct_whisper_state, progress C.int, user_data unsafe.Pointer) {
-	key := cbkey(user_data)
-	if cb, ok := progressCb[key]; ok {
-		cb(int(progress))
-	}
-}
-
-//export whisper_segment_cb_ex
-func whisper_segment_cb_ex(ctx *C.struct_whisper_context, state *C.struct_whisper_state, n C.int, user_data unsafe.Pointer) {
-	key := cbkey(user_data)
-	if cb, ok := segmentCb[key]; ok {
-		cb(int(n))
-	}
-}
-
-//export whisper_abort_cb_ex
-func whisper_abort_cb_ex(user_data unsafe.Pointer) C.bool {
-	key := cbkey(user_data)
-	if cb, ok := abortCb[key]; ok {
-		return C.bool(cb())
-	}
-	return C.bool(false)
-}
@@ -1,6 +1,9 @@
 package whisper_test
 
 import (
+	"encoding/json"
+	"slices"
+	"strings"
 	"testing"
 
 	// Packages
@@ -11,3 +14,34 @@ func Test_fullparams_00(t *testing.T) {
 	var params = whisper.DefaultFullParams(whisper.SAMPLING_GREEDY)
 	t.Log(params)
 }
+
+func Test_fullparams_01(t *testing.T) {
+	var params = whisper.DefaultFullParams(whisper.SAMPLING_GREEDY)
+	params.SetStrategy(whisper.SAMPLING_BEAM_SEARCH)
+	params.SetBeamSize(3)
+	params.SetBestOf(2)
+	if params.Strategy() != whisper.SAMPLING_BEAM_SEARCH || params.BeamSize() != 3 || params.BestOf() != 2 {
+		t.Error("unexpected params", params)
+	}
+	params.SetStrategy(whisper.SAMPLING_GREEDY)
+	if params.Strategy() != whisper.SAMPLING_GREEDY {
+		t.Error("unexpected strategy", params.Strategy())
+	}
+}
+
+func Test_fullparams_02(t *testing.T) {
+	var params = whisper.DefaultFullParams(whisper.SAMPLING_GREEDY)
+	params.SetPromptTokens([]int32{1, 2, 3})
+	if tokens := params.PromptTokens(); !slices.Equal(tokens, []int32{1, 2, 3}) {
+		t.Error("unexpected prompt tokens", tokens)
+	}
+	if data, err := json.Marshal(params); err != nil {
+		t.Error(err)
+	} else if !strings.Contains(string(data), `"prompt_tokens":[1,2,3]`) {
+		t.Error("unexpected JSON", string(data))
+	}
+	params.SetPromptTokens(nil)
+	if params.NumPromptTokens() != 0 || params.PromptTokens() != nil {
+		t.Error("unexpected prompt tokens", params.PromptTokens())
+	}
+}
@@ -11,6 +11,7 @@ import (
 #cgo pkg-config: libwhisper
 #include <whisper.h>
 #include <stdlib.h>
+#include <stdbool.h>
 
 extern void callLog(enum ggml_log_level level,char* text, void* user_data);
 
@@ -20,9 +21,9 @@ static void whisper_log_cb(enum ggml_log_level level, const char* text, void* us
 }
 
 // Set or unset logging callback
-static void whisper_log_set_ex(void* user_data) {
-	if (user_data) {
-		whisper_log_set(whisper_log_cb, user_data);
+static void whisper_log_set_ex(bool enabled) {
+	if (enabled) {
+		whisper_log_set(whisper_log_cb, NULL);
 	} else {
 		whisper_log_set(NULL, NULL);
 	}
@@ -76,9 +77,9 @@ func (v LogLevel) String() string {
 func Whisper_log_set(fn func(level LogLevel, text string)) {
 	cbLog = fn
 	if fn == nil {
-		C.whisper_log_set_ex(nil)
+		C.whisper_log_set_ex(C.bool(false))
 	} else {
-		C.whisper_log_set_ex((unsafe.Pointer)(uintptr(1)))
+		C.whisper_log_set_ex(C.bool(true))
 	}
 }
 
@@ -0,0 +1,57 @@
+package whisper
+
+///////////////////////////////////////////////////////////////////////////////
+// CGO
+
+/*
+#cgo pkg-config: libwhisper
+#include <whisper.h>
+*/
+import "C"
+
+///////////////////////////////////////////////////////////////////////////////
+// PUBLIC METHODS
+
+// Number of generated text segments in the state
+func (state *State) NumSegments() int {
+	return int(C.whisper_full_n_segments_from_state((*C.struct_whisper_state)(state)))
+}
+
+// Language id associated with the state
+func (state *State) LangId() int {
+	return int(C.whisper_full_lang_id_from_state((*C.struct_whisper_state)(state)))
+}
+
+// Return a segment from the state, or nil. The context is used to
+// convert tokens to text
+func (state *State) Segment(ctx *Context, n int) *Segment {
+	if n < 0 || n >= state.NumSegments() {
+		return nil
+	}
+	return &Segment{
+		Id:           int32(n),
+		Text:         C.GoString(C.whisper_full_get_segment_text_from_state((*C.struct_whisper_state)(state), C.int(n))),
+		SpeakerTurn:  (bool)(C.whisper_full_get_segment_speaker_turn_next_from_state((*C.struct_whisper_state)(state), C.int(n))),
+		NoSpeechProb: float32(C.whisper_full_get_segment_no_speech_prob_from_state((*C.struct_whisper_state)(state), C.int(n))),
+		Tokens:       state.Tokens(ctx, n),
+		T0:           tsToDuration(C.whisper_full_get_segment_t0_from_state((*C.struct_whisper_state)(state), C.int(n))),
+		T1:           tsToDuration(C.whisper_full_get_segment_t1_from_state((*C.struct_whisper_state)(state), C.int(n))),
+	}
+}
+
+// Return tokens for a segment in the state
+func (state *State) Tokens(ctx *Context, n int) []Token {
+	if n >= state.NumSegments() {
+		return nil
+	}
+	t := int(C.whisper_full_n_tokens_from_state((*C.struct_whisper_state)(state), C.int(n)))
+	if t < 0 {
+		return nil
+	}
+	result := make([]Token, t)
+	for i := 0; i < t; i++ {
+		data := (TokenData)(C.whisper_full_get_token_data_from_state((*C.struct_whisper_state)(state), C.int(n), C.int(i)))
+		result[i] = ctx.Token(data)
+	}
+	return result
+}
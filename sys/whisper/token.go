@@ -23,17 +23,19 @@ type (
 		Id   int32         `json:"id"`
 		Text string        `json:"text,omitempty"`
 		P    float32       `json:"p,omitempty"`
+		Plog float32       `json:"plog,omitempty"`
 		T0   time.Duration `json:"t0,omitempty"`
 		T1   time.Duration `json:"t1,omitempty"`
 		Type TokenType     `json:"type,omitempty"`
 	}
 	Segment struct {
-		Id          int32         `json:"id"`
-		Text        string        `json:"text,omitempty"`
-		T0          time.Duration `json:"t0,omitempty"`
-		T1          time.Duration `json:"t1,omitempty"`
-		SpeakerTurn bool          `json:"speaker_turn,omitempty"`
-		Tokens      []Token       `json:"tokens,omitempty"`
+		Id           int32         `json:"id"`
+		Text         string        `json:"text,omitempty"`
+		T0           time.Duration `json:"t0,omitempty"`
+		T1           time.Duration `json:"t1,omitempty"`
+		SpeakerTurn  bool          `json:"speaker_turn,omitempty"`
+		NoSpeechProb float32       `json:"no_speech_prob,omitempty"`
+		Tokens       []Token       `json:"tokens,omitempty"`
 	}
 	TokenType int
 )
@@ -50,7 +52,8 @@ const (
 	NOSP           // no speaker
 	NOT            // no timestamps
 	BEG            // begin
-	LANG           // language (TODO)
+	LANG           // language
+	TS             // timestamp
 )
 
 ///////////////////////////////////////////////////////////////////////////////
@@ -90,6 +93,8 @@ func (t TokenType) String() string {
 		return "[BEG]"
 	case LANG:
 		return "[LANG]"
+	case TS:
+		return "[TS]"
 	default:
 		return "[TEXT]"
 	}
@@ -108,12 +113,13 @@ func (ctx *Context) Segment(n int) *Segment {
 		return nil
 	}
 	return &Segment{
-		Id:          int32(n),
-		Text:        C.GoString(C.whisper_full_get_segment_text((*C.struct_whisper_context)(ctx), C.int(n))),
-		SpeakerTurn: (bool)(C.whisper_full_get_segment_speaker_turn_next((*C.struct_whisper_context)(ctx), C.int(n))),
-		Tokens:      ctx.Tokens(n),
-		T0:          tsToDuration(C.whisper_full_get_segment_t0((*C.struct_whisper_context)(ctx), C.int(n))),
-		T1:          tsToDuration(C.whisper_full_get_segment_t1((*C.struct_whisper_context)(ctx), C.int(n))),
+		Id:           int32(n),
+		Text:         C.GoString(C.whisper_full_get_segment_text((*C.struct_whisper_context)(ctx), C.int(n))),
+		SpeakerTurn:  (bool)(C.whisper_full_get_segment_speaker_turn_next((*C.struct_whisper_context)(ctx), C.int(n))),
+		NoSpeechProb: float32(C.whisper_full_get_segment_no_speech_prob((*C.struct_whisper_context)(ctx), C.int(n))),
+		Tokens:       ctx.Tokens(n),
+		T0:           tsToDuration(C.whisper_full_get_segment_t0((*C.struct_whisper_context)(ctx), C.int(n))),
+		T1:           tsToDuration(C.whisper_full_get_segment_t1((*C.struct_whisper_context)(ctx), C.int(n))),
 	}
 }
 
@@ -123,6 +129,7 @@ func (ctx *Context) Token(data TokenData) Token {
 		Id:   int32(data.id),
 		Text: C.GoString(C.whisper_token_to_str((*C.struct_whisper_context)(ctx), C.whisper_token(data.id))),
 		P:    float32(data.p),
+		Plog: float32(data.plog),
 		T0:   tsToDuration(data.t0),
 		T1:   tsToDuration(data.t1),
 		Type: tokenToType(ctx, data.id),
@@ -158,7 +165,6 @@ func tsToDuration(ts C.int64_t) time.Duration {
 }
 
 // return a token type from a token
-// TODO: Return language tokens
 func tokenToType(ctx *Context, token C.int32_t) TokenType {
 	switch {
 	case token == C.whisper_token_eot((*C.struct_whisper_context)(ctx)):
@@ -175,6 +181,10 @@ func tokenToType(ctx *Context, token C.int32_t) TokenType {
 		return NOT
 	case token == C.whisper_token_beg((*C.struct_whisper_context)(ctx)):
 		return BEG
+	case token > C.whisper_token_beg((*C.struct_whisper_context)(ctx)):
+		return TS
+	case token >= C.whisper_token_lang((*C.struct_whisper_context)(ctx), 0) && token <= C.whisper_token_lang((*C.struct_whisper_context)(ctx), C.whisper_lang_max_id()):
+		return LANG
 	default:
 		return 0
 	}
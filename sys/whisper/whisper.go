@@ -1,6 +1,9 @@
 package whisper
 
-import "unsafe"
+import (
+	"time"
+	"unsafe"
+)
 
 ///////////////////////////////////////////////////////////////////////////////
 // CGO
@@ -17,6 +20,7 @@ import "C"
 
 type (
 	Context C.struct_whisper_context
+	State   C.struct_whisper_state
 )
 
 ///////////////////////////////////////////////////////////////////////////////
@@ -42,11 +46,32 @@ func Whisper_init_from_buffer_with_params(data []byte, params ContextParams) *Co
 	return (*Context)(C.whisper_init_from_buffer_with_params(unsafe.Pointer(&data[0]), C.size_t(len(data)), (C.struct_whisper_context_params)(params)))
 }
 
+// Create a new context with path to model and context parameters, without
+// allocating a default state. Use Whisper_init_state to create a state for
+// each transcription. Returns nil on error.
+func Whisper_init_from_file_with_params_no_state(path string, params ContextParams) *Context {
+	cPath := C.CString(path)
+	defer C.free(unsafe.Pointer(cPath))
+
+	return (*Context)(C.whisper_init_from_file_with_params_no_state(cPath, (C.struct_whisper_context_params)(params)))
+}
+
+// Create a new state for a context. The model weights are shared between
+// all the states of a context. Returns nil on error.
+func Whisper_init_state(ctx *Context) *State {
+	return (*State)(C.whisper_init_state((*C.struct_whisper_context)(ctx)))
+}
+
 // Frees all memory allocated by the model.
 func Whisper_free(ctx *Context) {
 	C.whisper_free((*C.struct_whisper_context)(ctx))
 }
 
+// Frees all memory allocated by the state.
+func Whisper_free_state(state *State) {
+	C.whisper_free_state((*C.struct_whisper_state)(state))
+}
+
 ///////////////////////////////////////////////////////////////////////////////
 // PUBLIC FUNCTIONS
 
@@ -90,6 +115,102 @@ func Whisper_full(ctx *Context, params FullParams, samples []float32) error {
 	return nil
 }
 
+// Run the entire model using a state, so that the context can be shared
+// between transcriptions. Not thread safe for same state
+func Whisper_full_with_state(ctx *Context, state *State, params FullParams, samples []float32) error {
+	if C.whisper_full_with_state((*C.struct_whisper_context)(ctx), (*C.struct_whisper_state)(state), (C.struct_whisper_full_params)(params), (*C.float)(&samples[0]), C.int(len(samples))) != 0 {
+		return ErrTranscriptionFailed
+	}
+	return nil
+}
+
+// Convert samples into a log mel spectrogram in the default state, which
+// is needed before detecting the language
+func Whisper_pcm_to_mel(ctx *Context, samples []float32, threads int) error {
+	if len(samples) == 0 {
+		return ErrPcmToMelFailed
+	}
+	if C.whisper_pcm_to_mel((*C.struct_whisper_context)(ctx), (*C.float)(&samples[0]), C.int(len(samples)), C.int(threads)) != 0 {
+		return ErrPcmToMelFailed
+	}
+	return nil
+}
+
+// Detect the language from the log mel spectrogram in the default state,
+// from the offset. Returns the id of the most probable language, and the
+// probability of each language indexed by language id
+func Whisper_lang_auto_detect(ctx *Context, offset time.Duration, threads int) (int, []float32, error) {
+	probs := make([]float32, Whisper_lang_max_id()+1)
+	id := C.whisper_lang_auto_detect((*C.struct_whisper_context)(ctx), C.int(offset.Milliseconds()), C.int(threads), (*C.float)(&probs[0]))
+	if id < 0 {
+		return -1, nil, ErrLangDetectFailed
+	}
+	return int(id), probs, nil
+}
+
+// Convert samples into a log mel spectrogram in the state, which is needed
+// before detecting the language
+func Whisper_pcm_to_mel_with_state(ctx *Context, state *State, samples []float32, threads int) error {
+	if len(samples) == 0 {
+		return ErrPcmToMelFailed
+	}
+	if C.whisper_pcm_to_mel_with_state((*C.struct_whisper_context)(ctx), (*C.struct_whisper_state)(state), (*C.float)(&samples[0]), C.int(len(samples)), C.int(threads)) != 0 {
+		return ErrPcmToMelFailed
+	}
+	return nil
+}
+
+// Detect the language from the log mel spectrogram in the state, from the
+// offset. Returns the id of the most probable language, and the probability
+// of each language indexed by language id
+func Whisper_lang_auto_detect_with_state(ctx *Context, state *State, offset time.Duration, threads int) (int, []float32, error) {
+	probs := make([]float32, Whisper_lang_max_id()+1)
+	id := C.whisper_lang_auto_detect_with_state((*C.struct_whisper_context)(ctx), (*C.struct_whisper_state)(state), C.int(offset.Milliseconds()), C.int(threads), (*C.float)(&probs[0]))
+	if id < 0 {
+		return -1, nil, ErrLangDetectFailed
+	}
+	return int(id), probs, nil
+}
+
+// Convert text into tokens, returning the tokens or an error if the text
+// could not be tokenized
+func Whisper_tokenize(ctx *Context, text string) ([]int32, error) {
+	cText := C.CString(text)
+	defer C.free(unsafe.Pointer(cText))
+
+	// Return the number of tokens needed, which is negative when the buffer
+	// is too small
+	n := C.whisper_tokenize((*C.struct_whisper_context)(ctx), cText, nil, 0)
+	if n == 0 {
+		return []int32{}, nil
+	} else if n > 0 {
+		return nil, ErrTokenizeFailed
+	}
+
+	// Tokenize into the buffer
+	tokens := make([]int32, -n)
+	if C.whisper_tokenize((*C.struct_whisper_context)(ctx), cText, (*C.whisper_token)(unsafe.Pointer(&tokens[0])), -n) < 0 {
+		return nil, ErrTokenizeFailed
+	}
+	return tokens, nil
+}
+
+// Return the text of a token. The token should be less than the size of
+// the vocabulary
+func Whisper_token_to_str(ctx *Context, token int32) string {
+	return C.GoString(C.whisper_token_to_str((*C.struct_whisper_context)(ctx), C.whisper_token(token)))
+}
+
+// Return the number of tokens in the vocabulary
+func Whisper_n_vocab(ctx *Context) int {
+	return int(C.whisper_n_vocab((*C.struct_whisper_context)(ctx)))
+}
+
+// Return the number of tokens in the text context of the decoder
+func Whisper_n_text_ctx(ctx *Context) int {
+	return int(C.whisper_n_text_ctx((*C.struct_whisper_context)(ctx)))
+}
+
 // Number of generated text segments
 // A segment can be a few words, a sentence, or even a paragraph.
 func (ctx *Context) NumSegments() int {
@@ -116,6 +237,11 @@ func (ctx *Context) SegmentSpeakerTurnNext(n int) bool {
 	return (bool)(C.whisper_full_get_segment_speaker_turn_next((*C.struct_whisper_context)(ctx), C.int(n)))
 }
 
+// Get the probability that the specified segment contains no speech
+func (ctx *Context) SegmentNoSpeechProb(n int) float32 {
+	return float32(C.whisper_full_get_segment_no_speech_prob((*C.struct_whisper_context)(ctx), C.int(n)))
+}
+
 // Get the text of the specified segment
 func (ctx *Context) SegmentText(n int) string {
 	return C.GoString(C.whisper_full_get_segment_text((*C.struct_whisper_context)(ctx), C.int(n)))
@@ -537,6 +537,79 @@ func Test_whisper_05(t *testing.T) {
 	})
 }
 
+func Test_whisper_06(t *testing.T) {
+	assert := assert.New(t)
+
+	// Set logging
+	whisper.Whisper_log_set(func(level whisper.LogLevel, text string) {
+		t.Log(level, strings.TrimSpace(text))
+	})
+
+	// Create a file for the model
+	w, err := os.Create(filepath.Join(t.TempDir(), MODEL_TINY))
+	if !assert.NoError(err) {
+		t.SkipNow()
+	}
+	defer w.Close()
+
+	// Read the model
+	client := whisper.NewClient(MODEL_URL)
+	if !assert.NotNil(client) {
+		t.SkipNow()
+	}
+	if _, err := client.Get(context.Background(), w, MODEL_TINY); !assert.NoError(err) {
+		t.SkipNow()
+	}
+
+	// Load the weights once, and share them between two states
+	params := whisper.DefaultContextParams()
+	params.SetUseGpu(false)
+	ctx := whisper.Whisper_init_from_file_with_params_no_state(w.Name(), params)
+	if !assert.NotNil(ctx) {
+		t.SkipNow()
+	}
+	defer whisper.Whisper_free(ctx)
+
+	// Load samples
+	data, err := LoadSamples(SAMPLE_EN)
+	if !assert.NoError(err) {
+		t.SkipNow()
+	}
+
+	t.Run("FullWithState", func(t *testing.T) {
+		for _, name := range []string{"a", "b"} {
+			t.Run(name, func(t *testing.T) {
+				t.Parallel()
+
+				// Create a state
+				state := whisper.Whisper_init_state(ctx)
+				if !assert.NotNil(state) {
+					t.SkipNow()
+				}
+				defer whisper.Whisper_free_state(state)
+
+				// Set parameters
+				params := whisper.DefaultFullParams(whisper.SAMPLING_GREEDY)
+				params.SetLanguage("en")
+				params.SetSegmentCallbackWithState(state, func(new_segments int) {
+					num_segments := state.NumSegments()
+					for i := num_segments - new_segments; i < num_segments; i++ {
+						t.Logf("Segment %d: %v", i, state.Segment(ctx, i))
+					}
+				})
+				defer params.SetSegmentCallbackWithState(state, nil)
+
+				// Run the model
+				err := whisper.Whisper_full_with_state(ctx, state, params, data)
+				if !assert.NoError(err) {
+					t.SkipNow()
+				}
+				assert.NotZero(state.NumSegments())
+			})
+		}
+	})
+}
+
 //////////////////////////////////////////////////////////////////////////////
 
 // Return samples as []float32
@@ -0,0 +1,45 @@
+package whisper
+
+import (
+	"context"
+
+	// Packages
+	schema "github.com/mutablelogic/go-whisper/pkg/schema"
+	task "github.com/mutablelogic/go-whisper/pkg/task"
+)
+
+//////////////////////////////////////////////////////////////////////////////
+// PUBLIC METHODS
+
+// Convert text into the tokens of a model
+func (w *Whisper) Tokenize(ctx context.Context, model *schema.Model, text string) (*schema.Tokens, error) {
+	result := &schema.Tokens{Text: text}
+	if err := w.WithModel(ctx, model, func(task *task.Context) error {
+		tokens, err := task.Tokenize(text)
+		if err != nil {
+			return err
+		}
+		result.Model, result.Tokens, result.MaxPromptTokens = model.Id, tokens, task.MaxPromptTokens()
+		return nil
+	}); err != nil {
+		return nil, err
+	}
+	return result, nil
+}
+
+// Convert tokens of a model into text. Returns ErrBadParameter if any
+// token is not in the vocabulary of the model
+func (w *Whisper) Detokenize(ctx context.Context, model *schema.Model, tokens []int32) (*schema.Tokens, error) {
+	result := &schema.Tokens{Tokens: tokens}
+	if err := w.WithModel(ctx, model, func(task *task.Context) error {
+		text, err := task.Detokenize(tokens)
+		if err != nil {
+			return err
+		}
+		result.Model, result.Text, result.MaxPromptTokens = model.Id, text, task.MaxPromptTokens()
+		return nil
+	}); err != nil {
+		return nil, err
+	}
+	return result, nil
+}
@@ -7,9 +7,13 @@ import (
 	"fmt"
 	"runtime"
 	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
 
 	// Packages
 	ffmpeg "github.com/mutablelogic/go-media/pkg/ffmpeg"
+	job "github.com/mutablelogic/go-whisper/pkg/job"
 	pool "github.com/mutablelogic/go-whisper/pkg/pool"
 	schema "github.com/mutablelogic/go-whisper/pkg/schema"
 	store "github.com/mutablelogic/go-whisper/pkg/store"
@@ -27,6 +31,15 @@ import (
 type Whisper struct {
 	pool  *pool.ContextPool
 	store *store.Store
+	jobs  *job.Queue
+
+	// Path for the media of queued jobs
+	jobpath string
+
+	// Number of preloads in progress, and cancel the preload on close
+	preloading atomic.Int32
+	cancel     context.CancelFunc
+	wg         sync.WaitGroup
 }
 
 //////////////////////////////////////////////////////////////////////////////
@@ -41,6 +54,9 @@ const (
 
 	// Sample Rate
 	SampleRate = whisper.SampleRate
+
+	// How long to wait for a model to be released before it is deleted
+	drainTimeout = 30 * time.Second
 )
 
 //////////////////////////////////////////////////////////////////////////////
@@ -53,6 +69,7 @@ func New(path string, opt ...Opt) (*Whisper, error) {
 
 	// Set options
 	o.MaxConcurrent = runtime.NumCPU()
+	o.JobWorkers = 1
 	for _, fn := range opt {
 		if err := fn(&o); err != nil {
 			return nil, err
@@ -70,9 +87,29 @@ func New(path string, opt ...Opt) (*Whisper, error) {
 	if pool := pool.NewContextPool(path, o.MaxConcurrent, o.gpu); pool == nil {
 		return nil, ErrInternalAppError
 	} else {
+		pool.SetMemoryLimit(o.MemoryLimit)
+		pool.SetIdleTimeout(o.IdleTimeout)
 		w.pool = pool
 	}
 
+	// Create a job store, if jobs are persisted
+	var jobstore job.Store
+	if o.jobpath != "" {
+		if store, err := job.NewFileStore(o.jobpath); err != nil {
+			return nil, errors.Join(err, w.pool.Close())
+		} else {
+			jobstore = store
+			w.jobpath = o.jobpath
+		}
+	}
+
+	// Create a job queue, with workers which run the jobs
+	if jobs, err := job.NewQueue(o.JobWorkers, jobstore, w.runJob, job.LogFn(o.logfn)); err != nil {
+		return nil, errors.Join(err, w.pool.Close())
+	} else {
+		w.jobs = jobs
+	}
+
 	// Logging
 	if o.logfn != nil {
 		whisper.Whisper_log_set(func(level whisper.LogLevel, text string) {
@@ -86,6 +123,22 @@ func New(path string, opt ...Opt) (*Whisper, error) {
 		})
 	}
 
+	// Preload models in the background, the service is not ready until
+	// the preload has completed
+	if len(o.preload) > 0 {
+		ctx, cancel := context.WithCancel(context.Background())
+		w.cancel = cancel
+		w.preloading.Add(1)
+		w.wg.Add(1)
+		go func() {
+			defer w.wg.Done()
+			defer w.preloading.Add(-1)
+			if err := w.preload(ctx, o.warmup, o.preload...); err != nil && o.logfn != nil {
+				o.logfn(fmt.Sprint("preload: ", err))
+			}
+		}()
+	}
+
 	// Return success
 	return w, nil
 }
@@ -94,6 +147,17 @@ func New(path string, opt ...Opt) (*Whisper, error) {
 func (w *Whisper) Close() error {
 	var result error
 
+	// Cancel any preload
+	if w.cancel != nil {
+		w.cancel()
+	}
+	w.wg.Wait()
+
+	// Cancel jobs and stop the workers
+	if w.jobs != nil {
+		result = errors.Join(result, w.jobs.Close())
+	}
+
 	// Release pool resources
 	if w.pool != nil {
 		result = errors.Join(result, w.pool.Close())
@@ -102,6 +166,7 @@ func (w *Whisper) Close() error {
 	// Set all to nil
 	w.pool = nil
 	w.store = nil
+	w.jobs = nil
 
 	// Return any errors
 	return result
@@ -112,11 +177,15 @@ func (w *Whisper) Close() error {
 
 func (w *Whisper) MarshalJSON() ([]byte, error) {
 	return json.Marshal(struct {
+		Ready bool              `json:"ready"`
 		Store *store.Store      `json:"store"`
 		Pool  *pool.ContextPool `json:"pool"`
+		Jobs  *job.Queue        `json:"jobs"`
 	}{
+		Ready: w.Ready(),
 		Store: w.store,
 		Pool:  w.pool,
+		Jobs:  w.jobs,
 	})
 }
 
@@ -141,25 +210,22 @@ func (w *Whisper) GetModelById(id string) *schema.Model {
 	return w.store.ById(id)
 }
 
-// Delete a model by its id
+// Delete a model by its id. Requests for the model are rejected while
+// the model is being deleted, and any requests in progress are waited
+// for. Returns ErrChannelBlocked if the model is still in use after
+// a timeout.
 func (w *Whisper) DeleteModelById(id string) error {
 	model := w.store.ById(id)
 	if model == nil {
 		return ErrNotFound.Withf("%q", id)
 	}
 
-	// Empty the pool of this model
-	if err := w.pool.Drain(model); err != nil {
-		return err
-	}
-
-	// Delete the model
-	if err := w.store.Delete(model.Id); err != nil {
-		return err
-	}
-
-	// Return success
-	return nil
+	// Empty the pool of this model, then delete the model
+	ctx, cancel := context.WithTimeout(context.Background(), drainTimeout)
+	defer cancel()
+	return w.pool.Drain(ctx, model, func() error {
+		return w.store.Delete(model.Id)
+	})
 }
 
 // Download a model by path, where the directory is the root of the model
@@ -171,14 +237,15 @@ func (w *Whisper) DownloadModel(ctx context.Context, path string, fn func(curByt
 
 // Get a task for the specified model, which may load the model or
 // return an existing one. The context can then be used to run the Transcribe
-// function, and after the context is returned to the pool.
-func (w *Whisper) WithModel(model *schema.Model, fn func(task *task.Context) error) error {
+// function, and after the context is returned to the pool. If all contexts
+// are in use, then this waits until one is available or ctx is done.
+func (w *Whisper) WithModel(ctx context.Context, model *schema.Model, fn func(task *task.Context) error) error {
 	if model == nil || fn == nil {
 		return ErrBadParameter
 	}
 
 	// Get a context from the pool
-	task, err := w.pool.Get(model)
+	task, err := w.pool.Get(ctx, model)
 	if err != nil {
 		return err
 	}
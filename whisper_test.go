@@ -2,13 +2,17 @@ package whisper_test
 
 import (
 	"context"
-	"errors"
+	"encoding/json"
 	"os"
+	"sync"
 	"testing"
+	"time"
 
 	// Packages
 	wav "github.com/go-audio/wav"
 	whisper "github.com/mutablelogic/go-whisper"
+	pool "github.com/mutablelogic/go-whisper/pkg/pool"
+	schema "github.com/mutablelogic/go-whisper/pkg/schema"
 	task "github.com/mutablelogic/go-whisper/pkg/task"
 	assert "github.com/stretchr/testify/assert"
 
@@ -95,7 +99,7 @@ func Test_whisper_003(t *testing.T) {
 		assert.NotNil(model)
 
 		// Get the model for the first time
-		assert.NoError(service.WithModel(model, func(ctx *task.Context) error {
+		assert.NoError(service.WithModel(context.Background(), model, func(ctx *task.Context) error {
 			assert.NotNil(ctx)
 			return nil
 		}))
@@ -106,7 +110,7 @@ func Test_whisper_003(t *testing.T) {
 		assert.NotNil(model)
 
 		// Get the model for the second time
-		assert.NoError(service.WithModel(model, func(ctx *task.Context) error {
+		assert.NoError(service.WithModel(context.Background(), model, func(ctx *task.Context) error {
 			assert.NotNil(ctx)
 			return nil
 		}))
@@ -117,7 +121,7 @@ func Test_whisper_003(t *testing.T) {
 		assert.NotNil(model)
 
 		// Get the model for the third time
-		assert.NoError(service.WithModel(model, func(ctx *task.Context) error {
+		assert.NoError(service.WithModel(context.Background(), model, func(ctx *task.Context) error {
 			assert.NotNil(ctx)
 			return nil
 		}))
@@ -141,59 +145,76 @@ func Test_whisper_004(t *testing.T) {
 		t.Log(model)
 	})
 
-	var blocked int
-	t.Run("InParallel", func(t *testing.T) {
-		t.Run("WithModelContext1", func(t *testing.T) {
-			t.Parallel()
-			model := service.GetModelById(MODEL_TINY)
-			assert.NotNil(model)
-
-			err := service.WithModel(model, func(ctx *task.Context) error {
-				assert.NotNil(ctx)
-				return nil
-			})
-			if errors.Is(err, ErrChannelBlocked) {
-				blocked++
-			} else {
-				assert.NoError(err)
-			}
-		})
+	model := service.GetModelById(MODEL_TINY)
+	if !assert.NotNil(model) {
+		t.SkipNow()
+	}
 
-		t.Run("WithModelContext2", func(t *testing.T) {
-			t.Parallel()
-			model := service.GetModelById(MODEL_TINY)
-			assert.NotNil(model)
+	t.Run("Wait", func(t *testing.T) {
+		// Hold both contexts
+		release := HoldContexts(t, service, model, 2)
 
-			err := service.WithModel(model, func(ctx *task.Context) error {
-				assert.NotNil(ctx)
-				return nil
-			})
-			if errors.Is(err, ErrChannelBlocked) {
-				blocked++
-			} else {
-				assert.NoError(err)
+		// A cancelled context returns the context error while waiting
+		ctx, cancel := context.WithCancel(context.Background())
+		go func() {
+			for Queued(service) == 0 {
+				time.Sleep(time.Millisecond)
 			}
-		})
-
-		t.Run("WithModelContext3", func(t *testing.T) {
-			t.Parallel()
-			model := service.GetModelById(MODEL_TINY)
-			assert.NotNil(model)
+			cancel()
+		}()
+		assert.ErrorIs(service.WithModel(ctx, model, func(*task.Context) error {
+			return nil
+		}), context.Canceled)
 
-			err := service.WithModel(model, func(ctx *task.Context) error {
+		// The third caller waits until a context is released
+		done := make(chan error)
+		go func() {
+			done <- service.WithModel(context.Background(), model, func(ctx *task.Context) error {
 				assert.NotNil(ctx)
 				return nil
 			})
-			if errors.Is(err, ErrChannelBlocked) {
-				blocked++
-			} else {
-				assert.NoError(err)
-			}
-		})
+		}()
+		select {
+		case err := <-done:
+			t.Error("expected the caller to wait", err)
+		case <-time.After(100 * time.Millisecond):
+			assert.Equal(1, Queued(service))
+		}
+		release[0]()
+		assert.NoError(<-done)
+		release[1]()
 	})
 
-	// One of these should have been blocked
-	assert.Equal(1, blocked)
+	t.Run("Priority", func(t *testing.T) {
+		// Hold both contexts
+		release := HoldContexts(t, service, model, 2)
+
+		// Queue callers in order, with one caller at a higher priority
+		var wg sync.WaitGroup
+		var mu sync.Mutex
+		var order []int
+		for i, priority := range []int{0, 0, 1, 0} {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				assert.NoError(service.WithModel(pool.WithPriority(context.Background(), priority), model, func(*task.Context) error {
+					mu.Lock()
+					defer mu.Unlock()
+					order = append(order, i)
+					return nil
+				}))
+			}()
+			for Queued(service) != i+1 {
+				time.Sleep(time.Millisecond)
+			}
+		}
+
+		// Release one context, which is passed to each caller in turn
+		release[0]()
+		wg.Wait()
+		release[1]()
+		assert.Equal([]int{2, 0, 1, 3}, order)
+	})
 }
 
 func Test_whisper_005(t *testing.T) {
@@ -223,7 +244,7 @@ func Test_whisper_005(t *testing.T) {
 			t.SkipNow()
 		}
 
-		assert.NoError(service.WithModel(model, func(task *task.Context) error {
+		assert.NoError(service.WithModel(context.Background(), model, func(task *task.Context) error {
 			t.Log("Transcribing", len(samples), "samples")
 			return task.Transcribe(context.Background(), 0, samples, nil)
 		}))
@@ -239,7 +260,7 @@ func Test_whisper_005(t *testing.T) {
 			t.SkipNow()
 		}
 
-		assert.NoError(service.WithModel(model, func(task *task.Context) error {
+		assert.NoError(service.WithModel(context.Background(), model, func(task *task.Context) error {
 			t.Log("Transcribing", len(samples), "samples")
 			return task.Transcribe(context.Background(), 0, samples, nil)
 		}))
@@ -255,7 +276,7 @@ func Test_whisper_005(t *testing.T) {
 			t.SkipNow()
 		}
 
-		assert.NoError(service.WithModel(model, func(task *task.Context) error {
+		assert.NoError(service.WithModel(context.Background(), model, func(task *task.Context) error {
 			t.Log("Transcribing", len(samples), "samples")
 			return task.Transcribe(context.Background(), 0, samples, nil)
 		}))
@@ -292,7 +313,7 @@ func Test_whisper_006(t *testing.T) {
 				t.SkipNow()
 			}
 
-			assert.NoError(service.WithModel(model, func(task *task.Context) error {
+			assert.NoError(service.WithModel(context.Background(), model, func(task *task.Context) error {
 				t.Log("Transcribing", len(samples), "samples")
 				return task.Transcribe(context.Background(), 0, samples, nil)
 			}))
@@ -310,7 +331,7 @@ func Test_whisper_006(t *testing.T) {
 				t.SkipNow()
 			}
 
-			assert.NoError(service.WithModel(model, func(task *task.Context) error {
+			assert.NoError(service.WithModel(context.Background(), model, func(task *task.Context) error {
 				t.Log("Transcribing", len(samples), "samples")
 				return task.Transcribe(context.Background(), 0, samples, nil)
 			}))
@@ -328,7 +349,7 @@ func Test_whisper_006(t *testing.T) {
 				t.SkipNow()
 			}
 
-			assert.NoError(service.WithModel(model, func(task *task.Context) error {
+			assert.NoError(service.WithModel(context.Background(), model, func(task *task.Context) error {
 				t.Log("Transcribing", len(samples), "samples")
 				return task.Transcribe(context.Background(), 0, samples, nil)
 			}))
@@ -338,6 +359,45 @@ func Test_whisper_006(t *testing.T) {
 
 //////////////////////////////////////////////////////////////////////////////
 
+// Hold n contexts for a model, and return a function for each context
+// which releases it
+func HoldContexts(t *testing.T, service *whisper.Whisper, model *schema.Model, n int) []func() {
+	held := make(chan struct{})
+	release := make([]func(), n)
+	for i := range release {
+		ch, done := make(chan struct{}), make(chan struct{})
+		go func() {
+			defer close(done)
+			if err := service.WithModel(context.Background(), model, func(*task.Context) error {
+				held <- struct{}{}
+				<-ch
+				return nil
+			}); err != nil {
+				t.Error(err)
+				held <- struct{}{}
+			}
+		}()
+		<-held
+		release[i] = func() {
+			close(ch)
+			<-done
+		}
+	}
+	return release
+}
+
+// Return the number of callers waiting for a context
+func Queued(service *whisper.Whisper) int {
+	var status struct {
+		Pool struct {
+			Queued int `json:"queued"`
+		} `json:"pool"`
+	}
+	data, _ := json.Marshal(service)
+	json.Unmarshal(data, &status)
+	return status.Pool.Queued
+}
+
 // Return samples as []float32
 func LoadSamples(path string) ([]float32, error) {
 	fh, err := os.Open(path)
@@ -354,3 +414,22 @@ func LoadSamples(path string) ([]float32, error) {
 		return buf.AsFloat32Buffer().Data, nil
 	}
 }
+
+func Test_whisper_007(t *testing.T) {
+	assert := assert.New(t)
+	service, err := whisper.New(t.TempDir(), whisper.OptPreload("missing"), whisper.OptWarmup())
+	if !assert.NoError(err) {
+		t.SkipNow()
+	}
+	defer service.Close()
+
+	// The service becomes ready when the preload has completed
+	for i := 0; i < 100 && !service.Ready(); i++ {
+		time.Sleep(10 * time.Millisecond)
+	}
+	assert.True(service.Ready())
+
+	// Preloading a missing model returns an error
+	assert.ErrorIs(service.Preload(context.Background(), false, "missing"), ErrNotFound)
+	assert.True(service.Ready())
+}